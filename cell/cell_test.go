@@ -1,6 +1,7 @@
 package cell_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -50,3 +51,43 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestRetype(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+	rc, err := record.New(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to create new record with error: %v", err)
+	}
+	h, err := header.New(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to create Header(%d) with err: %v", ds.DatasetId, err)
+	}
+	op, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create a Operation with error: %v", err)
+	}
+	c, err := cell.New(tmp.Engine, rc.RecordId, h.HeaderId, op.OperationId, "2.5")
+	if err != nil {
+		t.Fatalf("failed to create a cell with error: %v", err)
+	}
+
+	if err := cell.Retype(context.Background(), tmp.Engine, h.HeaderId, header.ValueType_FLOAT); err != nil {
+		t.Fatalf("got unexpected err on Retype: %v", err)
+	}
+	var got float64
+	if err := tmp.Engine.DatabaseHandle.QueryRow("SELECT NumericValue FROM Cells WHERE CellId = $1", c.CellId).Scan(&got); err != nil {
+		t.Fatalf("failed to get NumericValue with err: %v", err)
+	}
+	if got != 2.5 {
+		t.Errorf("got NumericValue: %f, want: 2.5", got)
+	}
+}
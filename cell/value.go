@@ -0,0 +1,141 @@
+package cell
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dantespe/spectacle/db"
+	"github.com/dantespe/spectacle/header"
+)
+
+// TypedColumns of the Cells table, in the order of Typed.Args.
+var TypedColumns = []string{"numericvalue", "timevalue", "boolvalue", "parseerror"}
+
+// Typed holds the typed columns of a Cell, parsed from its RawValue. Each
+// column is nil unless the Cell's header has that type.
+type Typed struct {
+	// NumericValue is an int64 for INT columns, and a float64 for FLOAT.
+	NumericValue any
+
+	// TimeValue is a UTC time.Time for DATE and TIMESTAMP columns.
+	TimeValue any
+
+	// BoolValue is a bool for BOOL columns.
+	BoolValue any
+
+	// ParseError is why RawValue couldn't be parsed as the header's type.
+	ParseError any
+}
+
+// Parse returns the typed values of rv for a column of type vt. Blank values,
+// and the values of RAW and STRING columns, have no typed values.
+func Parse(vt header.ValueType, rv string) Typed {
+	var t Typed
+	if strings.TrimSpace(rv) == "" {
+		return t
+	}
+
+	v, err := vt.Parse(rv)
+	if err != nil {
+		t.ParseError = err.Error()
+		return t
+	}
+	switch v := v.(type) {
+	case int64:
+		t.NumericValue = v
+	case float64:
+		// NUMERIC can't hold infinities
+		if math.IsInf(v, 0) {
+			t.ParseError = fmt.Sprintf("%s out of range: %q", vt, rv)
+			return t
+		}
+		t.NumericValue = v
+	case time.Time:
+		t.TimeValue = v.UTC()
+	case bool:
+		t.BoolValue = v
+	}
+	return t
+}
+
+// Args returns the typed values in the order of TypedColumns.
+func (t Typed) Args() []any {
+	return []any{t.NumericValue, t.TimeValue, t.BoolValue, t.ParseError}
+}
+
+// Retype parses the RawValue of every Cell of headerId as vt, and updates
+// their typed columns.
+func Retype(ctx context.Context, eng *db.Engine, headerId int64, vt header.ValueType) error {
+	if eng == nil {
+		return fmt.Errorf("cannot Retype with nil db.Engine")
+	}
+	tx, err := eng.DatabaseHandle.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := RetypeTx(ctx, eng, tx, headerId, vt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RetypeTx is like Retype, but updates the cells within tx, which the caller
+// commits. The cells are read outside of tx.
+func RetypeTx(ctx context.Context, eng *db.Engine, tx *sql.Tx, headerId int64, vt header.ValueType) error {
+	if eng == nil {
+		return fmt.Errorf("cannot Retype with nil db.Engine")
+	}
+
+	rows, err := eng.DatabaseHandle.QueryContext(ctx, "SELECT CellId, RawValue FROM Cells WHERE HeaderId = $1", headerId)
+	if err != nil {
+		return fmt.Errorf("failed to query cells(headerId=%d) with error: %v", headerId, err)
+	}
+	defer rows.Close()
+
+	// Stage the new values, and apply them in a single UPDATE
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE CellTypes (CellId INTEGER, NumericValue NUMERIC, TimeValue TIMESTAMP, BoolValue BOOLEAN, ParseError TEXT) ON COMMIT DROP"); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("celltypes", append([]string{"cellid"}, TypedColumns...)...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for rows.Next() {
+		var cellId int64
+		var rv sql.NullString
+		if err := rows.Scan(&cellId, &rv); err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, append([]any{cellId}, Parse(vt, rv.String).Args()...)...); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE Cells SET NumericValue = t.NumericValue, TimeValue = t.TimeValue, BoolValue = t.BoolValue, ParseError = t.ParseError FROM CellTypes t WHERE Cells.CellId = t.CellId"); err != nil {
+		return fmt.Errorf("failed to update cells(headerId=%d) with error: %v", headerId, err)
+	}
+
+	// Drop the staged values now, so tx can retype another column
+	if _, err := tx.ExecContext(ctx, "DROP TABLE CellTypes"); err != nil {
+		return err
+	}
+	return nil
+}
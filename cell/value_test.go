@@ -0,0 +1,76 @@
+package cell_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/dantespe/spectacle/cell"
+	"github.com/dantespe/spectacle/header"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc string
+		vt   header.ValueType
+		rv   string
+		want cell.Typed
+	}{
+		{
+			desc: "blank",
+			vt:   header.ValueType_INT,
+			rv:   " ",
+			want: cell.Typed{},
+		},
+		{
+			desc: "string",
+			vt:   header.ValueType_STRING,
+			rv:   "Lakers",
+			want: cell.Typed{},
+		},
+		{
+			desc: "int",
+			vt:   header.ValueType_INT,
+			rv:   "42",
+			want: cell.Typed{NumericValue: int64(42)},
+		},
+		{
+			desc: "float",
+			vt:   header.ValueType_FLOAT,
+			rv:   "0.5",
+			want: cell.Typed{NumericValue: 0.5},
+		},
+		{
+			desc: "infinite_float",
+			vt:   header.ValueType_FLOAT,
+			rv:   "Inf",
+			want: cell.Typed{ParseError: `FLOAT out of range: "Inf"`},
+		},
+		{
+			desc: "timestamp",
+			vt:   header.ValueType_TIMESTAMP,
+			rv:   "2023-06-20T18:41:07-07:00",
+			want: cell.Typed{TimeValue: time.Date(2023, 6, 21, 1, 41, 7, 0, time.UTC)},
+		},
+		{
+			desc: "bool",
+			vt:   header.ValueType_BOOL,
+			rv:   "no",
+			want: cell.Typed{BoolValue: false},
+		},
+		{
+			desc: "parse_error",
+			vt:   header.ValueType_INT,
+			rv:   "N/A",
+			want: cell.Typed{ParseError: `strconv.ParseInt: parsing "N/A": invalid syntax`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, cell.Parse(tc.vt, tc.rv)); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
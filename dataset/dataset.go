@@ -2,7 +2,15 @@
 package dataset
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 
 	"github.com/dantespe/spectacle/db"
 )
@@ -21,10 +29,35 @@ type Dataset struct {
 	// HeadersSet
 	HeadersSet bool `json:"headersSet"`
 
+	// Description of the data in the dataset.
+	Description string `json:"description,omitempty"`
+
+	// Tags for finding the dataset.
+	Tags []string `json:"tags,omitempty"`
+
+	// Source the data came from, such as a URL.
+	Source string `json:"source,omitempty"`
+
+	// Owner of the dataset.
+	Owner string `json:"owner,omitempty"`
+
+	// CreationTime is when the dataset was created.
+	CreationTime time.Time `json:"creationTime"`
+
+	// UpdateTime is when the data or metadata of the dataset last changed.
+	UpdateTime time.Time `json:"updateTime"`
+
 	MinRecordId int64 `json:"-"`
 
 	MaxRecordId int64 `json:"-"`
 
+	// StagingFor is the DatasetId this dataset is loading a replacement for.
+	// Staging datasets are hidden from listings.
+	StagingFor int64 `json:"-"`
+
+	// DataVersion changes whenever the data of the dataset does.
+	DataVersion int64 `json:"-"`
+
 	eng *db.Engine
 }
 
@@ -41,6 +74,7 @@ func New(eng *db.Engine, opts ...Option) (*Dataset, error) {
 	ds := &Dataset{
 		HeadersSet: false,
 		NumRecords: 0,
+		Tags:       []string{},
 		eng:        eng,
 	}
 	for _, o := range opts {
@@ -48,7 +82,8 @@ func New(eng *db.Engine, opts ...Option) (*Dataset, error) {
 	}
 
 	// Insert Dataset into DB and update the ds Id
-	err := eng.DatabaseHandle.QueryRow("INSERT INTO Datasets (DisplayName, HeadersSet, NumRecords) VALUES ($1, 0, 0) RETURNING DatasetId", ds.DisplayName).Scan(&ds.DatasetId)
+	stagingFor := sql.NullInt64{Int64: ds.StagingFor, Valid: ds.StagingFor != 0}
+	err := eng.DatabaseHandle.QueryRow("INSERT INTO Datasets (DisplayName, HeadersSet, NumRecords, StagingFor) VALUES ($1, 0, 0, $2) RETURNING DatasetId, CreationTime, UpdateTime", ds.DisplayName, stagingFor).Scan(&ds.DatasetId, &ds.CreationTime, &ds.UpdateTime)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Dataset with error: %v", err)
 	}
@@ -75,13 +110,21 @@ func WithDisplayName(displayName string) Option {
 	}
 }
 
+// Returns an Option that makes the Dataset a hidden staging area for
+// replacing the contents of datasetId.
+func WithStagingFor(datasetId int64) Option {
+	return func(ds *Dataset) {
+		ds.StagingFor = datasetId
+	}
+}
+
 func GetDatasetFromId(eng *db.Engine, datasetId int64) (*Dataset, error) {
 	if eng == nil {
 		return nil, fmt.Errorf("eng must be non-nil")
 	}
 
 	// Get Dataset
-	rows, err := eng.DatabaseHandle.Query("SELECT DisplayName, HeadersSet, NumRecords, MinRecordId, MaxRecordId FROM Datasets WHERE DatasetId = $1", datasetId)
+	rows, err := eng.DatabaseHandle.Query("SELECT DisplayName, HeadersSet, NumRecords, MinRecordId, MaxRecordId, StagingFor, DataVersion, Description, Tags, Source, Owner, CreationTime, UpdateTime FROM Datasets WHERE DatasetId = $1", datasetId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query for dataset with error: %v", err)
 	}
@@ -96,49 +139,303 @@ func GetDatasetFromId(eng *db.Engine, datasetId int64) (*Dataset, error) {
 		return nil, nil
 	}
 
-	if err := rows.Scan(&ds.DisplayName, &ds.HeadersSet, &ds.NumRecords, &ds.MinRecordId, &ds.MaxRecordId); err != nil {
+	var stagingFor sql.NullInt64
+	if err := rows.Scan(&ds.DisplayName, &ds.HeadersSet, &ds.NumRecords, &ds.MinRecordId, &ds.MaxRecordId, &stagingFor, &ds.DataVersion, &ds.Description, pq.Array(&ds.Tags), &ds.Source, &ds.Owner, &ds.CreationTime, &ds.UpdateTime); err != nil {
 		return nil, err
 	}
+	ds.StagingFor = stagingFor.Int64
 	return ds, nil
 }
 
-func TotalDatasets(eng *db.Engine) (int64, error) {
+// Filter restricts the Datasets returned by GetDatasets.
+type Filter func(*filter)
+
+type filter struct {
+	tag    string
+	search string
+	empty  *bool
+}
+
+// FilterByTag returns a Filter that only matches Datasets tagged with tag,
+// ignoring case.
+func FilterByTag(tag string) Filter {
+	return func(f *filter) {
+		f.tag = tag
+	}
+}
+
+// FilterByName returns a Filter that only matches Datasets whose DisplayName
+// contains search, ignoring case.
+func FilterByName(search string) Filter {
+	return func(f *filter) {
+		f.search = search
+	}
+}
+
+// FilterByEmpty returns a Filter that only matches Datasets without records
+// if empty is true, and Datasets with records otherwise.
+func FilterByEmpty(empty bool) Filter {
+	return func(f *filter) {
+		f.empty = &empty
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards in a string.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where returns the conditions matching every filter, and appends their args
+// to args. Staging datasets never match.
+func where(filters []Filter, args *[]any) []string {
+	f := &filter{}
+	for _, fn := range filters {
+		fn(f)
+	}
+
+	conds := []string{"StagingFor IS NULL"}
+	if f.tag != "" {
+		*args = append(*args, f.tag)
+		conds = append(conds, fmt.Sprintf("EXISTS (SELECT 1 FROM UNNEST(Tags) t WHERE LOWER(t) = LOWER($%d))", len(*args)))
+	}
+	if f.search != "" {
+		*args = append(*args, "%"+likeEscaper.Replace(f.search)+"%")
+		conds = append(conds, fmt.Sprintf("DisplayName ILIKE $%d", len(*args)))
+	}
+	if f.empty != nil {
+		if *f.empty {
+			conds = append(conds, "COALESCE(NumRecords, 0) = 0")
+		} else {
+			conds = append(conds, "NumRecords > 0")
+		}
+	}
+	return conds
+}
+
+// TotalDatasets returns the number of Datasets matching every filter.
+func TotalDatasets(eng *db.Engine, filters ...Filter) (int64, error) {
 	if eng == nil {
 		return 0, fmt.Errorf("eng must be non-nil")
 	}
 
+	var args []any
+	conds := where(filters, &args)
 	var result int64
-	row := eng.DatabaseHandle.QueryRow("SELECT COUNT(*) FROM Datasets")
+	row := eng.DatabaseHandle.QueryRow("SELECT COUNT(*) FROM Datasets WHERE "+strings.Join(conds, " AND "), args...)
 	if err := row.Scan(&result); err != nil {
 		return 0, fmt.Errorf("got error for COUNT(*) with error: %v", err)
 	}
 	return result, nil
 }
 
-func GetDatasets(eng *db.Engine, maxDatasets int64) ([]*Dataset, error) {
-	if eng == nil {
-		return nil, fmt.Errorf("eng must be non-nil")
-	}
-	if maxDatasets <= 0 {
-		maxDatasets = 100
-	}
-	rows, err := eng.DatabaseHandle.Query("SELECT DatasetId, DisplayName, HeadersSet, NumRecords FROM Datasets ORDER BY DatasetId LIMIT $1", maxDatasets)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query for datasetId with error: %v", err)
-	}
-	defer rows.Close()
+// selectDatasets selects the columns read by scanDatasets.
+const selectDatasets = "SELECT DatasetId, DisplayName, HeadersSet, NumRecords, Description, Tags, Source, Owner, CreationTime, UpdateTime FROM Datasets"
 
+// scanDatasets reads every row of rows, which were selected by selectDatasets.
+func scanDatasets(eng *db.Engine, rows *sql.Rows) ([]*Dataset, error) {
+	defer rows.Close()
 	results := make([]*Dataset, 0)
 	for rows.Next() {
 		ds := &Dataset{
 			eng: eng,
 		}
-		if err := rows.Scan(&ds.DatasetId, &ds.DisplayName, &ds.HeadersSet, &ds.NumRecords); err != nil {
+		if err := rows.Scan(&ds.DatasetId, &ds.DisplayName, &ds.HeadersSet, &ds.NumRecords, &ds.Description, pq.Array(&ds.Tags), &ds.Source, &ds.Owner, &ds.CreationTime, &ds.UpdateTime); err != nil {
 			return nil, fmt.Errorf("failed to Scan(DatasetId, DisplayName, HeadersSet, NumRecords) for dataset with error: %v", err)
 		}
 		results = append(results, ds)
 	}
-	return results, nil
+	return results, rows.Err()
+}
+
+// Order is what Datasets are listed by.
+type Order string
+
+const (
+	Order_DATASET_ID    Order = "datasetId"
+	Order_NAME          Order = "name"
+	Order_CREATION_TIME Order = "creationTime"
+	Order_NUM_RECORDS   Order = "numRecords"
+	Order_UPDATE_TIME   Order = "updateTime"
+)
+
+// column returns the SQL expression o orders by, and the cast of a page
+// token's value to compare with it.
+func (o Order) column() (string, string) {
+	switch o {
+	case Order_NAME:
+		return "DisplayName", "$%d::text"
+	case Order_CREATION_TIME:
+		return "CreationTime", "$%d::timestamp"
+	case Order_NUM_RECORDS:
+		return "COALESCE(NumRecords, 0)", "$%d::bigint"
+	case Order_UPDATE_TIME:
+		return "UpdateTime", "$%d::timestamp"
+	}
+	return "", ""
+}
+
+// tokenTime formats times in page tokens, without a time zone, like the
+// TIMESTAMP columns they are compared to.
+const tokenTime = "2006-01-02 15:04:05.999999"
+
+// value returns ds's value for o, as stored in a page token.
+func (o Order) value(ds *Dataset) string {
+	switch o {
+	case Order_NAME:
+		return ds.DisplayName
+	case Order_CREATION_TIME:
+		return ds.CreationTime.Format(tokenTime)
+	case Order_NUM_RECORDS:
+		return strconv.FormatInt(ds.NumRecords, 10)
+	case Order_UPDATE_TIME:
+		return ds.UpdateTime.Format(tokenTime)
+	}
+	return ""
+}
+
+// Sort orders Datasets by Order, and then by DatasetId.
+type Sort struct {
+	Order Order
+	Desc  bool
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return string(s.Order) + ":desc"
+	}
+	return string(s.Order) + ":asc"
+}
+
+// ParseSort parses an Order, ignoring case, optionally followed by :asc or
+// :desc, e.g. "numRecords:desc". An empty string sorts by DatasetId.
+func ParseSort(s string) (Sort, error) {
+	field, dir, _ := strings.Cut(strings.TrimSpace(s), ":")
+	var sort Sort
+	switch strings.ToLower(strings.TrimSpace(dir)) {
+	case "", "asc":
+	case "desc":
+		sort.Desc = true
+	default:
+		return Sort{}, fmt.Errorf("invalid orderBy direction: %q", dir)
+	}
+	field = strings.TrimSpace(field)
+	if field == "" {
+		sort.Order = Order_DATASET_ID
+		return sort, nil
+	}
+	for _, o := range []Order{Order_DATASET_ID, Order_NAME, Order_CREATION_TIME, Order_NUM_RECORDS, Order_UPDATE_TIME} {
+		if strings.EqualFold(field, string(o)) {
+			sort.Order = o
+			return sort, nil
+		}
+	}
+	return Sort{}, fmt.Errorf("invalid orderBy: %q, must be one of datasetId, name, creationTime, numRecords or updateTime", field)
+}
+
+// PageToken is where a page of Datasets ended: the Sort it was listed with,
+// and the last Dataset's DatasetId and value for the Order.
+type PageToken struct {
+	Sort      string `json:"s"`
+	Value     string `json:"v,omitempty"`
+	DatasetId int64  `json:"i"`
+}
+
+// Encode returns t as an opaque, URL safe string.
+func (t *PageToken) Encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodePageToken returns the PageToken encoded by PageToken.Encode, and
+// checks it was listed with sort.
+func DecodePageToken(s string, sort Sort) (*PageToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pageToken: %q", s)
+	}
+	var t PageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("invalid pageToken: %q", s)
+	}
+	if t.Sort != sort.String() {
+		return nil, fmt.Errorf("pageToken is for orderBy=%s, not %s", t.Sort, sort)
+	}
+	return &t, nil
+}
+
+// GetDatasets returns up to maxDatasets Datasets matching every filter, in
+// the order they were created.
+func GetDatasets(eng *db.Engine, maxDatasets int64, filters ...Filter) ([]*Dataset, error) {
+	results, _, err := ListDatasets(eng, maxDatasets, Sort{Order: Order_DATASET_ID}, nil, filters...)
+	return results, err
+}
+
+// ListDatasets returns a page of up to maxDatasets Datasets matching every
+// filter, ordered by sort, starting after token if it is non-nil. The
+// returned PageToken continues the listing, and is nil on the last page.
+func ListDatasets(eng *db.Engine, maxDatasets int64, sort Sort, token *PageToken, filters ...Filter) ([]*Dataset, *PageToken, error) {
+	if eng == nil {
+		return nil, nil, fmt.Errorf("eng must be non-nil")
+	}
+	if maxDatasets <= 0 {
+		maxDatasets = 100
+	}
+
+	var args []any
+	conds := where(filters, &args)
+	column, cast := sort.Order.column()
+	cmp, dir := ">", "ASC"
+	if sort.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	if token != nil {
+		args = append(args, token.DatasetId)
+		id := len(args)
+		if column == "" {
+			conds = append(conds, fmt.Sprintf("DatasetId %s $%d", cmp, id))
+		} else {
+			args = append(args, token.Value)
+			conds = append(conds, fmt.Sprintf("(%s, DatasetId) %s ("+cast+", $%d)", column, cmp, len(args), id))
+		}
+	}
+	order := "DatasetId " + dir
+	if column != "" {
+		order = fmt.Sprintf("%s %s, %s", column, dir, order)
+	}
+
+	// One more than a page tells us if there is a next page
+	args = append(args, maxDatasets+1)
+	q := fmt.Sprintf("%s WHERE %s ORDER BY %s LIMIT $%d", selectDatasets, strings.Join(conds, " AND "), order, len(args))
+	rows, err := eng.DatabaseHandle.Query(q, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query for datasetId with error: %v", err)
+	}
+	results, err := scanDatasets(eng, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(results)) <= maxDatasets {
+		return results, nil, nil
+	}
+
+	results = results[:maxDatasets]
+	last := results[len(results)-1]
+	return results, &PageToken{
+		Sort:      sort.String(),
+		Value:     sort.Order.value(last),
+		DatasetId: last.DatasetId,
+	}, nil
+}
+
+// GetDatasetsByName returns the datasets whose DisplayName is name, ignoring
+// case.
+func GetDatasetsByName(eng *db.Engine, name string) ([]*Dataset, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("eng must be non-nil")
+	}
+	rows, err := eng.DatabaseHandle.Query(selectDatasets+" WHERE LOWER(DisplayName) = LOWER($1) AND StagingFor IS NULL ORDER BY DatasetId", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for datasets(displayName=%q) with error: %v", name, err)
+	}
+	return scanDatasets(eng, rows)
 }
 
 func (d *Dataset) SetHeaders(headers bool) error {
@@ -162,40 +459,261 @@ func (d *Dataset) SetHeaders(headers bool) error {
 	return nil
 }
 
-func (d *Dataset) UpdateNumRecords() error {
-	// Update TotalNumRecords
-	stmt, err := d.eng.DatabaseHandle.Prepare("UPDATE Datasets SET NumRecords = (SELECT COUNT(*) FROM RecordsProcessed WHERE DatasetId = $1) WHERE DatasetId = $1")
-	if err != nil {
-		return fmt.Errorf("failed to create dataset NumRecords prepared statement with error: %v", err)
+// Metadata holds the user-editable fields of a Dataset. Nil fields are left
+// unchanged.
+type Metadata struct {
+	DisplayName *string
+	Description *string
+	Tags        *[]string
+	Source      *string
+	Owner       *string
+}
+
+// SetMetadata updates the fields of d that are set in md, in a single
+// statement.
+func (d *Dataset) SetMetadata(md Metadata) error {
+	if d.eng == nil {
+		return fmt.Errorf("eng must be non-nil")
 	}
-	_, err = stmt.Exec(d.DatasetId)
-	if err != nil {
-		return fmt.Errorf("failed to update dataset NumRecords with error: %v", err)
+
+	var columns []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		columns = append(columns, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	var displayName string
+	if md.DisplayName != nil {
+		displayName = strings.TrimSpace(*md.DisplayName)
+		if displayName == "" {
+			return fmt.Errorf("displayName must be non-empty")
+		}
+		set("DisplayName", displayName)
+	}
+	if md.Description != nil {
+		set("Description", *md.Description)
+	}
+	var tags []string
+	if md.Tags != nil {
+		tags = cleanTags(*md.Tags)
+		set("Tags", pq.Array(tags))
+	}
+	if md.Source != nil {
+		set("Source", *md.Source)
+	}
+	if md.Owner != nil {
+		set("Owner", *md.Owner)
+	}
+	if len(columns) == 0 {
+		return nil
 	}
 
-	// Update Min Record
-	stmt, err = d.eng.DatabaseHandle.Prepare("UPDATE Datasets SET MinRecordId = (SELECT MIN(RecordId) FROM RecordsProcessed WHERE DatasetId = $1) WHERE DatasetId = $1")
-	if err != nil {
-		return fmt.Errorf("failed to create dataset NumRecords prepared statement with error: %v", err)
+	args = append(args, d.DatasetId)
+	q := fmt.Sprintf("UPDATE Datasets SET %s, UpdateTime = CURRENT_TIMESTAMP WHERE DatasetId = $%d RETURNING UpdateTime", strings.Join(columns, ", "), len(args))
+	if err := d.eng.DatabaseHandle.QueryRow(q, args...).Scan(&d.UpdateTime); err != nil {
+		return fmt.Errorf("failed to update dataset metadata with error: %v", err)
 	}
-	_, err = stmt.Exec(d.DatasetId)
-	if err != nil {
-		return fmt.Errorf("failed to update dataset NumRecords with error: %v", err)
+	if md.DisplayName != nil {
+		d.DisplayName = displayName
+	}
+	if md.Description != nil {
+		d.Description = *md.Description
+	}
+	if md.Tags != nil {
+		d.Tags = tags
+	}
+	if md.Source != nil {
+		d.Source = *md.Source
 	}
+	if md.Owner != nil {
+		d.Owner = *md.Owner
+	}
+	return nil
+}
+
+// cleanTags drops blank and repeated tags, ignoring case.
+func cleanTags(tags []string) []string {
+	clean := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		clean = append(clean, t)
+	}
+	return clean
+}
+
+// SetDisplayName renames d.
+func (d *Dataset) SetDisplayName(displayName string) error {
+	return d.SetMetadata(Metadata{DisplayName: &displayName})
+}
+
+// SetDescription sets the Description of d.
+func (d *Dataset) SetDescription(description string) error {
+	return d.SetMetadata(Metadata{Description: &description})
+}
+
+// SetTags replaces the Tags of d. Blank and repeated tags are dropped.
+func (d *Dataset) SetTags(tags []string) error {
+	return d.SetMetadata(Metadata{Tags: &tags})
+}
 
-	// Update Max Record
-	stmt, err = d.eng.DatabaseHandle.Prepare("UPDATE Datasets SET MaxRecordId = (SELECT MAX(RecordId) FROM RecordsProcessed WHERE DatasetId = $1) WHERE DatasetId = $1")
+// SetSource sets the Source of d.
+func (d *Dataset) SetSource(source string) error {
+	return d.SetMetadata(Metadata{Source: &source})
+}
+
+// SetOwner sets the Owner of d.
+func (d *Dataset) SetOwner(owner string) error {
+	return d.SetMetadata(Metadata{Owner: &owner})
+}
+
+func (d *Dataset) UpdateNumRecords() error {
+	// Update NumRecords, MinRecordId and MaxRecordId, skipping the write when
+	// none of them changed
+	res, err := d.eng.DatabaseHandle.Exec(`UPDATE Datasets SET NumRecords = r.NumRecords, MinRecordId = r.MinRecordId, MaxRecordId = r.MaxRecordId
+		FROM (SELECT COUNT(*) AS NumRecords, COALESCE(MIN(RecordId), -1) AS MinRecordId, COALESCE(MAX(RecordId), -1) AS MaxRecordId FROM RecordsProcessed WHERE DatasetId = $1) r
+		WHERE DatasetId = $1 AND (Datasets.NumRecords IS DISTINCT FROM r.NumRecords OR Datasets.MinRecordId IS DISTINCT FROM r.MinRecordId OR Datasets.MaxRecordId IS DISTINCT FROM r.MaxRecordId)`, d.DatasetId)
 	if err != nil {
-		return fmt.Errorf("failed to create dataset NumRecords prepared statement with error: %v", err)
+		return fmt.Errorf("failed to update dataset NumRecords with error: %v", err)
 	}
-	_, err = stmt.Exec(d.DatasetId)
+	n, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to update dataset NumRecords with error: %v", err)
 	}
 
+	// The records changed
+	if n > 0 {
+		if err := d.MarkChanged(); err != nil {
+			return err
+		}
+	}
+
 	// Update values
 	if err := d.eng.DatabaseHandle.QueryRow("SELECT NumRecords, MinRecordId, MaxRecordId FROM Datasets WHERE DatasetId = $1", d.DatasetId).Scan(&d.NumRecords, &d.MinRecordId, &d.MaxRecordId); err != nil {
 		return fmt.Errorf("failed to retrieve dataset NumRecords with error: %v", d.DatasetId)
 	}
 	return nil
 }
+
+// MarkChanged records that the data of d has changed, which invalidates
+// anything computed from it. It also sets the UpdateTime.
+func (d *Dataset) MarkChanged() error {
+	if d.eng == nil {
+		return fmt.Errorf("eng must be non-nil")
+	}
+	if err := d.eng.DatabaseHandle.QueryRow("UPDATE Datasets SET DataVersion = DataVersion + 1, UpdateTime = CURRENT_TIMESTAMP WHERE DatasetId = $1 RETURNING DataVersion, UpdateTime", d.DatasetId).Scan(&d.DataVersion, &d.UpdateTime); err != nil {
+		return fmt.Errorf("failed to update dataset DataVersion with error: %v", err)
+	}
+	return nil
+}
+
+// contentQueries delete everything stored under a DatasetId, except the
+// Dataset row itself.
+var contentQueries = []string{
+	"DELETE FROM Cells WHERE RecordId IN (SELECT RecordId FROM Records WHERE DatasetId = $1)",
+	"DELETE FROM RecordsProcessed WHERE DatasetId = $1",
+	"DELETE FROM Records WHERE DatasetId = $1",
+	"DELETE FROM Headers WHERE DatasetId = $1",
+	"DELETE FROM Profiles WHERE DatasetId = $1",
+}
+
+// moveQueries move everything stored under DatasetId $2 to DatasetId $1.
+// Cells follow their Records.
+var moveQueries = []string{
+	"UPDATE Headers SET DatasetId = $1 WHERE DatasetId = $2",
+	"UPDATE Records SET DatasetId = $1 WHERE DatasetId = $2",
+	"UPDATE RecordsProcessed SET DatasetId = $1 WHERE DatasetId = $2",
+}
+
+// execAll runs each query with args in tx, rolling back on the first error.
+func execAll(tx *sql.Tx, queries []string, args ...any) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(q, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// Replace atomically swaps the contents of d for the contents of staging,
+// and removes staging.
+func (d *Dataset) Replace(staging *Dataset) error {
+	if d.eng == nil {
+		return fmt.Errorf("eng must be non-nil")
+	}
+	if staging.StagingFor != d.DatasetId {
+		return fmt.Errorf("dataset %d is not staging for dataset %d", staging.DatasetId, d.DatasetId)
+	}
+
+	tx, err := d.eng.DatabaseHandle.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin replace with error: %v", err)
+	}
+	if err := execAll(tx, contentQueries, d.DatasetId); err != nil {
+		return fmt.Errorf("failed to clear dataset %d with error: %v", d.DatasetId, err)
+	}
+	if err := execAll(tx, moveQueries, d.DatasetId, staging.DatasetId); err != nil {
+		return fmt.Errorf("failed to move staging dataset %d with error: %v", staging.DatasetId, err)
+	}
+	if err := execAll(tx, []string{"DELETE FROM Datasets WHERE DatasetId = $1"}, staging.DatasetId); err != nil {
+		return fmt.Errorf("failed to delete staging dataset %d with error: %v", staging.DatasetId, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit replace with error: %v", err)
+	}
+
+	if err := d.UpdateNumRecords(); err != nil {
+		return err
+	}
+	return d.SetHeaders(staging.HeadersSet)
+}
+
+// Drop deletes d and everything stored under it.
+func (d *Dataset) Drop() error {
+	if d.eng == nil {
+		return fmt.Errorf("eng must be non-nil")
+	}
+	tx, err := d.eng.DatabaseHandle.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin drop with error: %v", err)
+	}
+	queries := append(append([]string{}, contentQueries...), "DELETE FROM Datasets WHERE DatasetId = $1")
+	if err := execAll(tx, queries, d.DatasetId); err != nil {
+		return fmt.Errorf("failed to drop dataset %d with error: %v", d.DatasetId, err)
+	}
+	return tx.Commit()
+}
+
+// DropStaging drops every staging Dataset, and returns how many there were.
+func DropStaging(eng *db.Engine) (int, error) {
+	if eng == nil {
+		return 0, fmt.Errorf("eng must be non-nil")
+	}
+	rows, err := eng.DatabaseHandle.Query("SELECT DatasetId FROM Datasets WHERE StagingFor IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query for staging datasets with error: %v", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		ds := &Dataset{DatasetId: id, eng: eng}
+		if err := ds.Drop(); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
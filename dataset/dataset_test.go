@@ -110,6 +110,216 @@ func TestGetDatasets(t *testing.T) {
 	}
 }
 
+func TestGetDatasetsFilters(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	for _, tc := range []struct {
+		name string
+		tags []string
+	}{
+		{"nba-teams", []string{"sports", "NBA"}},
+		{"nba_players", []string{"sports"}},
+		{"weather", nil},
+	} {
+		ds, err := dataset.New(tmp.Engine, dataset.WithDisplayName(tc.name))
+		if err != nil {
+			t.Fatalf("failed to create dataset with err: %v", err)
+		}
+		if err := ds.SetTags(tc.tags); err != nil {
+			t.Fatalf("failed to SetTags with err: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		filters []dataset.Filter
+		want    int
+	}{
+		{"none", nil, 3},
+		{"tag", []dataset.Filter{dataset.FilterByTag("nba")}, 1},
+		{"name", []dataset.Filter{dataset.FilterByName("NBA")}, 2},
+		{"name_wildcard", []dataset.Filter{dataset.FilterByName("a_p")}, 1},
+		{"tag_and_name", []dataset.Filter{dataset.FilterByTag("sports"), dataset.FilterByName("players")}, 1},
+		{"empty", []dataset.Filter{dataset.FilterByEmpty(true)}, 3},
+		{"populated", []dataset.Filter{dataset.FilterByEmpty(false)}, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ds, err := dataset.GetDatasets(tmp.Engine, 100, tc.filters...)
+			if err != nil {
+				t.Fatalf("got error for GetDatasets(): %v", err)
+			}
+			if len(ds) != tc.want {
+				t.Errorf("got len: %d, want: %d", len(ds), tc.want)
+			}
+			total, err := dataset.TotalDatasets(tmp.Engine, tc.filters...)
+			if err != nil {
+				t.Fatalf("got error for TotalDatasets(): %v", err)
+			}
+			if total != int64(tc.want) {
+				t.Errorf("got total: %d, want: %d", total, tc.want)
+			}
+		})
+	}
+}
+
+func TestListDatasets(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	for _, name := range []string{"c", "a", "b", "a", "d"} {
+		if _, err := dataset.New(tmp.Engine, dataset.WithDisplayName(name)); err != nil {
+			t.Fatalf("failed to create dataset with err: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		desc string
+		sort string
+		want []string
+	}{
+		{"default", "", []string{"c", "a", "b", "a", "d"}},
+		{"name", "name", []string{"a", "a", "b", "c", "d"}},
+		{"name_desc", "NAME:desc", []string{"d", "c", "b", "a", "a"}},
+		{"creation_time_desc", "creationTime:desc", []string{"d", "a", "b", "a", "c"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			sort, err := dataset.ParseSort(tc.sort)
+			if err != nil {
+				t.Fatalf("got error for ParseSort(%q): %v", tc.sort, err)
+			}
+
+			// Read two at a time
+			var got []string
+			var token *dataset.PageToken
+			for i := 0; i < 5; i++ {
+				page, next, err := dataset.ListDatasets(tmp.Engine, 2, sort, token)
+				if err != nil {
+					t.Fatalf("got error for ListDatasets(): %v", err)
+				}
+				for _, ds := range page {
+					got = append(got, ds.DisplayName)
+				}
+				if next == nil {
+					break
+				}
+				if token, err = dataset.DecodePageToken(next.Encode(), sort); err != nil {
+					t.Fatalf("got error for DecodePageToken(): %v", err)
+				}
+			}
+			if diff := cmp.Diff(got, tc.want); diff != "" {
+				t.Errorf("ListDatasets() diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want dataset.Sort
+	}{
+		{"", dataset.Sort{Order: dataset.Order_DATASET_ID}},
+		{"name", dataset.Sort{Order: dataset.Order_NAME}},
+		{" NumRecords : DESC ", dataset.Sort{Order: dataset.Order_NUM_RECORDS, Desc: true}},
+		{"updateTime:asc", dataset.Sort{Order: dataset.Order_UPDATE_TIME}},
+	}
+	for _, tc := range testCases {
+		got, err := dataset.ParseSort(tc.in)
+		if err != nil {
+			t.Errorf("got error for ParseSort(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseSort(%q) = %v, want: %v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"size", "name:up"} {
+		if _, err := dataset.ParseSort(in); err == nil {
+			t.Errorf("ParseSort(%q) expected error, got nil", in)
+		}
+	}
+}
+
+func TestDecodePageToken(t *testing.T) {
+	sort := dataset.Sort{Order: dataset.Order_NAME}
+	token := &dataset.PageToken{Sort: sort.String(), Value: "teams", DatasetId: 4}
+	got, err := dataset.DecodePageToken(token.Encode(), sort)
+	if err != nil {
+		t.Fatalf("got error for DecodePageToken(): %v", err)
+	}
+	if *got != *token {
+		t.Errorf("DecodePageToken() = %v, want: %v", got, token)
+	}
+
+	if _, err := dataset.DecodePageToken(token.Encode(), dataset.Sort{Order: dataset.Order_NAME, Desc: true}); err == nil {
+		t.Errorf("DecodePageToken() with another sort expected error, got nil")
+	}
+	if _, err := dataset.DecodePageToken("not-a-token", sort); err == nil {
+		t.Errorf("DecodePageToken(%q) expected error, got nil", "not-a-token")
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create dataset with err: %v", err)
+	}
+	if err := ds.SetDisplayName(" "); err == nil {
+		t.Errorf("SetDisplayName(\" \") expected error, got nil")
+	}
+	if err := ds.SetDisplayName("teams"); err != nil {
+		t.Errorf("failed to SetDisplayName with err: %v", err)
+	}
+	if err := ds.SetDescription("NBA teams"); err != nil {
+		t.Errorf("failed to SetDescription with err: %v", err)
+	}
+	if err := ds.SetTags([]string{"sports", " ", "NBA", "nba"}); err != nil {
+		t.Errorf("failed to SetTags with err: %v", err)
+	}
+	if err := ds.SetSource("https://www.nba.com"); err != nil {
+		t.Errorf("failed to SetSource with err: %v", err)
+	}
+	if err := ds.SetOwner("dantespe"); err != nil {
+		t.Errorf("failed to SetOwner with err: %v", err)
+	}
+
+	// A blank displayName fails the whole update
+	blank, description := " ", "Basketball teams"
+	if err := ds.SetMetadata(dataset.Metadata{DisplayName: &blank, Description: &description}); err == nil {
+		t.Errorf("SetMetadata(displayName: \" \") expected error, got nil")
+	}
+	if ds.Description != "NBA teams" {
+		t.Errorf("got Description: %q, want: %q", ds.Description, "NBA teams")
+	}
+
+	ds2, err := dataset.GetDatasetFromId(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to retrieve dataset: %v", err)
+	}
+	if !DatasetCmp(ds, ds2) {
+		t.Errorf("Got diff: %s, want: ''", DatasetDiff(ds, ds2))
+	}
+	if len(ds2.Tags) != 2 {
+		t.Errorf("got tags: %v, want: [sports NBA]", ds2.Tags)
+	}
+}
+
 func TestSetDatasets(t *testing.T) {
 	tmp, err := spectesting.NewTempPostgres()
 	if err != nil {
@@ -153,4 +363,86 @@ func TestUpdateNumRecords(t *testing.T) {
 	if ds.NumRecords != 0 {
 		t.Errorf("got NumRecords: %d, want: 0", ds.NumRecords)
 	}
+
+	// Nothing changed, so the data didn't either
+	version := ds.DataVersion
+	if err = ds.UpdateNumRecords(); err != nil {
+		t.Fatalf("got unexpected err on UpdateNumRecords: %v", err)
+	}
+	if ds.DataVersion != version {
+		t.Errorf("got DataVersion: %d, want: %d", ds.DataVersion, version)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create dataset with err: %v", err)
+	}
+	staging, err := dataset.New(tmp.Engine, dataset.WithStagingFor(ds.DatasetId))
+	if err != nil {
+		t.Fatalf("failed to create staging dataset with err: %v", err)
+	}
+
+	// Staging datasets are hidden
+	total, err := dataset.TotalDatasets(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to get TotalDatasets with err: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("got TotalDatasets: %d, want: 1", total)
+	}
+
+	// Only the staging dataset of ds can replace it
+	other, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create dataset with err: %v", err)
+	}
+	if err := other.Replace(staging); err == nil {
+		t.Errorf("got nil err on Replace with another dataset's staging, want err")
+	}
+
+	if err := ds.Replace(staging); err != nil {
+		t.Fatalf("got unexpected err on Replace: %v", err)
+	}
+	got, err := dataset.GetDatasetFromId(tmp.Engine, staging.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to retrieve staging dataset: %v", err)
+	}
+	if got != nil {
+		t.Errorf("got staging dataset %d after Replace, want: nil", staging.DatasetId)
+	}
+}
+
+func TestDropStaging(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create dataset with err: %v", err)
+	}
+	if _, err := dataset.New(tmp.Engine, dataset.WithStagingFor(ds.DatasetId)); err != nil {
+		t.Fatalf("failed to create staging dataset with err: %v", err)
+	}
+
+	n, err := dataset.DropStaging(tmp.Engine)
+	if err != nil {
+		t.Fatalf("got unexpected err on DropStaging: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("got DropStaging: %d, want: 1", n)
+	}
+	if got, _ := dataset.GetDatasetFromId(tmp.Engine, ds.DatasetId); got == nil {
+		t.Errorf("DropStaging dropped dataset %d, want it kept", ds.DatasetId)
+	}
 }
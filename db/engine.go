@@ -264,6 +264,7 @@ func NewTx(e *Engine, table string, args ...string) (*Tx, error) {
 
 	stmt, err := tx.Prepare(pq.CopyIn(table, args...))
 	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
@@ -283,7 +284,9 @@ func (t *Tx) Exec(args ...interface{}) error {
 	t.buf++
 
 	if t.isFull() {
-		t.flush()
+		if err := t.flush(); err != nil {
+			return err
+		}
 		return t.reset()
 	}
 	return nil
@@ -294,9 +297,6 @@ func (t *Tx) isFull() bool {
 }
 
 func (t *Tx) flush() error {
-	if t.buf == 0 {
-		return nil
-	}
 	if err := t.stmt.Close(); err != nil {
 		return err
 	}
@@ -311,6 +311,7 @@ func (t *Tx) reset() error {
 
 	stmt, err := tx.Prepare(pq.CopyIn(t.table, t.args...))
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
@@ -323,3 +324,10 @@ func (t *Tx) reset() error {
 func (t *Tx) Close() error {
 	return t.flush()
 }
+
+// Rollback discards the pending batch. Batches that were already flushed
+// stay committed.
+func (t *Tx) Rollback() error {
+	t.stmt.Close()
+	return t.tx.Rollback()
+}
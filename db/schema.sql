@@ -1,3 +1,5 @@
+-- Tables are upgraded in place when they were created by an older schema,
+-- so the whole file can be re-applied.
 CREATE TABLE IF NOT EXISTS Datasets(
     DatasetId SERIAL,
     DisplayName TEXT NOT NULL,
@@ -5,29 +7,76 @@ CREATE TABLE IF NOT EXISTS Datasets(
     NumRecords INTEGER,
     MinRecordId INTEGER DEFAULT -1,
     MaxRecordId INTEGER DEFAULT -1,
+    StagingFor INTEGER,
+    DataVersion INTEGER DEFAULT 0,
+    Description TEXT NOT NULL DEFAULT '',
+    Tags TEXT[] NOT NULL DEFAULT '{}',
+    Source TEXT NOT NULL DEFAULT '',
+    Owner TEXT NOT NULL DEFAULT '',
+    CreationTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UpdateTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     PRIMARY KEY (DatasetId)
 );
 
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS StagingFor INTEGER;
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS DataVersion INTEGER DEFAULT 0;
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS Description TEXT NOT NULL DEFAULT '';
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS Tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS Source TEXT NOT NULL DEFAULT '';
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS Owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS CreationTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE Datasets ADD COLUMN IF NOT EXISTS UpdateTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+-- Datasets are listed by (CreationTime, DatasetId) and (UpdateTime, DatasetId),
+-- which skips rows where either is NULL.
+UPDATE Datasets SET DataVersion = 0 WHERE DataVersion IS NULL;
+UPDATE Datasets SET CreationTime = CURRENT_TIMESTAMP WHERE CreationTime IS NULL;
+UPDATE Datasets SET UpdateTime = CreationTime WHERE UpdateTime IS NULL;
+
 CREATE TABLE IF NOT EXISTS Headers(
     HeaderId SERIAL,
     DatasetId INTEGER REFERENCES Datasets(DatasetId),
     ColumnIndex INTEGER,
     DisplayName TEXT,
     ValueType TEXT NOT NULL,
+    ValueTypeSet BOOLEAN DEFAULT FALSE,
     PRIMARY KEY (HeaderId)
 );
 
+ALTER TABLE Headers ADD COLUMN IF NOT EXISTS ValueTypeSet BOOLEAN DEFAULT FALSE;
+UPDATE Headers SET ValueTypeSet = FALSE WHERE ValueTypeSet IS NULL;
+
 CREATE INDEX IF NOT EXISTS idx_datasetid_headers ON Headers(DatasetId);
 
 CREATE TABLE IF NOT EXISTS Operations (
     OperationId SERIAL,
+    OperationType TEXT,
     OperationStatus TEXT NOT NULL,
     ErrorMessage TEXT,
+    DatasetId INTEGER,
     CreationTime TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    StartTime TIMESTAMP,
     FinishTime TIMESTAMP,
+    Phase TEXT,
+    BytesRead BIGINT DEFAULT 0,
+    RowsProcessed BIGINT DEFAULT 0,
+    TotalRows BIGINT DEFAULT 0,
+    PercentComplete REAL DEFAULT 0,
     PRIMARY KEY (OperationId)
 );
 
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS OperationType TEXT;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS DatasetId INTEGER;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS StartTime TIMESTAMP;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS Phase TEXT;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS BytesRead BIGINT DEFAULT 0;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS RowsProcessed BIGINT DEFAULT 0;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS TotalRows BIGINT DEFAULT 0;
+ALTER TABLE Operations ADD COLUMN IF NOT EXISTS PercentComplete REAL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_datasetid_operations ON Operations(DatasetId);
+CREATE INDEX IF NOT EXISTS idx_status_operations ON Operations(OperationStatus);
+
 CREATE TABLE IF NOT EXISTS Records (
     RecordId SERIAL,
     OperationId INTEGER REFERENCES Operations(OperationId),
@@ -37,6 +86,7 @@ CREATE TABLE IF NOT EXISTS Records (
 );
 
 CREATE INDEX IF NOT EXISTS idx_datasetid_records ON Records(DatasetId);
+CREATE INDEX IF NOT EXISTS idx_operationid_records ON Records(OperationId);
 
 CREATE TABLE IF NOT EXISTS RecordsProcessed (
     RecordId INTEGER REFERENCES Records(RecordId),
@@ -53,12 +103,39 @@ CREATE TABLE IF NOT EXISTS Cells (
     DatasetId INTEGER REFERENCES Datasets(DatasetId),
     OperationId INTEGER REFERENCES Operations(OperationId),
     RawValue TEXT,
-    IntValue INTEGER,
-    FloatValue FLOAT,
+    NumericValue NUMERIC,
+    TimeValue TIMESTAMP,
+    BoolValue BOOLEAN,
+    ParseError TEXT,
     UNIQUE (HeaderId, RecordId),
     PRIMARY KEY (CellId)
 );
 
+ALTER TABLE Cells ADD COLUMN IF NOT EXISTS NumericValue NUMERIC;
+ALTER TABLE Cells ADD COLUMN IF NOT EXISTS TimeValue TIMESTAMP;
+ALTER TABLE Cells ADD COLUMN IF NOT EXISTS BoolValue BOOLEAN;
+ALTER TABLE Cells ADD COLUMN IF NOT EXISTS ParseError TEXT;
+
+-- Cells used to store numbers in IntValue and FloatValue.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'cells' AND column_name = 'intvalue') THEN
+        UPDATE Cells SET NumericValue = COALESCE(IntValue::NUMERIC, FloatValue::NUMERIC) WHERE NumericValue IS NULL;
+        ALTER TABLE Cells DROP COLUMN IntValue;
+        ALTER TABLE Cells DROP COLUMN FloatValue;
+    END IF;
+END $$;
+
 CREATE INDEX IF NOT EXISTS idx_recordid_cells ON Cells(RecordId);
 CREATE INDEX IF NOT EXISTS idx_datasetid_cells ON Cells(DatasetId);
+CREATE INDEX IF NOT EXISTS idx_operationid_cells ON Cells(OperationId);
+CREATE INDEX IF NOT EXISTS idx_headerid_numericvalue_cells ON Cells(HeaderId, NumericValue);
+CREATE INDEX IF NOT EXISTS idx_headerid_timevalue_cells ON Cells(HeaderId, TimeValue);
+CREATE INDEX IF NOT EXISTS idx_headerid_rawvalue_cells ON Cells(HeaderId, RawValue);
 
+CREATE TABLE IF NOT EXISTS Profiles (
+    DatasetId INTEGER REFERENCES Datasets(DatasetId),
+    DataVersion INTEGER NOT NULL,
+    Profile JSONB NOT NULL,
+    PRIMARY KEY (DatasetId)
+);
@@ -2,6 +2,7 @@
 package handler
 
 import (
+	"io"
 	"log"
 	"net/http"
 
@@ -14,19 +15,22 @@ type RestHandler struct {
 	rb  *manager.RequestBuilder
 }
 
-func newRestHandler() (*RestHandler, error) {
-	mgr, err := manager.New()
+func newRestHandler(opts ...manager.Option) (*RestHandler, error) {
+	mgr, err := manager.New(opts...)
 	if err != nil {
 		return nil, err
 	}
+	if err := mgr.Recover(); err != nil {
+		return nil, err
+	}
 	return &RestHandler{
 		mgr: mgr,
 		rb:  &manager.RequestBuilder{},
 	}, nil
 }
 
-func AddRestHandlerRoutes(rg *gin.RouterGroup) error {
-	rh, err := newRestHandler()
+func AddRestHandlerRoutes(rg *gin.RouterGroup, opts ...manager.Option) error {
+	rh, err := newRestHandler(opts...)
 	if err != nil {
 		return err
 	}
@@ -36,6 +40,9 @@ func AddRestHandlerRoutes(rg *gin.RouterGroup) error {
 	for k, v := range rh.PostRoutes() {
 		rg.POST(k, v)
 	}
+	for k, v := range rh.PatchRoutes() {
+		rg.PATCH(k, v)
+	}
 	for k, v := range rh.DeleteRoutes() {
 		rg.DELETE(k, v)
 	}
@@ -66,6 +73,17 @@ func (h *RestHandler) GetDataset(c *gin.Context) {
 	c.JSON(h.mgr.GetDataset(req))
 }
 
+func (h *RestHandler) UpdateDataset(c *gin.Context) {
+	req, err := h.rb.UpdateDatasetRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.UpdateDataset(req))
+}
+
 func (h *RestHandler) ListDatasets(c *gin.Context) {
 	req, err := h.rb.ListDatasetsRequestBuilder(c)
 	if err != nil {
@@ -100,6 +118,28 @@ func (h *RestHandler) GetHeaders(c *gin.Context) {
 	c.JSON(h.mgr.GetHeaders(req))
 }
 
+func (h *RestHandler) GetProfile(c *gin.Context) {
+	req, err := h.rb.GetProfileRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.GetProfile(req))
+}
+
+func (h *RestHandler) UpdateHeader(c *gin.Context) {
+	req, err := h.rb.UpdateHeaderRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.UpdateHeader(req))
+}
+
 func (h *RestHandler) Data(c *gin.Context) {
 	req, err := h.rb.DataRequestBuilder(c)
 	if err != nil {
@@ -111,6 +151,69 @@ func (h *RestHandler) Data(c *gin.Context) {
 	c.JSON(h.mgr.GetData(req))
 }
 
+func (h *RestHandler) Aggregate(c *gin.Context) {
+	req, err := h.rb.AggregateRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.Aggregate(req))
+}
+
+func (h *RestHandler) Query(c *gin.Context) {
+	req, err := h.rb.QueryRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	code, resp := h.mgr.Query(req)
+	if req.Format == "" || code != http.StatusOK {
+		c.JSON(code, resp)
+		return
+	}
+	c.Header("Content-Type", req.Format.ContentType())
+	c.Status(code)
+	if err := resp.Export(req.Format, c.Writer); err != nil {
+		log.Printf("failed to write query results with err: %v", err)
+	}
+}
+
+func (h *RestHandler) Export(c *gin.Context) {
+	req, err := h.rb.ExportRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	code, resp := h.mgr.Export(req)
+	if code != http.StatusOK {
+		c.JSON(code, resp)
+		return
+	}
+
+	// Errors after the first write can't change the status, so the
+	// download is cut short instead.
+	c.Header("Content-Type", resp.ContentType)
+	c.Header("Content-Disposition", resp.ContentDisposition())
+	c.Status(code)
+	if err := resp.Write(c.Request.Context(), c.Writer); err != nil {
+		log.Printf("failed to export dataset %d with err: %v", req.DatasetId, err)
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, &manager.ExportResponse{
+				Message: "INTERNAL SERVER ERROR",
+				Code:    http.StatusInternalServerError,
+			})
+		}
+	}
+}
+
 func (h *RestHandler) DeleteDataset(c *gin.Context) {
 	req, err := h.rb.DeleteDataRequestBuilder(c)
 	if err != nil {
@@ -122,20 +225,100 @@ func (h *RestHandler) DeleteDataset(c *gin.Context) {
 	c.JSON(h.mgr.DeleteDataset(req))
 }
 
+func (h *RestHandler) GetOperation(c *gin.Context) {
+	req, err := h.rb.GetOperationRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.GetOperation(req))
+}
+
+func (h *RestHandler) ListOperations(c *gin.Context) {
+	req, err := h.rb.ListOperationsRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.ListOperations(req))
+}
+
+// OperationEvents streams the operation's status, progress and errors as
+// server-sent events, and closes the stream once the operation completes.
+func (h *RestHandler) OperationEvents(c *gin.Context) {
+	req, err := h.rb.GetOperationRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	code, resp := h.mgr.WatchOperation(req)
+	if code != http.StatusOK {
+		c.JSON(code, resp)
+		return
+	}
+	defer resp.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-resp.Events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("operation", e)
+			return !e.Complete()
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func (h *RestHandler) CancelOperation(c *gin.Context) {
+	req, err := h.rb.CancelOperationRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(h.mgr.CancelOperation(req))
+}
+
 func (h *RestHandler) GetRoutes() map[string]gin.HandlerFunc {
 	return map[string]gin.HandlerFunc{
-		"/status":              h.Status,
-		"/datasets":            h.ListDatasets,
-		"/dataset/:id":         h.GetDataset,
-		"/dataset/:id/headers": h.GetHeaders,
-		"/data/:id":            h.Data,
+		"/status":               h.Status,
+		"/datasets":             h.ListDatasets,
+		"/dataset/:id":          h.GetDataset,
+		"/dataset/:id/headers":  h.GetHeaders,
+		"/dataset/:id/profile":  h.GetProfile,
+		"/dataset/:id/export":   h.Export,
+		"/data/:id":             h.Data,
+		"/operation/:id":        h.GetOperation,
+		"/operation/:id/events": h.OperationEvents,
+		"/operations":           h.ListOperations,
 	}
 }
 
 func (h *RestHandler) PostRoutes() map[string]gin.HandlerFunc {
 	return map[string]gin.HandlerFunc{
-		"/dataset":            h.CreateDataset,
-		"/dataset/:id/upload": h.UploadDataset,
+		"/dataset":               h.CreateDataset,
+		"/dataset/:id/upload":    h.UploadDataset,
+		"/dataset/:id/aggregate": h.Aggregate,
+		"/query":                 h.Query,
+		// Custom methods, e.g. /operation/<operationId>:cancel
+		"/operation/:id": h.CancelOperation,
+	}
+}
+
+func (h *RestHandler) PatchRoutes() map[string]gin.HandlerFunc {
+	return map[string]gin.HandlerFunc{
+		"/dataset/:id":                   h.UpdateDataset,
+		"/dataset/:id/headers/:headerId": h.UpdateHeader,
 	}
 }
 
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/dantespe/spectacle/dataset"
 	"github.com/dantespe/spectacle/handler"
 	"github.com/dantespe/spectacle/manager"
 	"github.com/gin-gonic/gin"
@@ -30,6 +32,29 @@ func BuffFromRequest(t *testing.T, req interface{}) *bytes.Buffer {
 	return &buf
 }
 
+// UploadRequest returns a multipart upload of csv to target, with fields set
+// as form fields.
+func UploadRequest(t *testing.T, target string, csv string, fields map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, err := writer.CreateFormFile("file", "dataset.csv")
+	if err != nil {
+		t.Fatalf("failed to create form file with err: %v", err)
+	}
+	fw.Write([]byte(csv))
+	for k, v := range fields {
+		writer.WriteField(k, v)
+	}
+	writer.Close()
+
+	req, err := http.NewRequest("POST", target, body)
+	if err != nil {
+		t.Fatalf("failed to build new http request with err: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
 func TestStatus(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/rest/status", nil)
 
@@ -153,6 +178,61 @@ func TestGetDataset(t *testing.T) {
 	assert.Empty(t, resp3.Dataset)
 }
 
+func TestUpdateDataset(t *testing.T) {
+	router := GetRouter()
+
+	// Create a dataset
+	req, err := http.NewRequest("POST", "/rest/dataset", BuffFromRequest(t, &manager.CreateDatasetRequest{}))
+	if err != nil {
+		t.Fatalf("failed to build request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var created manager.CreateDatasetResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal request with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusCreated, "response code")
+
+	// Empty updates and blank names are rejected
+	for _, body := range []string{`{}`, `{"displayName": " "}`} {
+		req, err := http.NewRequest("PATCH", fmt.Sprintf("/rest/dataset/%d", created.DatasetId), bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("failed to build http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// Rename and tag it
+	req, err = http.NewRequest("PATCH", fmt.Sprintf("/rest/dataset/%d", created.DatasetId), bytes.NewBufferString(`{"displayName": "teams", "tags": ["sports"]}`))
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.UpdateDatasetResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusOK, "response code")
+	assert.Equal(t, w.Code, resp.Code)
+	assert.Equal(t, "teams", resp.Dataset.DisplayName)
+	assert.Equal(t, []string{"sports"}, resp.Dataset.Tags)
+
+	// Try to update a non-existing dataset
+	req, err = http.NewRequest("PATCH", fmt.Sprintf("/rest/dataset/%d", rand.Int63()), bytes.NewBufferString(`{"owner": "dantespe"}`))
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+}
+
 func TestListDatasets(t *testing.T) {
 	router := GetRouter()
 	for i := 0; i < 10; i++ {
@@ -180,6 +260,63 @@ func TestListDatasets(t *testing.T) {
 	assert.Equal(t, w.Code, http.StatusOK)
 	assert.Equal(t, w.Code, resp.Code)
 	assert.Equal(t, resp.TotalDatasets, 10)
+
+	// maxDatasets is still read from a JSON body
+	req, err = http.NewRequest("GET", "/rest/datasets", bytes.NewBufferString(`{"maxDatasets": 3}`))
+	if err != nil {
+		t.Fatalf("failed to bring new http request with err: %v", err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	resp = manager.ListDatasetsResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Len(t, resp.Results, 3)
+
+	// Page through them by name
+	var names []string
+	next := "/rest/datasets?orderBy=name:desc&maxDatasets=4"
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			t.Fatalf("failed to bring new http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, w.Code, http.StatusOK)
+
+		var resp manager.ListDatasetsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal json with err: %v", err)
+		}
+		for _, ds := range resp.Results {
+			names = append(names, ds.DisplayName)
+		}
+		next = ""
+		if resp.NextPageToken != "" {
+			next = "/rest/datasets?orderBy=name:desc&maxDatasets=4&pageToken=" + resp.NextPageToken
+		}
+	}
+	assert.Len(t, names, 10)
+	assert.IsDecreasing(t, names)
+
+	// Unknown orders, and tokens from another order, are rejected
+	for _, target := range []string{
+		"/rest/datasets?orderBy=size",
+		"/rest/datasets?maxDatasets=0",
+		"/rest/datasets?empty=maybe",
+		"/rest/datasets?orderBy=name&pageToken=" + (&dataset.PageToken{Sort: "numRecords:asc"}).Encode(),
+	} {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatalf("failed to bring new http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
 }
 
 func TestUploadDataset(t *testing.T) {
@@ -201,3 +338,251 @@ func TestUploadDataset(t *testing.T) {
 
 	// TODO(#14): Create tests for UploadDataset
 }
+
+func TestUploadDatasetHasHeaders(t *testing.T) {
+	router := GetRouter()
+
+	// hasHeaders must be a bool
+	req := UploadRequest(t, "/rest/dataset/1/upload", "a,b\n1,2\n", map[string]string{"hasHeaders": "sometimes"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestUploadDatasetMode(t *testing.T) {
+	router := GetRouter()
+
+	// upsert requires a key
+	req := UploadRequest(t, "/rest/dataset/1/upload", "a,b\n1,2\n", map[string]string{"mode": "upsert"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestData(t *testing.T) {
+	router := GetRouter()
+
+	// maxresults must be within bounds
+	for _, target := range []string{
+		"/rest/data/1?maxresults=0",
+		"/rest/data/1?maxresults=-2",
+		"/rest/data/1?maxresults=10000000000",
+	} {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatalf("failed to build http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+}
+
+func TestUpdateHeader(t *testing.T) {
+	router := GetRouter()
+
+	// Unknown value types are rejected
+	req, err := http.NewRequest("PATCH", "/rest/dataset/1/headers/1", bytes.NewBufferString(`{"valueType": "DECIMAL"}`))
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+
+	// Try to update a non-existing header
+	req, err = http.NewRequest("PATCH", fmt.Sprintf("/rest/dataset/%d/headers/%d", rand.Int63(), rand.Int63()), bytes.NewBufferString(`{"valueType": "INT"}`))
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.UpdateHeaderResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+	assert.Equal(t, w.Code, resp.Code)
+	assert.NotEmpty(t, resp.Message)
+}
+
+func TestAggregate(t *testing.T) {
+	router := GetRouter()
+
+	// Unknown and incomplete aggregations are rejected
+	for _, body := range []string{
+		`{"aggregations": []}`,
+		`{"aggregations": [{"op": "mode", "column": "CITY"}]}`,
+		`{"aggregations": [{"op": "sum"}]}`,
+		`{"aggregations": [{"op": "percentile", "column": "ARENACAPACITY", "percentile": 90}]}`,
+		`{"aggregations": [{"op": "count"}], "filter": "CITY eq"}`,
+	} {
+		req, err := http.NewRequest("POST", "/rest/dataset/1/aggregate", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("failed to build http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	// Try to aggregate a non-existing dataset
+	req, err := http.NewRequest("POST", fmt.Sprintf("/rest/dataset/%d/aggregate", rand.Int63()), bytes.NewBufferString(`{"aggregations": [{"op": "count"}]}`))
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.AggregateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+	assert.Equal(t, w.Code, resp.Code)
+	assert.NotEmpty(t, resp.Message)
+}
+
+func TestQuery(t *testing.T) {
+	router := GetRouter()
+
+	testCases := []struct {
+		desc string
+		body string
+		code int
+	}{
+		{"empty", `{"query": ""}`, http.StatusBadRequest},
+		{"not_a_select", `{"query": "DELETE FROM Cells"}`, http.StatusBadRequest},
+		{"unknown_dataset", fmt.Sprintf(`{"query": "SELECT * FROM dataset_%d"}`, rand.Int63()), http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req, err := http.NewRequest("POST", "/rest/query", bytes.NewBufferString(tc.body))
+		if err != nil {
+			t.Fatalf("failed to build http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc.desc)
+	}
+}
+
+func TestExport(t *testing.T) {
+	router := GetRouter()
+
+	// Unknown formats and bad filters are rejected
+	for _, target := range []string{
+		"/rest/dataset/1/export?format=pdf",
+		"/rest/dataset/1/export?filter=CITY%20eq",
+		"/rest/dataset/1/export?headers=a",
+	} {
+		req, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatalf("failed to build http request with err: %v", err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+	}
+
+	// Try to export a non-existing dataset
+	req, err := http.NewRequest("GET", fmt.Sprintf("/rest/dataset/%d/export?format=csv", rand.Int63()), nil)
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.ExportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+	assert.Equal(t, w.Code, resp.Code)
+	assert.NotEmpty(t, resp.Message)
+}
+
+func TestGetOperation(t *testing.T) {
+	router := GetRouter()
+
+	// Try to get a non-existing operation
+	req, err := http.NewRequest("GET", fmt.Sprintf("/rest/operation/%d", rand.Int63()), nil)
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.GetOperationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusNotFound, "response code")
+	assert.Equal(t, w.Code, resp.Code)
+	assert.NotEmpty(t, resp.Message)
+	assert.Empty(t, resp.Operation)
+}
+
+func TestListOperations(t *testing.T) {
+	router := GetRouter()
+
+	req, err := http.NewRequest("GET", "/rest/operations?status=running,success", nil)
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp manager.ListOperationsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal json with err: %v", err)
+	}
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, w.Code, resp.Code)
+
+	// Unknown statuses are rejected
+	req, err = http.NewRequest("GET", "/rest/operations?status=sleeping", nil)
+	if err != nil {
+		t.Fatalf("failed to build http request with err: %v", err)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusBadRequest)
+}
+
+func TestCancelOperation(t *testing.T) {
+	router := GetRouter()
+
+	testCases := []struct {
+		desc string
+		path string
+		code int
+	}{
+		{
+			desc: "missing_operation",
+			path: fmt.Sprintf("/rest/operation/%d:cancel", rand.Int63()),
+			code: http.StatusNotFound,
+		},
+		{
+			desc: "unknown_method",
+			path: "/rest/operation/1:pause",
+			code: http.StatusBadRequest,
+		},
+		{
+			desc: "no_method",
+			path: "/rest/operation/1",
+			code: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest("POST", tc.path, nil)
+			if err != nil {
+				t.Fatalf("failed to build http request with err: %v", err)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, w.Code, tc.code)
+		})
+	}
+}
@@ -113,20 +113,37 @@ func (u *UIHandler) MakeDataset(c *gin.Context) {
 }
 
 func (u *UIHandler) CreateChart(c *gin.Context) {
-	test_bytes, err1 := json.Marshal([3][3]int{{45, 10, 443}, {2901, 500, 195}, {}})
-	if err1 != nil {
-		log.Printf("There's a bug while marshalling array in ui.CreateChart: %v", err1)
+	// Without a dataset the builder starts empty
+	spans, values := []string{}, [][]any{}
+	req, err := u.rb.ChartRequestBuilder(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if req != nil {
+		code, resp := u.mgr.Aggregate(req)
+		if code != http.StatusOK {
+			c.JSON(code, resp)
+			return
+		}
+		spans, values = resp.Columns, resp.Values
 	}
 
-	test_spans, err2 := json.Marshal([3]string{"column_1", "column_2", "column_3"})
-	if err2 != nil {
-		log.Printf("There's a bug while marshalling array in ui.CreateChart: %v", err2)
+	spansJson, err := json.Marshal(spans)
+	if err != nil {
+		log.Printf("There's a bug while marshalling array in ui.CreateChart: %v", err)
+	}
+	valuesJson, err := json.Marshal(values)
+	if err != nil {
+		log.Printf("There's a bug while marshalling array in ui.CreateChart: %v", err)
 	}
 
 	c.HTML(http.StatusOK, "chart_builder.html",
 		gin.H{
-			"test_spans":  string(test_spans),
-			"test_values": string(test_bytes),
+			"spans":  string(spansJson),
+			"values": string(valuesJson),
 		})
 }
 
@@ -1,30 +1,46 @@
 package header
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 
 	"github.com/dantespe/spectacle/db"
 )
 
-type ValueType string
-
-const (
-	ValueType_RAW   ValueType = "RAW"
-	ValueType_INT             = "INT"
-	ValueType_FLOAT           = "FLOAT"
-)
-
 type Header struct {
 	HeaderId    int64 `json:"headerId"`
 	columnIndex int64
 	DisplayName string `json:"displayName"`
 	datasetId   int64
-	valueType   ValueType
-	eng         *db.Engine
+
+	// ValueType of the column. Inferred from uploads, unless ValueTypeSet.
+	ValueType ValueType `json:"valueType"`
+
+	// ValueTypeSet is true if the ValueType was set by the user.
+	ValueTypeSet bool `json:"valueTypeSet"`
+
+	eng *db.Engine
 }
 
 const BucketIncrement = 1000
 
+// DefaultDisplayName is the name given to the i-th (0-indexed) column of a
+// file without a header row.
+func DefaultDisplayName(i int) string {
+	return fmt.Sprintf("column_%d", i+1)
+}
+
+// Option for creating new Headers.
+type Option func(*Header)
+
+// WithDisplayName returns an Option with the DisplayName set.
+func WithDisplayName(displayName string) Option {
+	return func(h *Header) {
+		h.DisplayName = displayName
+	}
+}
+
 func (h *Header) SetColumnIndex(i int64) error {
 	if h.eng == nil {
 		return fmt.Errorf("cannot create a new Header with nil db.Engine")
@@ -42,18 +58,21 @@ func (h *Header) SetColumnIndex(i int64) error {
 }
 
 // New extends the dataset's headers by one and returns it.
-func New(eng *db.Engine, datasetId int64) (*Header, error) {
+func New(eng *db.Engine, datasetId int64, opts ...Option) (*Header, error) {
 	if eng == nil {
 		return nil, fmt.Errorf("cannot create a new Header with nil db.Engine")
 	}
 
 	h := &Header{
 		datasetId: datasetId,
-		valueType: ValueType_RAW,
+		ValueType: ValueType_RAW,
 		eng:       eng,
 	}
+	for _, o := range opts {
+		o(h)
+	}
 
-	if err := eng.DatabaseHandle.QueryRow("INSERT INTO Headers(DatasetId, ValueType, DisplayName) VALUES($1, $2, $3) RETURNING HeaderId", datasetId, ValueType_RAW, "").Scan(&h.HeaderId); err != nil {
+	if err := eng.DatabaseHandle.QueryRow("INSERT INTO Headers(DatasetId, ValueType, DisplayName) VALUES($1, $2, $3) RETURNING HeaderId", datasetId, ValueType_RAW, h.DisplayName).Scan(&h.HeaderId); err != nil {
 		return nil, fmt.Errorf("failed to build operation PrepareStatement with error: %v", err)
 	}
 	return h, nil
@@ -65,7 +84,7 @@ func GetHeaders(eng *db.Engine, datasetId int64) ([]*Header, error) {
 	}
 
 	var results []*Header
-	rows, err := eng.DatabaseHandle.Query("SELECT HeaderId, ValueType, DisplayName FROM Headers WHERE DatasetId = $1 ORDER BY ColumnIndex, HeaderId", datasetId)
+	rows, err := eng.DatabaseHandle.Query("SELECT HeaderId, ValueType, ValueTypeSet, DisplayName FROM Headers WHERE DatasetId = $1 ORDER BY ColumnIndex, HeaderId", datasetId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get headers(datasetId=%d) with error: %v", datasetId, err)
 	}
@@ -73,12 +92,101 @@ func GetHeaders(eng *db.Engine, datasetId int64) ([]*Header, error) {
 
 	for rows.Next() {
 		h := &Header{
-			eng: eng,
+			datasetId: datasetId,
+			eng:       eng,
 		}
-		if err := rows.Scan(&h.HeaderId, &h.valueType, &h.DisplayName); err != nil {
+		if err := rows.Scan(&h.HeaderId, &h.ValueType, &h.ValueTypeSet, &h.DisplayName); err != nil {
 			return nil, fmt.Errorf("failed to Headers Scan with error: %v", err)
 		}
 		results = append(results, h)
 	}
 	return results, nil
 }
+
+// GetHeader returns the Header of the dataset with headerId, or nil if there
+// is no such Header.
+func GetHeader(eng *db.Engine, datasetId int64, headerId int64) (*Header, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("cannot GetHeader with nil db.Engine")
+	}
+
+	h := &Header{
+		HeaderId:  headerId,
+		datasetId: datasetId,
+		eng:       eng,
+	}
+	err := eng.DatabaseHandle.QueryRow("SELECT ValueType, ValueTypeSet, DisplayName FROM Headers WHERE DatasetId = $1 AND HeaderId = $2", datasetId, headerId).Scan(&h.ValueType, &h.ValueTypeSet, &h.DisplayName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header(headerId=%d) with error: %v", headerId, err)
+	}
+	return h, nil
+}
+
+// SetValueType sets the ValueType of the column. It won't be changed by
+// later uploads.
+func (h *Header) SetValueType(vt ValueType) error {
+	if h.eng == nil {
+		return fmt.Errorf("cannot SetValueType with nil db.Engine")
+	}
+	if _, err := h.eng.DatabaseHandle.Exec(setValueType, vt, h.HeaderId); err != nil {
+		return fmt.Errorf("failed to update Headers ValueType with error: %v", err)
+	}
+	h.ValueType = vt
+	h.ValueTypeSet = true
+	return nil
+}
+
+// SetValueTypeTx is like SetValueType, but updates the header within tx,
+// which the caller commits.
+func (h *Header) SetValueTypeTx(ctx context.Context, tx *sql.Tx, vt ValueType) error {
+	if _, err := tx.ExecContext(ctx, setValueType, vt, h.HeaderId); err != nil {
+		return fmt.Errorf("failed to update Headers ValueType with error: %v", err)
+	}
+	h.ValueType = vt
+	h.ValueTypeSet = true
+	return nil
+}
+
+const setValueType = "UPDATE Headers SET ValueType = $1, ValueTypeSet = TRUE WHERE HeaderId = $2"
+
+// Infer widens the ValueType of the column to hold values of vt, unless it
+// was set by the user.
+func (h *Header) Infer(vt ValueType) error {
+	if h.eng == nil {
+		return fmt.Errorf("cannot Infer with nil db.Engine")
+	}
+	if h.ValueTypeSet {
+		return nil
+	}
+	widened := h.ValueType.Widen(vt)
+	if widened == h.ValueType {
+		return nil
+	}
+	if _, err := h.eng.DatabaseHandle.Exec(inferValueType, widened, h.HeaderId); err != nil {
+		return fmt.Errorf("failed to update Headers ValueType with error: %v", err)
+	}
+	h.ValueType = widened
+	return nil
+}
+
+// InferTx is like Infer, but updates the header within tx, which the caller
+// commits.
+func (h *Header) InferTx(ctx context.Context, tx *sql.Tx, vt ValueType) error {
+	if h.ValueTypeSet {
+		return nil
+	}
+	widened := h.ValueType.Widen(vt)
+	if widened == h.ValueType {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, inferValueType, widened, h.HeaderId); err != nil {
+		return fmt.Errorf("failed to update Headers ValueType with error: %v", err)
+	}
+	h.ValueType = widened
+	return nil
+}
+
+const inferValueType = "UPDATE Headers SET ValueType = $1 WHERE HeaderId = $2 AND NOT ValueTypeSet"
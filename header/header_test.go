@@ -1,6 +1,7 @@
 package header_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/dantespe/spectacle/dataset"
@@ -53,3 +54,111 @@ func TestGetHeaders(t *testing.T) {
 		t.Fatalf("failed to GetHeaders(%d) with err: %v", ds.DatasetId, err)
 	}
 }
+
+func TestNewWithDisplayName(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+
+	if _, err := header.New(tmp.Engine, ds.DatasetId, header.WithDisplayName(header.DefaultDisplayName(0))); err != nil {
+		t.Fatalf("failed to create New header: %v", err)
+	}
+
+	headers, err := header.GetHeaders(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to GetHeaders(%d) with err: %v", ds.DatasetId, err)
+	}
+	if len(headers) != 1 || headers[0].DisplayName != "column_1" {
+		t.Errorf("got headers: %v, want: [column_1]", headers)
+	}
+}
+
+func TestSetValueType(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+	h, err := header.New(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to create New header: %v", err)
+	}
+
+	// Inference widens the ValueType
+	if err := h.Infer(header.ValueType_INT); err != nil {
+		t.Fatalf("got unexpected err on Infer: %v", err)
+	}
+	if err := h.Infer(header.ValueType_FLOAT); err != nil {
+		t.Fatalf("got unexpected err on Infer: %v", err)
+	}
+
+	// Until the user sets it
+	if err := h.SetValueType(header.ValueType_STRING); err != nil {
+		t.Fatalf("got unexpected err on SetValueType: %v", err)
+	}
+	if err := h.Infer(header.ValueType_INT); err != nil {
+		t.Fatalf("got unexpected err on Infer: %v", err)
+	}
+
+	got, err := header.GetHeader(tmp.Engine, ds.DatasetId, h.HeaderId)
+	if err != nil {
+		t.Fatalf("failed to GetHeader: %v", err)
+	}
+	if got.ValueType != header.ValueType_STRING || !got.ValueTypeSet {
+		t.Errorf("got ValueType: %s, ValueTypeSet: %t, want: STRING, true", got.ValueType, got.ValueTypeSet)
+	}
+
+	// Headers of other datasets are not found
+	if got, err := header.GetHeader(tmp.Engine, ds.DatasetId+1, h.HeaderId); err != nil || got != nil {
+		t.Errorf("got GetHeader: %v, %v, want: nil, nil", got, err)
+	}
+}
+
+func TestInferTx(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+	h, err := header.New(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("failed to create New header: %v", err)
+	}
+
+	// The widening isn't stored until tx commits
+	ctx := context.Background()
+	tx, err := tmp.Engine.DatabaseHandle.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to BeginTx: %v", err)
+	}
+	if err := h.InferTx(ctx, tx, header.ValueType_INT); err != nil {
+		t.Fatalf("got unexpected err on InferTx: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to Rollback: %v", err)
+	}
+	got, err := header.GetHeader(tmp.Engine, ds.DatasetId, h.HeaderId)
+	if err != nil {
+		t.Fatalf("failed to GetHeader: %v", err)
+	}
+	if got.ValueType != header.ValueType_RAW {
+		t.Errorf("got ValueType: %s, want: RAW", got.ValueType)
+	}
+}
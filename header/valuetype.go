@@ -0,0 +1,135 @@
+package header
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueType of the values in a column.
+type ValueType string
+
+const (
+	// ValueType_RAW is a column whose type has not been inferred yet.
+	ValueType_RAW       ValueType = "RAW"
+	ValueType_INT       ValueType = "INT"
+	ValueType_FLOAT     ValueType = "FLOAT"
+	ValueType_BOOL      ValueType = "BOOL"
+	ValueType_DATE      ValueType = "DATE"
+	ValueType_TIMESTAMP ValueType = "TIMESTAMP"
+	ValueType_STRING    ValueType = "STRING"
+)
+
+// inferOrder is the order ValueTypes are tried in by InferValueType, from
+// most to least specific.
+var inferOrder = []ValueType{
+	ValueType_INT,
+	ValueType_FLOAT,
+	ValueType_BOOL,
+	ValueType_DATE,
+	ValueType_TIMESTAMP,
+}
+
+// Layouts accepted for DATE and TIMESTAMP values.
+var (
+	dateLayouts = []string{
+		"2006-01-02",
+		"2006/01/02",
+	}
+	timestampLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04",
+	}
+)
+
+// ParseValueType returns the ValueType named s, ignoring case.
+func ParseValueType(s string) (ValueType, error) {
+	vt := ValueType(strings.ToUpper(s))
+	switch vt {
+	case ValueType_RAW, ValueType_STRING:
+		return vt, nil
+	}
+	for _, t := range inferOrder {
+		if vt == t {
+			return vt, nil
+		}
+	}
+	return "", fmt.Errorf("unknown value type: %q", s)
+}
+
+// Parse parses v as a value of vt. INT values are returned as int64, FLOAT
+// as float64, BOOL as bool, and DATE and TIMESTAMP as time.Time. RAW and
+// STRING values are returned as is.
+func (vt ValueType) Parse(v string) (any, error) {
+	switch vt {
+	case ValueType_INT:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	case ValueType_FLOAT:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case ValueType_BOOL:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "t", "yes", "y":
+			return true, nil
+		case "false", "f", "no", "n":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid BOOL: %q", v)
+	case ValueType_DATE:
+		return parseTime(dateLayouts, v)
+	case ValueType_TIMESTAMP:
+		return parseTime(timestampLayouts, v)
+	}
+	return v, nil
+}
+
+func parseTime(layouts []string, v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	for _, l := range layouts {
+		if t, err := time.Parse(l, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", v)
+}
+
+// InferValueType returns the most specific ValueType that v parses as.
+// Blank values have no type, so they are ValueType_RAW.
+func InferValueType(v string) ValueType {
+	if strings.TrimSpace(v) == "" {
+		return ValueType_RAW
+	}
+	for _, vt := range inferOrder {
+		if _, err := vt.Parse(v); err == nil {
+			return vt
+		}
+	}
+	return ValueType_STRING
+}
+
+// Widen returns the most specific ValueType that holds the values of both
+// vt and o.
+func (vt ValueType) Widen(o ValueType) ValueType {
+	switch {
+	case vt == o || o == ValueType_RAW:
+		return vt
+	case vt == ValueType_RAW:
+		return o
+	case vt.numeric() && o.numeric():
+		return ValueType_FLOAT
+	case vt.temporal() && o.temporal():
+		return ValueType_TIMESTAMP
+	}
+	return ValueType_STRING
+}
+
+func (vt ValueType) numeric() bool {
+	return vt == ValueType_INT || vt == ValueType_FLOAT
+}
+
+func (vt ValueType) temporal() bool {
+	return vt == ValueType_DATE || vt == ValueType_TIMESTAMP
+}
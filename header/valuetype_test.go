@@ -0,0 +1,76 @@
+package header_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+func TestInferValueType(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  header.ValueType
+	}{
+		{"", header.ValueType_RAW},
+		{"  ", header.ValueType_RAW},
+		{"42", header.ValueType_INT},
+		{"-7", header.ValueType_INT},
+		{"3.14", header.ValueType_FLOAT},
+		{"1e6", header.ValueType_FLOAT},
+		{"TRUE", header.ValueType_BOOL},
+		{"no", header.ValueType_BOOL},
+		{"2023-06-20", header.ValueType_DATE},
+		{"2023-06-20T18:41:07Z", header.ValueType_TIMESTAMP},
+		{"2023-06-20 18:41:07", header.ValueType_TIMESTAMP},
+		{"Lakers", header.ValueType_STRING},
+		{"1,000", header.ValueType_STRING},
+	}
+	for _, tc := range testCases {
+		if got := header.InferValueType(tc.value); got != tc.want {
+			t.Errorf("InferValueType(%q) = %s, want: %s", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestWiden(t *testing.T) {
+	testCases := []struct {
+		a, b header.ValueType
+		want header.ValueType
+	}{
+		{header.ValueType_RAW, header.ValueType_INT, header.ValueType_INT},
+		{header.ValueType_INT, header.ValueType_RAW, header.ValueType_INT},
+		{header.ValueType_INT, header.ValueType_FLOAT, header.ValueType_FLOAT},
+		{header.ValueType_DATE, header.ValueType_TIMESTAMP, header.ValueType_TIMESTAMP},
+		{header.ValueType_INT, header.ValueType_BOOL, header.ValueType_STRING},
+		{header.ValueType_DATE, header.ValueType_INT, header.ValueType_STRING},
+		{header.ValueType_STRING, header.ValueType_INT, header.ValueType_STRING},
+	}
+	for _, tc := range testCases {
+		if got := tc.a.Widen(tc.b); got != tc.want {
+			t.Errorf("%s.Widen(%s) = %s, want: %s", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, err := header.ValueType_DATE.Parse("2023/06/20")
+	if err != nil {
+		t.Fatalf("got unexpected error for Parse(): %v", err)
+	}
+	if want := time.Date(2023, 6, 20, 0, 0, 0, 0, time.UTC); !v.(time.Time).Equal(want) {
+		t.Errorf("got: %v, want: %v", v, want)
+	}
+	if _, err := header.ValueType_INT.Parse("4.5"); err == nil {
+		t.Errorf("got nil error for INT.Parse(4.5), want error")
+	}
+}
+
+func TestParseValueType(t *testing.T) {
+	if got, err := header.ParseValueType("timestamp"); err != nil || got != header.ValueType_TIMESTAMP {
+		t.Errorf("ParseValueType(timestamp) = %s, %v, want: TIMESTAMP, nil", got, err)
+	}
+	if _, err := header.ParseValueType("DECIMAL"); err == nil {
+		t.Errorf("got nil error for ParseValueType(DECIMAL), want error")
+	}
+}
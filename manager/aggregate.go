@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+// Aggregate groups the rows of a dataset that match req.Where by the values
+// of req.GroupBy, and computes req.Aggregations over each group. Groups are
+// ordered by their values.
+func (m *Manager) Aggregate(req *AggregateRequest) (int, *AggregateResponse) {
+	ds, err := m.dataset(req.DatasetId)
+	if err != nil {
+		log.Printf("Query for Dataset failed with error: %v", err)
+		return http.StatusInternalServerError, &AggregateResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if ds == nil {
+		return http.StatusNotFound, &AggregateResponse{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("failed to find dataset with id: %d", req.DatasetId),
+		}
+	}
+
+	headers, err := header.GetHeaders(m.eng, req.DatasetId)
+	if err != nil {
+		log.Printf("failed to get headers with err: %v", err)
+		return http.StatusInternalServerError, &AggregateResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	q, args, err := aggregateQuery(req, query.HeaderResolver(headers))
+	if err != nil {
+		return http.StatusBadRequest, &AggregateResponse{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	rows, err := m.eng.DatabaseHandle.Query(q, args.Values()...)
+	if err != nil {
+		log.Printf("failed to aggregate dataset(datasetId=%d) with err: %v", req.DatasetId, err)
+		return http.StatusInternalServerError, &AggregateResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	defer rows.Close()
+
+	resp := &AggregateResponse{
+		Code:   http.StatusOK,
+		Values: make([][]any, len(req.GroupBy)+len(req.Aggregations)),
+	}
+	resp.Columns = append(resp.Columns, req.GroupBy...)
+	for _, a := range req.Aggregations {
+		resp.Columns = append(resp.Columns, a.Name())
+	}
+	for i := range resp.Values {
+		resp.Values[i] = make([]any, 0)
+	}
+
+	row := make([]any, len(resp.Columns))
+	dest := make([]any, len(row))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("failed to Scan() aggregate with err: %v", err)
+			return http.StatusInternalServerError, &AggregateResponse{
+				Message: "INTERNAL SERVER ERROR",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+		for i, v := range row {
+			resp.Values[i] = append(resp.Values[i], jsonValue(v))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to read aggregate with err: %v", err)
+		return http.StatusInternalServerError, &AggregateResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return http.StatusOK, resp
+}
+
+// aggregateQuery returns the SQL of req. The value of each column is selected
+// once per record in a subquery, which is then grouped.
+func aggregateQuery(req *AggregateRequest, resolve query.Resolver) (string, *query.Args, error) {
+	args := query.NewArgs(req.DatasetId)
+	selects := []string{"rp.RecordId"}
+	column := func(h *header.Header) string {
+		alias := fmt.Sprintf("v%d", len(selects))
+		selects = append(selects, fmt.Sprintf("%s AS %s", query.Column(h, "rp.RecordId", args), alias))
+		return "t." + alias
+	}
+
+	var groups []string
+	for _, g := range req.GroupBy {
+		h, err := resolve(g)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid groupBy: %v", err)
+		}
+		groups = append(groups, column(h))
+	}
+	var aggs []string
+	for _, a := range req.Aggregations {
+		s, err := a.SQL(resolve, column, args)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid aggregation: %v", err)
+		}
+		aggs = append(aggs, s)
+	}
+
+	where := "rp.DatasetId = $1"
+	if req.Where != nil {
+		f, err := query.SQL(req.Where, "rp.RecordId", resolve, args)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid filter: %v", err)
+		}
+		where += " AND " + f
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM (SELECT %s FROM RecordsProcessed rp WHERE %s) t", strings.Join(append(groups, aggs...), ", "), strings.Join(selects, ", "), where)
+	if len(groups) > 0 {
+		order := make([]string, len(groups))
+		for i, g := range groups {
+			order[i] = g + " NULLS LAST"
+		}
+		q += fmt.Sprintf(" GROUP BY %s ORDER BY %s", strings.Join(groups, ", "), strings.Join(order, ", "))
+	}
+	q += fmt.Sprintf(" LIMIT %s", args.Add(req.Limit))
+	return q, args, nil
+}
+
+// jsonValue converts a value scanned from Postgres to one that marshals as
+// JSON. NUMERICs are scanned as bytes, and are returned as float64.
+func jsonValue(v any) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+		return f
+	}
+	return string(b)
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+func TestAggregateQuery(t *testing.T) {
+	resolve := query.HeaderResolver([]*header.Header{
+		{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+		{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+	})
+	req := &AggregateRequest{
+		DatasetId: 3,
+		GroupBy:   []string{"CITY"},
+		Aggregations: []*query.Aggregation{
+			{Op: query.AggOp_COUNT},
+			{Op: query.AggOp_SUM, Column: "ARENACAPACITY"},
+		},
+		Filter: `ARENACAPACITY gt 18000`,
+	}
+	if err := req.parse(); err != nil {
+		t.Fatalf("got unexpected error for parse(): %v", err)
+	}
+
+	q, args, err := aggregateQuery(req, resolve)
+	if err != nil {
+		t.Fatalf("got unexpected error for aggregateQuery(): %v", err)
+	}
+	want := "SELECT t.v1, COUNT(*), SUM(t.v2) FROM (" +
+		"SELECT rp.RecordId, " +
+		"(SELECT c.RawValue FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $2) AS v1, " +
+		"(SELECT c.NumericValue FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $3) AS v2 " +
+		"FROM RecordsProcessed rp WHERE rp.DatasetId = $1 AND " +
+		"EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $4 AND c.NumericValue > $5)) t " +
+		"GROUP BY t.v1 ORDER BY t.v1 NULLS LAST LIMIT $6"
+	if q != want {
+		t.Errorf("aggregateQuery() = %s, want: %s", q, want)
+	}
+	wantArgs := []any{int64(3), int64(8), int64(10), int64(10), float64(18000), int64(defaultAggregateLimit)}
+	if !reflect.DeepEqual(args.Values(), wantArgs) {
+		t.Errorf("aggregateQuery() args = %v, want: %v", args.Values(), wantArgs)
+	}
+
+	// Unknown columns are rejected
+	req.GroupBy = []string{"TEAM"}
+	if _, _, err := aggregateQuery(req, resolve); err == nil {
+		t.Errorf("aggregateQuery() expected error for unknown column, got nil")
+	}
+}
+
+func TestJsonValue(t *testing.T) {
+	testCases := []struct {
+		v    any
+		want any
+	}{
+		{[]byte("18624.5"), 18624.5},
+		{[]byte("Boston"), "Boston"},
+		{int64(3), int64(3)},
+		{nil, nil},
+	}
+	for _, tc := range testCases {
+		if got := jsonValue(tc.v); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("jsonValue(%v) = %v, want: %v", tc.v, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxCompressionDepth is the most times an upload is decompressed, e.g. a
+// gzipped file in a zip archive is decompressed twice.
+const maxCompressionDepth = 3
+
+// compression is how an upload is compressed.
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionZstd
+	compressionZip
+)
+
+func (c compression) String() string {
+	switch c {
+	case compressionGzip:
+		return "gzip"
+	case compressionZstd:
+		return "zstd"
+	case compressionZip:
+		return "zip"
+	}
+	return "none"
+}
+
+// Magic bytes starting compressed files.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// detectCompression returns the compression of a file starting with
+// sample. Workbooks are zip archives too, but are read as they are.
+func detectCompression(sample []byte) compression {
+	switch {
+	case bytes.HasPrefix(sample, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(sample, zstdMagic):
+		return compressionZstd
+	case bytes.HasPrefix(sample, zipMagic) && !isXLSX(sample):
+		return compressionZip
+	}
+	return compressionNone
+}
+
+// decompress returns a reader of the upload read by br, decompressed. A zip
+// archive is read from file, an upload of size bytes, or from a temporary
+// copy if file is nil; its file named member is decompressed, or its only
+// file if member is empty. The caller must call done.
+func decompress(c compression, br *bufio.Reader, file io.ReaderAt, size int64, member string) (rd io.Reader, done func(), err error) {
+	switch c {
+	case compressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip file: %v", err)
+		}
+		return zr, func() { zr.Close() }, nil
+	case compressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zstd file: %v", err)
+		}
+		return zr, zr.Close, nil
+	case compressionZip:
+		ra, n, cleanup, err := readerAt(file, size, br)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := zipMember(ra, n, member)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to open %q in zip archive with err: %v", f.Name, err)
+		}
+		return rc, func() {
+			rc.Close()
+			cleanup()
+		}, nil
+	}
+	return br, func() {}, nil
+}
+
+// zipFiles returns the files of a zip archive, leaving out directories and
+// hidden files such as macOS's __MACOSX/ and .DS_Store.
+func zipFiles(zr *zip.Reader) []*zip.File {
+	var files []*zip.File
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// zipMember returns the file named name in the zip archive ra of size bytes,
+// or its only file if name is empty.
+func zipMember(ra io.ReaderAt, size int64, name string) (*zip.File, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %v", err)
+	}
+	files := zipFiles(zr)
+	if name != "" {
+		for _, f := range files {
+			if f.Name == name {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to find %q in zip archive", name)
+	}
+	switch len(files) {
+	case 0:
+		return nil, fmt.Errorf("zip archive has no files")
+	case 1:
+		return files[0], nil
+	}
+	return nil, fmt.Errorf("zip archive has %d files, upload them separately", len(files))
+}
+
+// zipMembers returns the names of the files in req.InputFile, if it is a zip
+// archive that can be read at an offset. Otherwise it returns nil.
+func zipMembers(req *UploadDatasetRequest) ([]string, error) {
+	ra, ok := req.InputFile.(io.ReaderAt)
+	if !ok || req.InputSize <= 0 {
+		return nil, nil
+	}
+	sample := make([]byte, detectSampleSize)
+	n, err := ra.ReadAt(sample, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read upload with err: %v", err)
+	}
+	if detectCompression(sample[:n]) != compressionZip {
+		return nil, nil
+	}
+
+	zr, err := zip.NewReader(ra, req.InputSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %v", err)
+	}
+	var names []string
+	for _, f := range zipFiles(zr) {
+		names = append(names, f.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("zip archive has no files")
+	}
+	return names, nil
+}
@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+)
+
+const testCSV = "team,wins\nCeltics,64\nKnicks,50\n"
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := io.WriteString(zw, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func zstded(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw, err := zstd.NewWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(zw, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// zipped returns a zip archive of files, in order. Names ending in / are
+// directories.
+func zipped(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestDetectCompression(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		sample []byte
+		want   compression
+	}{
+		{"csv", []byte(testCSV), compressionNone},
+		{"gzip", gzipped(t, testCSV), compressionGzip},
+		{"zstd", zstded(t, testCSV), compressionZstd},
+		{"zip", zipped(t, [2]string{"teams.csv", testCSV}), compressionZip},
+		{"xlsx", testWorkbook(t), compressionNone},
+		{"empty", nil, compressionNone},
+	}
+	for _, tc := range testCases {
+		if got := detectCompression(tc.sample); got != tc.want {
+			t.Errorf("detectCompression(%s) = %v, want: %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	archive := zipped(t,
+		[2]string{"data/", ""},
+		[2]string{"data/teams.csv", testCSV},
+		[2]string{"__MACOSX/data/._teams.csv", "junk"},
+		[2]string{"data/.DS_Store", "junk"},
+	)
+	multi := zipped(t, [2]string{"a.csv", "a\n1\n"}, [2]string{"b.csv", testCSV})
+	testCases := []struct {
+		desc    string
+		input   []byte
+		seek    bool
+		member  string
+		want    string
+		wantErr bool
+	}{
+		{desc: "gzip", input: gzipped(t, testCSV), want: testCSV},
+		{desc: "zstd", input: zstded(t, testCSV), want: testCSV},
+		{desc: "zip", input: archive, seek: true, want: testCSV},
+		{desc: "zip_spooled", input: archive, want: testCSV},
+		{desc: "zip_member", input: multi, seek: true, member: "b.csv", want: testCSV},
+		{desc: "zip_many", input: multi, seek: true, wantErr: true},
+		{desc: "zip_unknown_member", input: multi, seek: true, member: "c.csv", wantErr: true},
+		{desc: "zip_empty", input: zipped(t, [2]string{"data/", ""}), seek: true, wantErr: true},
+		{desc: "gzip_truncated", input: gzipped(t, testCSV)[:5], wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(tc.input))
+			var file io.ReaderAt
+			if tc.seek {
+				file = bytes.NewReader(tc.input)
+			}
+			c := detectCompression(tc.input)
+			rd, done, err := decompress(c, br, file, int64(len(tc.input)), tc.member)
+			var got []byte
+			if err == nil {
+				defer done()
+				got, err = io.ReadAll(rd)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("decompress(%v) got err: %v, wantErr: %v", c, err, tc.wantErr)
+			}
+			if err == nil && string(got) != tc.want {
+				t.Errorf("decompress(%v) = %q, want: %q", c, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestZipMembers(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		input   io.Reader
+		want    []string
+		wantErr bool
+	}{
+		{
+			desc:  "many",
+			input: bytes.NewReader(zipped(t, [2]string{"2023.csv", testCSV}, [2]string{"__MACOSX/._2023.csv", ""}, [2]string{"2024/2024.csv", testCSV})),
+			want:  []string{"2023.csv", "2024/2024.csv"},
+		},
+		{
+			desc:  "csv",
+			input: bytes.NewReader([]byte(testCSV)),
+		},
+		{
+			desc:  "not_seekable",
+			input: bytes.NewBuffer(zipped(t, [2]string{"2023.csv", testCSV})),
+		},
+		{
+			desc:    "empty",
+			input:   bytes.NewReader(zipped(t, [2]string{"2023/", ""})),
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			size := int64(0)
+			if r, ok := tc.input.(*bytes.Reader); ok {
+				size = r.Size()
+			}
+			got, err := zipMembers(&UploadDatasetRequest{InputFile: tc.input, InputSize: size})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("zipMembers() got err: %v, wantErr: %v", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
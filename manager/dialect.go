@@ -0,0 +1,354 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Quoting controls how quotes in a delimited file are read.
+type Quoting string
+
+const (
+	// Quoting_LAZY allows quotes inside unquoted fields, and bare quotes
+	// inside quoted fields.
+	Quoting_LAZY Quoting = "lazy"
+	// Quoting_STRICT fails the upload on malformed quotes (RFC 4180).
+	Quoting_STRICT Quoting = "strict"
+	// Quoting_NONE reads quotes as ordinary characters. Fields can't
+	// contain the delimiter or a newline.
+	Quoting_NONE Quoting = "none"
+)
+
+// Encoding is the character encoding of an uploaded file.
+type Encoding string
+
+const (
+	Encoding_UTF8 Encoding = "utf-8"
+	// Encoding_UTF16 reads the byte order from the BOM, and defaults to
+	// little endian.
+	Encoding_UTF16       Encoding = "utf-16"
+	Encoding_UTF16LE     Encoding = "utf-16le"
+	Encoding_UTF16BE     Encoding = "utf-16be"
+	Encoding_LATIN1      Encoding = "latin-1"
+	Encoding_WINDOWS1252 Encoding = "windows-1252"
+)
+
+// encodingAliases maps other common names to an Encoding.
+var encodingAliases = map[string]Encoding{
+	"utf8":       Encoding_UTF8,
+	"utf16":      Encoding_UTF16,
+	"latin1":     Encoding_LATIN1,
+	"iso-8859-1": Encoding_LATIN1,
+	"cp1252":     Encoding_WINDOWS1252,
+}
+
+// detectDelimiters are tried, in order of preference, when the delimiter
+// isn't set.
+var detectDelimiters = []rune{',', '\t', ';', '|'}
+
+// Detection Limits
+const (
+	detectSampleSize = 64 * 1024
+	detectMaxLines   = 20
+)
+
+// Dialect describes how a delimited text file is laid out.
+type Dialect struct {
+	// Delimiter between fields. If 0, it is detected from the file.
+	Delimiter rune `json:"delimiter"`
+
+	// Quoting of fields. Defaults to Quoting_LAZY.
+	Quoting Quoting `json:"quoting"`
+
+	// Comment starts a line that is skipped. If 0, no lines are skipped.
+	Comment rune `json:"comment"`
+
+	// TrimSpace removes leading and trailing white space from each field.
+	TrimSpace bool `json:"trimSpace"`
+
+	// StripBOM removes a byte order mark from the start of the file.
+	StripBOM bool `json:"stripBOM"`
+
+	// Encoding of the file. Defaults to Encoding_UTF8.
+	Encoding Encoding `json:"encoding"`
+}
+
+// DefaultDialect is lazily quoted, BOM stripped UTF-8 with a detected delimiter.
+func DefaultDialect() Dialect {
+	return Dialect{
+		Quoting:  Quoting_LAZY,
+		StripBOM: true,
+		Encoding: Encoding_UTF8,
+	}
+}
+
+// parseDialect builds a Dialect from the upload options returned by get.
+func parseDialect(get func(string) string) (Dialect, error) {
+	d := DefaultDialect()
+
+	switch v := get("delimiter"); strings.ToLower(v) {
+	case "", "auto":
+	case "tab", `\t`:
+		d.Delimiter = '\t'
+	default:
+		r, err := parseRune(v)
+		if err != nil || !validDelim(r) {
+			return d, fmt.Errorf("invalid delimiter: %q", v)
+		}
+		d.Delimiter = r
+	}
+
+	switch q := Quoting(strings.ToLower(get("quoting"))); q {
+	case "":
+	case Quoting_LAZY, Quoting_STRICT, Quoting_NONE:
+		d.Quoting = q
+	default:
+		return d, fmt.Errorf("invalid quoting: %q", q)
+	}
+
+	if v := get("comment"); v != "" {
+		r, err := parseRune(v)
+		if err != nil || !validDelim(r) || r == d.Delimiter {
+			return d, fmt.Errorf("invalid comment: %q", v)
+		}
+		d.Comment = r
+	}
+
+	if v := get("trim"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return d, fmt.Errorf("invalid trim: %v", err)
+		}
+		d.TrimSpace = b
+	}
+
+	if v := get("stripBOM"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return d, fmt.Errorf("invalid stripBOM: %v", err)
+		}
+		d.StripBOM = b
+	}
+
+	if v := strings.ToLower(get("encoding")); v != "" {
+		e := Encoding(v)
+		if a, ok := encodingAliases[v]; ok {
+			e = a
+		}
+		if _, err := e.decoder(); err != nil {
+			return d, err
+		}
+		d.Encoding = e
+	}
+	return d, nil
+}
+
+// parseRune returns the only rune in s.
+func parseRune(s string) (rune, error) {
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || n != len(s) {
+		return 0, fmt.Errorf("want a single character, got: %q", s)
+	}
+	return r, nil
+}
+
+// validDelim reports whether r can separate fields.
+func validDelim(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+func (e Encoding) decoder() (*encoding.Decoder, error) {
+	switch e {
+	case "", Encoding_UTF8:
+		return nil, nil
+	case Encoding_UTF16:
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder(), nil
+	case Encoding_UTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder(), nil
+	case Encoding_UTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder(), nil
+	case Encoding_LATIN1:
+		return charmap.ISO8859_1.NewDecoder(), nil
+	case Encoding_WINDOWS1252:
+		return charmap.Windows1252.NewDecoder(), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %q", e)
+}
+
+// decode returns rd as UTF-8.
+func (d Dialect) decode(rd io.Reader) io.Reader {
+	// Encoding is validated when the Dialect is parsed
+	if dec, _ := d.Encoding.decoder(); dec != nil {
+		rd = transform.NewReader(rd, dec)
+	}
+	if d.StripBOM {
+		rd = transform.NewReader(rd, unicode.UTF8BOM.NewDecoder())
+	}
+	return rd
+}
+
+// rowReader reads the rows of a file one at a time. The returned slice may
+// be reused by the next call to Read.
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// newReader returns a rowReader over rd. Rows may have any number of fields.
+func (d Dialect) newReader(rd io.Reader) rowReader {
+	rd = d.decode(rd)
+	delim := d.Delimiter
+	if delim == 0 {
+		delim = ','
+	}
+
+	var rr rowReader
+	if d.Quoting == Quoting_NONE {
+		sc := bufio.NewScanner(rd)
+		sc.Buffer(nil, 64*1024*1024)
+		rr = &splitReader{sc: sc, delim: string(delim), comment: d.Comment}
+	} else {
+		r := csv.NewReader(rd)
+		r.Comma = delim
+		r.Comment = d.Comment
+		r.LazyQuotes = d.Quoting != Quoting_STRICT
+		r.FieldsPerRecord = -1
+		r.ReuseRecord = true
+		rr = r
+	}
+
+	if d.TrimSpace {
+		rr = &trimReader{r: rr}
+	}
+	return rr
+}
+
+// detect sets the Delimiter from a sample of rd, if it isn't set already.
+func (d *Dialect) detect(rd io.Reader) error {
+	if d.Delimiter != 0 {
+		return nil
+	}
+	sample := make([]byte, detectSampleSize)
+	n, err := io.ReadFull(d.decode(rd), sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	d.Delimiter = detectDelimiter(sample[:n], n == detectSampleSize, d.Quoting != Quoting_NONE, d.Comment)
+	return nil
+}
+
+// detectDelimiter picks the delimiter that splits the lines of sample into
+// the same number of fields, preferring more fields. If truncated, the last
+// line of sample is ignored. Falls back to a comma.
+func detectDelimiter(sample []byte, truncated bool, quoted bool, comment rune) rune {
+	lines := bytes.Split(sample, []byte("\n"))
+	if truncated && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+
+	var rows [][]byte
+	for _, l := range lines {
+		l = bytes.TrimRight(l, "\r")
+		if len(l) == 0 || (comment != 0 && bytes.HasPrefix(l, []byte(string(comment)))) {
+			continue
+		}
+		rows = append(rows, l)
+		if len(rows) == detectMaxLines {
+			break
+		}
+	}
+
+	best, bestFields, bestConsistent := ',', 1, false
+	for _, delim := range detectDelimiters {
+		// fields is the fewest fields on any line
+		fields, counts := 0, make(map[int]bool)
+		for _, l := range rows {
+			n := countFields(l, delim, quoted)
+			counts[n] = true
+			if fields == 0 || n < fields {
+				fields = n
+			}
+		}
+		consistent := len(counts) == 1
+		if fields <= 1 {
+			continue
+		}
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && fields > bestFields) {
+			best, bestFields, bestConsistent = delim, fields, consistent
+		}
+	}
+	return best
+}
+
+// countFields counts the fields in line, ignoring delimiters inside quotes.
+func countFields(line []byte, delim rune, quoted bool) int {
+	n, inQuotes := 1, false
+	for _, r := range string(line) {
+		switch {
+		case quoted && r == '"':
+			inQuotes = !inQuotes
+		case r == delim && !inQuotes:
+			n++
+		}
+	}
+	return n
+}
+
+// splitReader reads rows without quoting, one per line.
+type splitReader struct {
+	sc      *bufio.Scanner
+	delim   string
+	comment rune
+}
+
+func (sr *splitReader) Read() ([]string, error) {
+	for sr.sc.Scan() {
+		line := strings.TrimSuffix(sr.sc.Text(), "\r")
+		if line == "" || (sr.comment != 0 && strings.HasPrefix(line, string(sr.comment))) {
+			continue
+		}
+		return strings.Split(line, sr.delim), nil
+	}
+	if err := sr.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// trimReader trims white space from each field.
+type trimReader struct {
+	r rowReader
+}
+
+func (tr *trimReader) Read() ([]string, error) {
+	row, err := tr.r.Read()
+	for i := range row {
+		row[i] = strings.TrimSpace(row[i])
+	}
+	return row, err
+}
+
+// skipReader skips the first n rows.
+type skipReader struct {
+	r rowReader
+	n int
+}
+
+func (sr *skipReader) Read() ([]string, error) {
+	for ; sr.n > 0; sr.n-- {
+		if _, err := sr.r.Read(); err != nil {
+			return nil, err
+		}
+	}
+	return sr.r.Read()
+}
@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func readAll(t *testing.T, rr rowReader) [][]string {
+	t.Helper()
+	var rows [][]string
+	for {
+		row, err := rr.Read()
+		if err == io.EOF {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("got unexpected error for Read(): %v", err)
+		}
+		rows = append(rows, append([]string{}, row...))
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		form    map[string]string
+		want    Dialect
+		wantErr bool
+	}{
+		{
+			desc: "default",
+			form: map[string]string{},
+			want: DefaultDialect(),
+		},
+		{
+			desc: "tab",
+			form: map[string]string{"delimiter": "tab", "quoting": "NONE", "comment": "#", "trim": "true", "encoding": "Latin1"},
+			want: Dialect{Delimiter: '\t', Quoting: Quoting_NONE, Comment: '#', TrimSpace: true, StripBOM: true, Encoding: Encoding_LATIN1},
+		},
+		{
+			desc:    "long_delimiter",
+			form:    map[string]string{"delimiter": "||"},
+			wantErr: true,
+		},
+		{
+			desc:    "quote_delimiter",
+			form:    map[string]string{"delimiter": `"`},
+			wantErr: true,
+		},
+		{
+			desc:    "comment_is_delimiter",
+			form:    map[string]string{"delimiter": ";", "comment": ";"},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown_encoding",
+			form:    map[string]string{"encoding": "ebcdic"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseDialect(func(k string) string { return tc.form[k] })
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("got nil error, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		sample string
+		want   rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"tab", "a\tb\tc\n1\t2\t3\n", '\t'},
+		{"semicolon_decimal_comma", "a;b;c\n1,5;2,5;3,5\n", ';'},
+		{"pipe", "a|b\n1|2\n", '|'},
+		{"quoted_delimiter", "a;b\n\"x;y;z\";2\n", ';'},
+		{"single_column", "a\n1\n", ','},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := detectDelimiter([]byte(tc.sample), false, true, 0); got != tc.want {
+				t.Errorf("got delimiter: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		dialect Dialect
+		input   []byte
+		want    [][]string
+	}{
+		{
+			desc:    "bom_ragged",
+			dialect: DefaultDialect(),
+			input:   []byte("\xef\xbb\xbfa,b\n1,2,3\n"),
+			want:    [][]string{{"a", "b"}, {"1", "2", "3"}},
+		},
+		{
+			desc:    "comment_trim",
+			dialect: Dialect{Delimiter: ';', Quoting: Quoting_LAZY, Comment: '#', TrimSpace: true},
+			input:   []byte("# exported\n a ; b \n"),
+			want:    [][]string{{"a", "b"}},
+		},
+		{
+			desc:    "no_quoting",
+			dialect: Dialect{Delimiter: '|', Quoting: Quoting_NONE},
+			input:   []byte("a|\"b\r\n\n1|2\n"),
+			want:    [][]string{{"a", "\"b"}, {"1", "2"}},
+		},
+		{
+			desc:    "latin1",
+			dialect: Dialect{Encoding: Encoding_LATIN1},
+			input:   []byte("caf\xe9,na\xefve\n"),
+			want:    [][]string{{"café", "naïve"}},
+		},
+		{
+			desc:    "utf16_bom",
+			dialect: Dialect{Encoding: Encoding_UTF16, StripBOM: true},
+			input:   []byte("\xfe\xff\x00a\x00,\x00b\x00\n"),
+			want:    [][]string{{"a", "b"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := readAll(t, tc.dialect.newReader(bytes.NewReader(tc.input)))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestSkipReader(t *testing.T) {
+	testCases := []struct {
+		skip int
+		want [][]string
+	}{
+		{0, [][]string{{"Exported 2024"}, {"a", "b"}, {"1", "2"}}},
+		{1, [][]string{{"a", "b"}, {"1", "2"}}},
+		{5, nil},
+	}
+	for _, tc := range testCases {
+		rr := DefaultDialect().newReader(bytes.NewReader([]byte("Exported 2024\na,b\n1,2\n")))
+		got := readAll(t, &skipReader{r: rr, n: tc.skip})
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("skip %d got diff (-want +got): %s", tc.skip, diff)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	d := Dialect{Encoding: Encoding_UTF16LE, StripBOM: true}
+	if err := d.detect(strings.NewReader("a\x00\t\x00b\x00\n\x00")); err != nil {
+		t.Fatalf("got unexpected error for detect(): %v", err)
+	}
+	if d.Delimiter != '\t' {
+		t.Errorf("got delimiter: %q, want: '\\t'", d.Delimiter)
+	}
+}
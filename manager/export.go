@@ -0,0 +1,407 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+// ExportFormat is the file format data is exported as.
+type ExportFormat string
+
+const (
+	ExportFormat_CSV     ExportFormat = "csv"
+	ExportFormat_NDJSON  ExportFormat = "ndjson"
+	ExportFormat_JSON    ExportFormat = "json"
+	ExportFormat_PARQUET ExportFormat = "parquet"
+	ExportFormat_XLSX    ExportFormat = "xlsx"
+)
+
+// ParseExportFormat returns the ExportFormat matching s, ignoring case.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	f := ExportFormat(strings.ToLower(strings.TrimSpace(s)))
+	switch f {
+	case ExportFormat_CSV, ExportFormat_NDJSON, ExportFormat_JSON, ExportFormat_PARQUET, ExportFormat_XLSX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %q", s)
+}
+
+// ContentType of files in format f.
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportFormat_CSV:
+		return "text/csv; charset=utf-8"
+	case ExportFormat_NDJSON:
+		return "application/x-ndjson"
+	case ExportFormat_JSON:
+		return "application/json; charset=utf-8"
+	case ExportFormat_PARQUET:
+		return "application/vnd.apache.parquet"
+	case ExportFormat_XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// rowWriter writes rows of data in an ExportFormat.
+type rowWriter interface {
+	// Write writes a row, with a value for each of the headers.
+	Write(row []string) error
+
+	// Close finishes the file. It does not close the underlying writer.
+	Close() error
+
+	// Abort releases the resources of a file that won't be finished.
+	Abort()
+}
+
+// newRowWriter returns a rowWriter of format f that writes to w. headers are
+// the columns of each row.
+func newRowWriter(f ExportFormat, w io.Writer, headers []*header.Header) (rowWriter, error) {
+	switch f {
+	case ExportFormat_CSV:
+		return newCSVWriter(w, headers)
+	case ExportFormat_NDJSON:
+		return newJSONWriter(w, headers, false), nil
+	case ExportFormat_JSON:
+		return newJSONWriter(w, headers, true), nil
+	case ExportFormat_PARQUET:
+		return newParquetWriter(w, headers)
+	case ExportFormat_XLSX:
+		return newXLSXWriter(w, headers)
+	}
+	return nil, fmt.Errorf("unsupported export format: %q", f)
+}
+
+// csvWriter writes rows as CSV, after a header row of display names.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, headers []*header.Header) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		names[i] = h.DisplayName
+	}
+	if err := cw.w.Write(names); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(row []string) error {
+	return cw.w.Write(row)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (*csvWriter) Abort() {}
+
+// jsonWriter writes rows as JSON objects keyed by the headers' names, either
+// one per line or as the elements of a JSON array.
+type jsonWriter struct {
+	w       *bufio.Writer
+	columns []*header.Header
+	keys    [][]byte
+	array   bool
+	n       int
+}
+
+func newJSONWriter(w io.Writer, headers []*header.Header, array bool) *jsonWriter {
+	jw := &jsonWriter{
+		w:       bufio.NewWriter(w),
+		columns: headers,
+		keys:    make([][]byte, len(headers)),
+		array:   array,
+	}
+	for i, name := range columnNames(headers) {
+		// Marshalling a string can't fail.
+		jw.keys[i], _ = json.Marshal(name)
+	}
+	return jw
+}
+
+func (jw *jsonWriter) Write(row []string) error {
+	switch {
+	case !jw.array:
+	case jw.n == 0:
+		jw.w.WriteString("[\n")
+	default:
+		jw.w.WriteString(",\n")
+	}
+	jw.n++
+
+	jw.w.WriteByte('{')
+	for i, h := range jw.columns {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		v, err := json.Marshal(exportJSONValue(h, row[i]))
+		if err != nil {
+			return err
+		}
+		jw.w.Write(jw.keys[i])
+		jw.w.WriteByte(':')
+		jw.w.Write(v)
+	}
+	if _, err := jw.w.WriteString("}\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	if jw.array {
+		if jw.n == 0 {
+			jw.w.WriteString("[")
+		}
+		jw.w.WriteString("]\n")
+	}
+	return jw.w.Flush()
+}
+
+func (*jsonWriter) Abort() {}
+
+// exportJSONValue returns v, a value of column h, as it is written to JSON: null if
+// blank, a number or boolean if it parses as h's numeric or BOOL ValueType,
+// and a string otherwise.
+func exportJSONValue(h *header.Header, v string) any {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	switch h.ValueType {
+	case header.ValueType_INT, header.ValueType_BOOL:
+		if p, err := h.ValueType.Parse(v); err == nil {
+			return p
+		}
+	case header.ValueType_FLOAT:
+		// JSON has no NaN or Infinity
+		if p, err := h.ValueType.Parse(v); err == nil && !math.IsNaN(p.(float64)) && !math.IsInf(p.(float64), 0) {
+			return p
+		}
+	}
+	return v
+}
+
+// columnNames returns the names headers are exported as in formats that key
+// values by name. These are their display names, made unique and non-blank.
+func columnNames(headers []*header.Header) []string {
+	names := make([]string, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for i, h := range headers {
+		name := strings.TrimSpace(h.DisplayName)
+		if name == "" {
+			name = fmt.Sprintf("header_%d", h.HeaderId)
+		}
+		for base, n := name, 2; seen[name]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// Export returns the rows of a dataset that match req.Where, with the values
+// of req.Headers, as a file in req.Format. The rows are streamed from the
+// database by ExportResponse.Write as it is called, so exports of any size
+// use little memory.
+func (m *Manager) Export(req *ExportRequest) (int, *ExportResponse) {
+	ds, err := m.dataset(req.DatasetId)
+	if err != nil {
+		log.Printf("Query for Dataset failed with error: %v", err)
+		return http.StatusInternalServerError, &ExportResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if ds == nil {
+		return http.StatusNotFound, &ExportResponse{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("failed to find dataset with id: %d", req.DatasetId),
+		}
+	}
+
+	headers, err := header.GetHeaders(m.eng, req.DatasetId)
+	if err != nil {
+		log.Printf("failed to get headers with err: %v", err)
+		return http.StatusInternalServerError, &ExportResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	q, args, columns, err := exportQuery(req, headers)
+	if err != nil {
+		return http.StatusBadRequest, &ExportResponse{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return http.StatusOK, &ExportResponse{
+		Filename:    exportFilename(ds, req.Format),
+		ContentType: req.Format.ContentType(),
+		Write: func(ctx context.Context, w io.Writer) error {
+			rw, err := newRowWriter(req.Format, w, columns)
+			if err != nil {
+				return err
+			}
+			if err := m.exportRows(ctx, q, args, columns, rw.Write); err != nil {
+				rw.Abort()
+				return err
+			}
+			return rw.Close()
+		},
+		Code: http.StatusOK,
+	}
+}
+
+// exportQuery returns the SQL selecting the cells to export, its args, and
+// the headers exported in column order. Rows of the result are (RecordId,
+// HeaderId, RawValue) ordered by RecordId; records without cells have a NULL
+// HeaderId.
+func exportQuery(req *ExportRequest, headers []*header.Header) (string, *query.Args, []*header.Header, error) {
+	args := query.NewArgs(req.DatasetId)
+	where := "rp.DatasetId = $1"
+	if req.Where != nil {
+		f, err := query.SQL(req.Where, "rp.RecordId", query.HeaderResolver(headers), args)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid filter: %v", err)
+		}
+		where += " AND " + f
+	}
+
+	columns := headers
+	if len(req.Headers) > 0 {
+		byId := make(map[int64]bool, len(headers))
+		for _, h := range headers {
+			byId[h.HeaderId] = true
+		}
+		want := make(map[int64]bool, len(req.Headers))
+		for _, id := range req.Headers {
+			if !byId[id] {
+				return "", nil, nil, fmt.Errorf("failed to find header %d in dataset: %d", id, req.DatasetId)
+			}
+			want[id] = true
+		}
+		columns = make([]*header.Header, 0, len(want))
+		for _, h := range headers {
+			if want[h.HeaderId] {
+				columns = append(columns, h)
+			}
+		}
+	}
+
+	headerIds := make([]int64, len(columns))
+	for i, h := range columns {
+		headerIds[i] = h.HeaderId
+	}
+	q := fmt.Sprintf("SELECT rp.RecordId, c.HeaderId, c.RawValue FROM RecordsProcessed rp LEFT JOIN Cells c ON c.RecordId = rp.RecordId AND c.HeaderId = ANY(%s) WHERE %s ORDER BY rp.RecordId", args.Add(pq.Array(headerIds)), where)
+	return q, args, columns, nil
+}
+
+// exportRows runs q, a query built by exportQuery, and calls write with each
+// record's values for columns. Only one record is held in memory at a time.
+func (m *Manager) exportRows(ctx context.Context, q string, args *query.Args, columns []*header.Header, write func([]string) error) error {
+	colIndex := make(map[int64]int, len(columns))
+	for i, h := range columns {
+		colIndex[h.HeaderId] = i
+	}
+
+	rows, err := m.eng.DatabaseHandle.QueryContext(ctx, q, args.Values()...)
+	if err != nil {
+		return fmt.Errorf("failed to query cells with err: %v", err)
+	}
+	defer rows.Close()
+
+	var (
+		row     []string
+		current int64
+	)
+	for rows.Next() {
+		var recordId int64
+		var headerId sql.NullInt64
+		var rv sql.NullString
+		if err := rows.Scan(&recordId, &headerId, &rv); err != nil {
+			return fmt.Errorf("failed to Scan(RecordId, HeaderId, RawValue) from Cells with err: %v", err)
+		}
+		if row == nil || recordId != current {
+			if row != nil {
+				if err := write(row); err != nil {
+					return err
+				}
+			}
+			row = make([]string, len(columns))
+			current = recordId
+		}
+		if i, ok := colIndex[headerId.Int64]; headerId.Valid && ok {
+			row[i] = rv.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read cells with err: %v", err)
+	}
+	if row != nil {
+		return write(row)
+	}
+	return nil
+}
+
+// exportFilename returns the name of the file ds is exported to in format f.
+func exportFilename(ds *dataset.Dataset, f ExportFormat) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(ds.DisplayName))
+	if name == "" {
+		name = fmt.Sprintf("dataset_%d", ds.DatasetId)
+	}
+	return fmt.Sprintf("%s.%s", name, f)
+}
+
+// ContentDisposition returns the Content-Disposition header for downloading
+// the export as resp.Filename.
+func (resp *ExportResponse) ContentDisposition() string {
+	if cd := mime.FormatMediaType("attachment", map[string]string{"filename": resp.Filename}); cd != "" {
+		return cd
+	}
+	return "attachment"
+}
+
+// Export writes the results of r as a file in format f.
+func (r *DataResponse) Export(f ExportFormat, w io.Writer) error {
+	rw, err := newRowWriter(f, w, r.Headers)
+	if err != nil {
+		return err
+	}
+	for _, rs := range r.Results {
+		if err := rw.Write(rs.Data); err != nil {
+			rw.Abort()
+			return err
+		}
+	}
+	return rw.Close()
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// parquetRowGroupSize is the size in bytes of the rows buffered in memory
+// before they are written as a row group.
+const parquetRowGroupSize = 32 * 1024 * 1024
+
+// parquetWriter writes rows as an Apache Parquet file, with an optional
+// column for each header typed by its ValueType.
+type parquetWriter struct {
+	w       *writer.ParquetWriter
+	columns []*header.Header
+}
+
+func newParquetWriter(w io.Writer, headers []*header.Header) (*parquetWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, parquetSchema(headers), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.MarshalFunc = marshal.MarshalCSV
+	pw.RowGroupSize = parquetRowGroupSize
+	return &parquetWriter{w: pw, columns: headers}, nil
+}
+
+// parquetSchema returns the schema of a parquet file with a column for each
+// of headers.
+func parquetSchema(headers []*header.Header) []*parquet.SchemaElement {
+	numChildren := int32(len(headers))
+	schema := []*parquet.SchemaElement{{
+		Name:        "dataset",
+		NumChildren: &numChildren,
+	}}
+
+	// Columns are keyed by their name as a Go identifier, so those must be
+	// unique too.
+	seen := make(map[string]bool, len(headers))
+	for i, name := range columnNames(headers) {
+		for base, n := name, 2; seen[common.StringToVariableName(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		seen[common.StringToVariableName(name)] = true
+
+		el := &parquet.SchemaElement{
+			Name:           name,
+			RepetitionType: parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL),
+		}
+		switch headers[i].ValueType {
+		case header.ValueType_INT:
+			el.Type = parquet.TypePtr(parquet.Type_INT64)
+		case header.ValueType_FLOAT:
+			el.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+		case header.ValueType_BOOL:
+			el.Type = parquet.TypePtr(parquet.Type_BOOLEAN)
+		case header.ValueType_DATE:
+			el.Type = parquet.TypePtr(parquet.Type_INT32)
+			el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_DATE)
+		case header.ValueType_TIMESTAMP:
+			el.Type = parquet.TypePtr(parquet.Type_INT64)
+			el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MICROS)
+		default:
+			el.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+			el.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+		}
+		schema = append(schema, el)
+	}
+	return schema
+}
+
+func (pw *parquetWriter) Write(row []string) error {
+	values := make([]any, len(pw.columns))
+	for i, h := range pw.columns {
+		values[i] = parquetValue(h.ValueType, row[i])
+	}
+	return pw.w.Write(values)
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.w.WriteStop()
+}
+
+func (*parquetWriter) Abort() {}
+
+// parquetValue returns v as a value of the parquet column for vt, or nil if
+// v is blank or doesn't parse as vt.
+func parquetValue(vt header.ValueType, v string) any {
+	if v == "" {
+		return nil
+	}
+	switch vt {
+	case header.ValueType_RAW, header.ValueType_STRING:
+		return v
+	}
+	p, err := vt.Parse(v)
+	if err != nil {
+		return nil
+	}
+	if t, ok := p.(time.Time); ok {
+		if vt == header.ValueType_DATE {
+			return int32(t.Unix() / (24 * 60 * 60))
+		}
+		return t.UnixMicro()
+	}
+	return p
+}
@@ -0,0 +1,265 @@
+package manager
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+var exportHeaders = []*header.Header{
+	{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+	{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+	{HeaderId: 11, DisplayName: "HEAD COACH", ValueType: header.ValueType_STRING},
+}
+
+func TestExportQuery(t *testing.T) {
+	where, err := query.Parse(`ARENACAPACITY gt 18000`)
+	if err != nil {
+		t.Fatalf("got unexpected error for Parse(): %v", err)
+	}
+	req := &ExportRequest{
+		DatasetId: 3,
+		Format:    ExportFormat_CSV,
+		Headers:   []int64{11, 8},
+		Where:     where,
+	}
+	q, args, columns, err := exportQuery(req, exportHeaders)
+	if err != nil {
+		t.Fatalf("got unexpected error for exportQuery(): %v", err)
+	}
+
+	want := "SELECT rp.RecordId, c.HeaderId, c.RawValue FROM RecordsProcessed rp LEFT JOIN Cells c ON c.RecordId = rp.RecordId AND c.HeaderId = ANY($4) " +
+		"WHERE rp.DatasetId = $1 AND EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $2 AND c.NumericValue > $3) ORDER BY rp.RecordId"
+	if q != want {
+		t.Errorf("exportQuery() = %s, want: %s", q, want)
+	}
+	if n := len(args.Values()); n != 4 {
+		t.Errorf("exportQuery() got %d args, want: 4", n)
+	}
+
+	// Columns stay in dataset order
+	if len(columns) != 2 || columns[0].HeaderId != 8 || columns[1].HeaderId != 11 {
+		t.Errorf("exportQuery() columns = %v, want: [CITY HEAD COACH]", columns)
+	}
+
+	req.Headers = []int64{12}
+	if _, _, _, err := exportQuery(req, exportHeaders); err == nil {
+		t.Errorf("exportQuery() with unknown header expected error, got nil")
+	}
+}
+
+func TestDataResponseExport(t *testing.T) {
+	resp := &DataResponse{
+		Headers: exportHeaders,
+		Results: []*ResultSet{
+			{Data: []string{"Boston", "18624", "Joe Mazzulla"}},
+			{Data: []string{"New York, NY", "", `Tom "Thibs" Thibodeau`}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := resp.Export(ExportFormat_CSV, &buf); err != nil {
+		t.Fatalf("got unexpected error for Export(): %v", err)
+	}
+	want := "CITY,ARENACAPACITY,HEAD COACH\n" +
+		"Boston,18624,Joe Mazzulla\n" +
+		`"New York, NY",,"Tom ""Thibs"" Thibodeau"` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Export() = %q, want: %q", got, want)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	resp := &DataResponse{
+		Headers: exportHeaders,
+		Results: []*ResultSet{
+			{Data: []string{"Boston", "18624", "Joe Mazzulla"}},
+			{Data: []string{"New York, NY", "", `Tom "Thibs" Thibodeau`}},
+			{Data: []string{"Utah", "unknown", "Will Hardy"}},
+		},
+	}
+	testCases := []struct {
+		format  ExportFormat
+		results []*ResultSet
+		want    string
+	}{
+		{
+			format:  ExportFormat_NDJSON,
+			results: resp.Results,
+			want: `{"CITY":"Boston","ARENACAPACITY":18624,"HEAD COACH":"Joe Mazzulla"}` + "\n" +
+				`{"CITY":"New York, NY","ARENACAPACITY":null,"HEAD COACH":"Tom \"Thibs\" Thibodeau"}` + "\n" +
+				`{"CITY":"Utah","ARENACAPACITY":"unknown","HEAD COACH":"Will Hardy"}` + "\n",
+		},
+		{
+			format:  ExportFormat_NDJSON,
+			results: nil,
+			want:    "",
+		},
+		{
+			format:  ExportFormat_JSON,
+			results: resp.Results[:2],
+			want: "[\n" +
+				`{"CITY":"Boston","ARENACAPACITY":18624,"HEAD COACH":"Joe Mazzulla"}` + "\n,\n" +
+				`{"CITY":"New York, NY","ARENACAPACITY":null,"HEAD COACH":"Tom \"Thibs\" Thibodeau"}` + "\n]\n",
+		},
+		{
+			format:  ExportFormat_JSON,
+			results: nil,
+			want:    "[]\n",
+		},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		r := &DataResponse{Headers: exportHeaders, Results: tc.results}
+		if err := r.Export(tc.format, &buf); err != nil {
+			t.Fatalf("got unexpected error for Export(%s): %v", tc.format, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Export(%s) = %q, want: %q", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	headers := []*header.Header{
+		{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+		{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+		{HeaderId: 12, DisplayName: "OPENED", ValueType: header.ValueType_DATE},
+	}
+	resp := &DataResponse{
+		Headers: headers,
+		Results: []*ResultSet{
+			{Data: []string{"Boston", "18624", "1995-09-30"}},
+			{Data: []string{"New York, NY", "unknown", ""}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := resp.Export(ExportFormat_PARQUET, &buf); err != nil {
+		t.Fatalf("got unexpected error for Export(): %v", err)
+	}
+
+	pf, err := buffer.NewBufferFile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("got unexpected error for NewBufferFile(): %v", err)
+	}
+	pr, err := reader.NewParquetColumnReader(pf, 1)
+	if err != nil {
+		t.Fatalf("got unexpected error for NewParquetColumnReader(): %v", err)
+	}
+	defer pr.ReadStop()
+	if n := pr.GetNumRows(); n != 2 {
+		t.Errorf("got %d rows, want: 2", n)
+	}
+
+	// Columns stay in order, and values that don't parse are null
+	want := [][]any{
+		{"Boston", "New York, NY"},
+		{int64(18624), nil},
+		{int32(9403), nil},
+	}
+	for i, h := range headers {
+		if got := pr.SchemaHandler.Infos[i+1].ExName; got != h.DisplayName {
+			t.Errorf("column %d name = %q, want: %q", i, got, h.DisplayName)
+		}
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), 2)
+		if err != nil {
+			t.Fatalf("got unexpected error for ReadColumnByIndex(%d): %v", i, err)
+		}
+		if diff := cmp.Diff(values, want[i]); diff != "" {
+			t.Errorf("column %q diff: %s", h.DisplayName, diff)
+		}
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	resp := &DataResponse{
+		Headers: exportHeaders,
+		Results: []*ResultSet{
+			{Data: []string{"Boston", "18624", "Joe Mazzulla"}},
+			{Data: []string{"New York, NY", "", `Tom "Thibs" Thibodeau`}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := resp.Export(ExportFormat_XLSX, &buf); err != nil {
+		t.Fatalf("got unexpected error for Export(): %v", err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatalf("got unexpected error for OpenReader(): %v", err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows(xlsxSheet)
+	if err != nil {
+		t.Fatalf("got unexpected error for GetRows(): %v", err)
+	}
+	want := [][]string{
+		{"CITY", "ARENACAPACITY", "HEAD COACH"},
+		{"Boston", "18624", "Joe Mazzulla"},
+		{"New York, NY", "", `Tom "Thibs" Thibodeau`},
+	}
+	if diff := cmp.Diff(rows, want); diff != "" {
+		t.Errorf("GetRows() diff: %s", diff)
+	}
+
+	// INT values are numbers, not text
+	for cell, want := range map[string]bool{"A2": true, "B2": false} {
+		typ, err := f.GetCellType(xlsxSheet, cell)
+		if err != nil {
+			t.Fatalf("got unexpected error for GetCellType(%s): %v", cell, err)
+		}
+		if got := typ == excelize.CellTypeInlineString; got != want {
+			t.Errorf("GetCellType(%s) = %v, want text: %t", cell, typ, want)
+		}
+	}
+}
+
+func TestColumnNames(t *testing.T) {
+	headers := []*header.Header{
+		{HeaderId: 1, DisplayName: "TEAM"},
+		{HeaderId: 2, DisplayName: " "},
+		{HeaderId: 3, DisplayName: "TEAM"},
+		{HeaderId: 4, DisplayName: "TEAM_2"},
+	}
+	want := []string{"TEAM", "header_2", "TEAM_2", "TEAM_2_2"}
+	if diff := cmp.Diff(columnNames(headers), want); diff != "" {
+		t.Errorf("columnNames() diff: %s", diff)
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	if got, err := ParseExportFormat(" CSV "); err != nil || got != ExportFormat_CSV {
+		t.Errorf("ParseExportFormat(\" CSV \") = %q, %v, want: %q, nil", got, err, ExportFormat_CSV)
+	}
+	for _, f := range []ExportFormat{ExportFormat_NDJSON, ExportFormat_JSON, ExportFormat_PARQUET, ExportFormat_XLSX} {
+		if got, err := ParseExportFormat(string(f)); err != nil || got != f {
+			t.Errorf("ParseExportFormat(%q) = %q, %v, want: %q, nil", f, got, err, f)
+		}
+	}
+	if _, err := ParseExportFormat("pdf"); err == nil {
+		t.Errorf("ParseExportFormat(\"pdf\") expected error, got nil")
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	testCases := []struct {
+		ds   *dataset.Dataset
+		want string
+	}{
+		{&dataset.Dataset{DatasetId: 1, DisplayName: "teams"}, "teams.csv"},
+		{&dataset.Dataset{DatasetId: 2, DisplayName: "nba/teams"}, "nba_teams.csv"},
+		{&dataset.Dataset{DatasetId: 3, DisplayName: " "}, "dataset_3.csv"},
+	}
+	for _, tc := range testCases {
+		if got := exportFilename(tc.ds, ExportFormat_CSV); got != tc.want {
+			t.Errorf("exportFilename(%q) = %q, want: %q", tc.ds.DisplayName, got, tc.want)
+		}
+	}
+}
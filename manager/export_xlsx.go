@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// Built-in Excel number formats for DATE and TIMESTAMP cells.
+const (
+	xlsxDateFormat      = 14 // m/d/yyyy
+	xlsxTimestampFormat = 22 // m/d/yyyy h:mm
+)
+
+// xlsxSheet is the name of the worksheet rows are written to.
+const xlsxSheet = "Sheet1"
+
+// xlsxWriter writes rows as an XLSX workbook, after a header row of display
+// names. Values are written as numbers, booleans and dates when they parse as
+// their header's ValueType. The workbook is only written to w by Close;
+// until then rows are kept in memory, and spill to a temporary file once the
+// sheet is large.
+type xlsxWriter struct {
+	w       io.Writer
+	f       *excelize.File
+	sw      *excelize.StreamWriter
+	columns []*header.Header
+	styles  map[header.ValueType]int
+	values  []any
+	n       int
+}
+
+func newXLSXWriter(w io.Writer, headers []*header.Header) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	xw := &xlsxWriter{
+		w:       w,
+		f:       f,
+		columns: headers,
+		styles:  make(map[header.ValueType]int),
+		values:  make([]any, len(headers)),
+	}
+	for vt, numFmt := range map[header.ValueType]int{
+		header.ValueType_DATE:      xlsxDateFormat,
+		header.ValueType_TIMESTAMP: xlsxTimestampFormat,
+	} {
+		style, err := f.NewStyle(&excelize.Style{NumFmt: numFmt})
+		if err != nil {
+			xw.Abort()
+			return nil, fmt.Errorf("failed to create XLSX style with err: %v", err)
+		}
+		xw.styles[vt] = style
+	}
+
+	var err error
+	if xw.sw, err = f.NewStreamWriter(xlsxSheet); err != nil {
+		xw.Abort()
+		return nil, fmt.Errorf("failed to create XLSX sheet with err: %v", err)
+	}
+	for i, h := range headers {
+		xw.values[i] = h.DisplayName
+	}
+	if err := xw.writeRow(); err != nil {
+		xw.Abort()
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (xw *xlsxWriter) Write(row []string) error {
+	for i, h := range xw.columns {
+		xw.values[i] = xw.value(h.ValueType, row[i])
+	}
+	return xw.writeRow()
+}
+
+// value returns v as the value of an XLSX cell in a column of type vt.
+func (xw *xlsxWriter) value(vt header.ValueType, v string) any {
+	if v == "" {
+		return nil
+	}
+	switch vt {
+	case header.ValueType_RAW, header.ValueType_STRING:
+		return v
+	}
+	p, err := vt.Parse(v)
+	if err != nil {
+		return v
+	}
+	if style, ok := xw.styles[vt]; ok {
+		return excelize.Cell{StyleID: style, Value: p}
+	}
+	return p
+}
+
+func (xw *xlsxWriter) writeRow() error {
+	if xw.n >= excelize.TotalRows {
+		return fmt.Errorf("too many rows for an XLSX sheet, the maximum is %d", excelize.TotalRows)
+	}
+	xw.n++
+	cell, err := excelize.CoordinatesToCellName(1, xw.n)
+	if err != nil {
+		return err
+	}
+	if err := xw.sw.SetRow(cell, xw.values); err != nil {
+		return fmt.Errorf("failed to write XLSX row with err: %v", err)
+	}
+	return nil
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.Abort()
+	if err := xw.sw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush XLSX sheet with err: %v", err)
+	}
+	return xw.f.Write(xw.w)
+}
+
+func (xw *xlsxWriter) Abort() {
+	if err := xw.f.Close(); err != nil {
+		log.Printf("failed to close XLSX file with err: %v", err)
+	}
+}
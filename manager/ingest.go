@@ -0,0 +1,285 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"sort"
+
+	"github.com/lib/pq"
+
+	"github.com/dantespe/spectacle/cell"
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/db"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/operation"
+)
+
+// ingestBatchSize is the number of rows written per transaction.
+const ingestBatchSize = 1000
+
+// value is a RawValue bound for a Header.
+type value struct {
+	headerId int64
+	raw      string
+}
+
+// cells maps row to the dataset's headers. Columns the dataset doesn't have
+// yet are added to it, and short rows and missing columns are left blank.
+func (cm *columnMap) cells(eng *db.Engine, ds *dataset.Dataset, row []string) ([]value, error) {
+	cells := make([]value, 0, len(cm.headers)+len(cm.missing))
+	for i, v := range row {
+		if i >= len(cm.headers) {
+			if err := cm.add(eng, ds, i); err != nil {
+				return nil, err
+			}
+		}
+		cells = append(cells, value{headerId: cm.headers[i].HeaderId, raw: v})
+	}
+	for i := len(row); i < len(cm.headers); i++ {
+		cells = append(cells, value{headerId: cm.headers[i].HeaderId})
+	}
+	for _, h := range cm.missing {
+		cells = append(cells, value{headerId: h.HeaderId})
+	}
+	return cells, nil
+}
+
+// ingest writes the rows of rr to ds in a single pass. If first is non-nil,
+// it is written before the rows of rr.
+func (m *Manager) ingest(ctx context.Context, rr rowReader, first []string, op *operation.Operation, ds *dataset.Dataset, cm *columnMap, p *progress) error {
+	b := &batch{
+		ctx: ctx,
+		eng: m.eng,
+		op:  op,
+		ds:  ds,
+		cm:  cm,
+		p:   p,
+	}
+	row := first
+	for {
+		if row == nil {
+			var err error
+			row, err = rr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		cells, err := cm.cells(m.eng, ds, row)
+		if err != nil {
+			return err
+		}
+		if err := b.add(cells); err != nil {
+			return err
+		}
+		row = nil
+	}
+	return b.flush()
+}
+
+// batch buffers the rows of an upload. Each batch allocates its RecordIds
+// and copies its Records, Cells and RecordsProcessed in one transaction, so
+// a row is never visible without its cells.
+type batch struct {
+	ctx  context.Context
+	eng  *db.Engine
+	op   *operation.Operation
+	ds   *dataset.Dataset
+	cm   *columnMap
+	p    *progress
+	rows [][]value
+}
+
+func (b *batch) add(row []value) error {
+	b.rows = append(b.rows, row)
+	if len(b.rows) >= ingestBatchSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows.
+func (b *batch) flush() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+
+	tx, err := b.eng.DatabaseHandle.BeginTx(b.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// The headers are only widened if the batch is written
+	types := make([]header.ValueType, len(b.cm.headers))
+	for i, h := range b.cm.headers {
+		types[i] = h.ValueType
+	}
+	rollback := func() {
+		tx.Rollback()
+		for i, h := range b.cm.headers {
+			h.ValueType = types[i]
+		}
+	}
+
+	if err := b.infer(tx); err != nil {
+		rollback()
+		return err
+	}
+	b.p.setPhase(operation.Phase_RECORDS)
+	if err := b.write(tx); err != nil {
+		rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return err
+	}
+
+	b.p.addRows(int64(len(b.rows)))
+	b.rows = b.rows[:0]
+	return nil
+}
+
+// infer widens the ValueType of each column to hold the values of the batch,
+// unless the file's schema declares it. Cells already written are re-parsed
+// when their column is widened. Both happen within tx.
+func (b *batch) infer(tx *sql.Tx) error {
+	types := make(map[int64]header.ValueType)
+	for _, row := range b.rows {
+		for _, c := range row {
+			if b.cm.declared[c.headerId] {
+				continue
+			}
+			vt, ok := types[c.headerId]
+			if !ok {
+				vt = header.ValueType_RAW
+			}
+			types[c.headerId] = vt.Widen(header.InferValueType(c.raw))
+		}
+	}
+
+	for i, h := range b.cm.headers {
+		if b.cm.declared[h.HeaderId] {
+			continue
+		}
+		vt, ok := types[h.HeaderId]
+		if b.cm.typer != nil {
+			// Types declared by the file's schema take precedence
+			if declared := b.cm.typer.columnType(i); declared != header.ValueType_RAW {
+				vt, ok = declared, true
+				b.cm.declared[h.HeaderId] = true
+			}
+		}
+		if !ok || vt == header.ValueType_RAW {
+			continue
+		}
+		old := h.ValueType
+		if err := h.InferTx(b.ctx, tx, vt); err != nil {
+			return err
+		}
+
+		// Cells from earlier uploads were typed as the old ValueType
+		if old != header.ValueType_RAW && old != h.ValueType {
+			if err := cell.RetypeTx(b.ctx, b.eng, tx, h.HeaderId, h.ValueType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *batch) write(tx *sql.Tx) error {
+	ids, err := allocRecordIds(b.ctx, tx, len(b.rows))
+	if err != nil {
+		return err
+	}
+
+	err = copyIn(b.ctx, tx, "records", []string{"recordid", "operationid", "datasetid"}, func(exec func(...any) error) error {
+		for _, id := range ids {
+			if err := exec(id, b.op.OperationId, b.ds.DatasetId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.p.setPhase(operation.Phase_CELLS)
+	types := make(map[int64]header.ValueType, len(b.cm.headers))
+	for _, h := range b.cm.headers {
+		types[h.HeaderId] = h.ValueType
+	}
+	columns := append([]string{"recordid", "headerid", "operationid", "rawvalue"}, cell.TypedColumns...)
+	err = copyIn(b.ctx, tx, "cells", columns, func(exec func(...any) error) error {
+		for i, row := range b.rows {
+			for _, c := range row {
+				args := append([]any{ids[i], c.headerId, b.op.OperationId, c.raw}, cell.Parse(types[c.headerId], c.raw).Args()...)
+				if err := exec(args...); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return copyIn(b.ctx, tx, "recordsprocessed", []string{"recordid", "datasetid"}, func(exec func(...any) error) error {
+		for _, id := range ids {
+			if err := exec(id, b.ds.DatasetId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// allocRecordIds reserves n RecordIds, in increasing order.
+func allocRecordIds(ctx context.Context, tx *sql.Tx, n int) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT nextval(pg_get_serial_sequence('records', 'recordid')) FROM generate_series(1, $1)", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, n)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// copyIn runs a COPY into table within tx. fill calls exec once per row.
+func copyIn(ctx context.Context, tx *sql.Tx, table string, columns []string, fill func(exec func(...any) error) error) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	exec := func(args ...any) error {
+		_, err := stmt.ExecContext(ctx, args...)
+		return err
+	}
+	if err := fill(exec); err != nil {
+		stmt.Close()
+		return err
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
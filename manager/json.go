@@ -0,0 +1,178 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonReader reads the objects of a JSON upload as rows: either a JSON
+// object per line, or a JSON array of objects. Nested objects are flattened
+// into dotted names, e.g. {"team": {"city": "Boston"}} is a "team.city"
+// column. Other values are read as their JSON text, except strings which are
+// unquoted and nulls which are blank.
+//
+// Columns are named as keys first appear. The first row read holds the names
+// of the first object's columns, like the header row of a CSV; columns of
+// later objects are named by columnName.
+type jsonReader struct {
+	br      *bufio.Reader
+	dec     *json.Decoder
+	columns map[string]int
+	names   []string
+
+	// started is true once the first object has been read.
+	started bool
+	// array is true if the objects are the elements of a JSON array.
+	array bool
+	// done is true once the end of the array has been read.
+	done bool
+	// pending is the first object, returned after the header row.
+	pending []string
+	// n is the number of objects read.
+	n int
+}
+
+func newJSONReader(rd io.Reader) *jsonReader {
+	br := bufio.NewReader(rd)
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+	return &jsonReader{
+		br:      br,
+		dec:     dec,
+		columns: make(map[string]int),
+	}
+}
+
+func (jr *jsonReader) Read() ([]string, error) {
+	if !jr.started {
+		jr.started = true
+		if err := jr.start(); err != nil {
+			return nil, err
+		}
+		row, err := jr.next()
+		if err != nil {
+			return nil, err
+		}
+		jr.pending = row
+		return append([]string{}, jr.names...), nil
+	}
+	if row := jr.pending; row != nil {
+		jr.pending = nil
+		return row, nil
+	}
+	return jr.next()
+}
+
+// columnName returns the name of the i-th column.
+func (jr *jsonReader) columnName(i int) string {
+	return jr.names[i]
+}
+
+// start reads the opening bracket of a JSON array, if the objects are in one.
+func (jr *jsonReader) start() error {
+	for {
+		b, err := jr.br.Peek(1)
+		if err != nil {
+			return err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			jr.br.ReadByte()
+			continue
+		case '[':
+			jr.array = true
+			if _, err := jr.dec.Token(); err != nil {
+				return fmt.Errorf("invalid JSON: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// next reads the next object as a row.
+func (jr *jsonReader) next() ([]string, error) {
+	if jr.done {
+		return nil, io.EOF
+	}
+	if jr.array && !jr.dec.More() {
+		if _, err := jr.dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON after object %d: %v", jr.n, err)
+		}
+		jr.done = true
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := jr.dec.Decode(&raw); err == io.EOF && !jr.array {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid JSON after object %d: %v", jr.n, err)
+	}
+	jr.n++
+
+	row := make([]string, len(jr.names))
+	err := flattenJSON(raw, "", func(name, v string) {
+		i, ok := jr.columns[name]
+		if !ok {
+			i = len(jr.names)
+			jr.columns[name] = i
+			jr.names = append(jr.names, name)
+			row = append(row, "")
+		}
+		row[i] = v
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON object %d: %v", jr.n, err)
+	}
+	return row, nil
+}
+
+// flattenJSON calls set with the dotted name and value of each field of
+// the JSON object raw, in order. Fields of nested objects are prefixed by
+// the name of their parent.
+func flattenJSON(raw json.RawMessage, prefix string, set func(name, v string)) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("want an object, got: %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name := prefix + tok.(string)
+
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		switch v[0] {
+		case '{':
+			if err := flattenJSON(v, name+".", set); err != nil {
+				return err
+			}
+		case '"':
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			set(name, s)
+		case 'n':
+			set(name, "")
+		case '[':
+			var b bytes.Buffer
+			if err := json.Compact(&b, v); err != nil {
+				return err
+			}
+			set(name, b.String())
+		default:
+			set(name, string(v))
+		}
+	}
+	return nil
+}
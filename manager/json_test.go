@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSONReader(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		input     string
+		want      [][]string
+		wantNames []string
+	}{
+		{
+			desc: "ndjson",
+			input: `{"team": "Celtics", "wins": 64, "coach": {"name": "Joe Mazzulla", "since": 2022}}` + "\n" +
+				`{"team": "Lakers", "wins": null, "titles": [2020, 2010], "active": true}` + "\n",
+			want: [][]string{
+				{"team", "wins", "coach.name", "coach.since"},
+				{"Celtics", "64", "Joe Mazzulla", "2022"},
+				{"Lakers", "", "", "", "[2020,2010]", "true"},
+			},
+			wantNames: []string{"team", "wins", "coach.name", "coach.since", "titles", "active"},
+		},
+		{
+			desc:  "array",
+			input: " [\n {\"a\": \"x\\\"y\", \"b\": 1.5e3},\n {\"b\": 2, \"a\": \"z\"}\n]\n",
+			want: [][]string{
+				{"a", "b"},
+				{`x"y`, "1.5e3"},
+				{"z", "2"},
+			},
+			wantNames: []string{"a", "b"},
+		},
+		{
+			desc:  "empty_array",
+			input: "[]",
+		},
+		{
+			desc:  "empty",
+			input: "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			jr := newJSONReader(strings.NewReader(tc.input))
+			got := readAll(t, jr)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+			for i, want := range tc.wantNames {
+				if got := jr.columnName(i); got != want {
+					t.Errorf("columnName(%d) = %q, want: %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONReaderErrors(t *testing.T) {
+	for _, input := range []string{
+		`[1, 2]`,
+		`{"a": 1}` + "\n" + `{"a": `,
+		`[{"a": 1}`,
+		`"a"`,
+	} {
+		jr := newJSONReader(strings.NewReader(input))
+		var err error
+		for err == nil {
+			_, err = jr.Read()
+		}
+		if err == io.EOF {
+			t.Errorf("Read(%q) expected error, got EOF", input)
+		}
+	}
+}
+
+func TestDetectUploadFormat(t *testing.T) {
+	testCases := []struct {
+		sample   string
+		encoding Encoding
+		want     UploadFormat
+	}{
+		{"a,b\n1,2\n", Encoding_UTF8, UploadFormat_CSV},
+		{"\xef\xbb\xbf {\"a\": 1}\n", Encoding_UTF8, UploadFormat_NDJSON},
+		{"\n[{\"a\": 1}]", Encoding_UTF8, UploadFormat_JSON},
+		{"", Encoding_UTF8, UploadFormat_CSV},
+		{"\xff\xfe[\x00{\x00\"\x00a\x00", Encoding_UTF16, UploadFormat_JSON},
+		{"\x00{\x00\"\x00a\x00\"", Encoding_UTF16BE, UploadFormat_NDJSON},
+	}
+	for _, tc := range testCases {
+		d := DefaultDialect()
+		d.Encoding = tc.encoding
+		if got := detectUploadFormat([]byte(tc.sample), d); got != tc.want {
+			t.Errorf("detectUploadFormat(%q) = %q, want: %q", tc.sample, got, tc.want)
+		}
+	}
+}
+
+func TestUploadFormatOf(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		want        UploadFormat
+	}{
+		{"application/x-ndjson", UploadFormat_NDJSON},
+		{"application/json; charset=utf-8", UploadFormat_JSON},
+		{"text/csv", UploadFormat_CSV},
+		{"application/octet-stream", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		if got := uploadFormatOf(tc.contentType); got != tc.want {
+			t.Errorf("uploadFormatOf(%q) = %q, want: %q", tc.contentType, got, tc.want)
+		}
+	}
+}
@@ -1,31 +1,79 @@
 package manager
 
 import (
-	"encoding/csv"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/lib/pq"
+
+	"github.com/dantespe/spectacle/cell"
 	"github.com/dantespe/spectacle/dataset"
 	"github.com/dantespe/spectacle/db"
 	"github.com/dantespe/spectacle/header"
 	"github.com/dantespe/spectacle/operation"
+	"github.com/dantespe/spectacle/query"
 )
 
 // Manager stores all useful things for Spectacle.
 type Manager struct {
-	mu  sync.RWMutex
-	del map[int64]*operation.Operation
-	eng *db.Engine
+	mu        sync.RWMutex
+	del       map[int64]*operation.Operation
+	prof      map[int64]*operation.Operation
+	running   map[int64]*task
+	eng       *db.Engine
+	jobs      *queue
+	workers   int
+	queueSize int
+
+	queryTimeout time.Duration
+	maxQueryRows int64
+}
+
+// Option for creating a Manager.
+type Option func(*Manager)
+
+// WithWorkers returns an Option that sets how many background operations run at once.
+func WithWorkers(n int) Option {
+	return func(m *Manager) {
+		m.workers = n
+	}
+}
+
+// WithQueueSize returns an Option that sets how many background operations
+// may wait for a worker before new ones are rejected.
+func WithQueueSize(n int) Option {
+	return func(m *Manager) {
+		m.queueSize = n
+	}
+}
+
+// WithQueryTimeout returns an Option that sets how long a Query may run.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.queryTimeout = d
+	}
+}
+
+// WithMaxQueryRows returns an Option that sets the most rows a Query returns.
+func WithMaxQueryRows(n int64) Option {
+	return func(m *Manager) {
+		m.maxQueryRows = n
+	}
 }
 
 // New creates a new Manager.
-func New() (*Manager, error) {
+func New(opts ...Option) (*Manager, error) {
 	eng, err := db.New(
 		db.WithDatabaseProvider(db.DatabaseProvider_POSTGRES),
 		db.WithEnvironment(db.Environment_DEVELOPMENT),
@@ -33,17 +81,99 @@ func New() (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewWithEngine(eng)
+	return NewWithEngine(eng, opts...)
 }
 
-func NewWithEngine(eng *db.Engine) (*Manager, error) {
+func NewWithEngine(eng *db.Engine, opts ...Option) (*Manager, error) {
 	if eng == nil {
 		return nil, fmt.Errorf("eng must be non-nil")
 	}
-	return &Manager{
-		eng: eng,
-		del: make(map[int64]*operation.Operation),
-	}, nil
+	m := &Manager{
+		eng:          eng,
+		del:          make(map[int64]*operation.Operation),
+		prof:         make(map[int64]*operation.Operation),
+		running:      make(map[int64]*task),
+		workers:      DefaultWorkers,
+		queueSize:    DefaultQueueSize,
+		queryTimeout: DefaultQueryTimeout,
+		maxQueryRows: DefaultMaxQueryRows,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	m.jobs = newQueue(m.workers, m.queueSize)
+	return m, nil
+}
+
+// maxRecoveredOperations bounds how many orphaned operations Recover handles.
+const maxRecoveredOperations = 100000
+
+// Recover cleans up after operations that were running when the server last
+// stopped. Interrupted uploads are marked FAILED and the rows they inserted
+// are removed. Interrupted deletes are restarted, since they run in a single
+// transaction. Interrupted profiles are marked FAILED, and are recomputed the
+// next time they are requested. Staging datasets of interrupted replaces are
+// dropped. Recover should be called once, before serving requests.
+func (m *Manager) Recover() error {
+	ops, err := operation.GetOperations(m.eng, maxRecoveredOperations, operation.FilterByStatus(operation.Status_NOT_STARTED, operation.Status_QUEUED, operation.Status_RUNNING))
+	if err != nil {
+		return fmt.Errorf("failed to get orphaned operations with err: %v", err)
+	}
+
+	for _, op := range ops {
+		ds, err := dataset.GetDatasetFromId(m.eng, op.DatasetId)
+		if err != nil {
+			return fmt.Errorf("failed to get dataset for operation %d with err: %v", op.OperationId, err)
+		}
+
+		if op.OperationType == operation.Type_DELETE {
+			// The delete committed before the operation was marked.
+			if ds == nil {
+				log.Printf("Recovered operation %d: dataset %d already deleted", op.OperationId, op.DatasetId)
+				op.MarkSuccess()
+				continue
+			}
+			log.Printf("Recovered operation %d: resuming delete of dataset %d", op.OperationId, op.DatasetId)
+			m.mu.Lock()
+			m.del[ds.DatasetId] = op
+			m.mu.Unlock()
+			if err := m.enqueueDelete(&DeleteDataRequest{DatasetId: ds.DatasetId}, op); err != nil {
+				return fmt.Errorf("failed to resume delete for operation %d with err: %v", op.OperationId, err)
+			}
+			continue
+		}
+
+		if op.OperationType == operation.Type_PROFILE {
+			log.Printf("Recovered operation %d: abandoning profile of dataset %d", op.OperationId, op.DatasetId)
+			if err := op.MarkFailed("operation was interrupted by a server restart"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("Recovered operation %d: removing partial data", op.OperationId)
+		if err := m.purgeOperation(op); err != nil {
+			return fmt.Errorf("failed to purge data for operation %d with err: %v", op.OperationId, err)
+		}
+		if ds != nil {
+			if err := ds.UpdateNumRecords(); err != nil {
+				return err
+			}
+		}
+		if err := op.MarkFailed("operation was interrupted by a server restart"); err != nil {
+			return err
+		}
+	}
+
+	// Interrupted replaces leave their staging dataset behind.
+	n, err := dataset.DropStaging(m.eng)
+	if err != nil {
+		return fmt.Errorf("failed to drop staging datasets with err: %v", err)
+	}
+	if n > 0 {
+		log.Printf("Recovered %d staging datasets", n)
+	}
+	return nil
 }
 
 // Status returns the status of the server.
@@ -73,8 +203,18 @@ func (m *Manager) CreateDataset(req *CreateDatasetRequest) (int, *CreateDatasetR
 	}
 }
 
+// dataset returns the dataset with datasetId, or nil if there is none. The
+// staging datasets that replace uploads load into are left out.
+func (m *Manager) dataset(datasetId int64) (*dataset.Dataset, error) {
+	ds, err := dataset.GetDatasetFromId(m.eng, datasetId)
+	if err != nil || ds == nil || ds.StagingFor != 0 {
+		return nil, err
+	}
+	return ds, nil
+}
+
 func (m *Manager) GetDataset(req *GetDatasetRequest) (int, *GetDatasetResponse) {
-	ds, err := dataset.GetDatasetFromId(m.eng, req.DatasetId)
+	ds, err := m.dataset(req.DatasetId)
 	if err != nil {
 		log.Printf("Query for Dataset failed with error: %v", err)
 		return http.StatusInternalServerError, &GetDatasetResponse{
@@ -97,6 +237,44 @@ func (m *Manager) GetDataset(req *GetDatasetRequest) (int, *GetDatasetResponse)
 	}
 }
 
+// UpdateDataset sets the metadata of a dataset. Returns the updated dataset.
+func (m *Manager) UpdateDataset(req *UpdateDatasetRequest) (int, *UpdateDatasetResponse) {
+	ds, err := m.dataset(req.DatasetId)
+	if err != nil {
+		log.Printf("Query for Dataset failed with error: %v", err)
+		return http.StatusInternalServerError, &UpdateDatasetResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if ds == nil {
+		return http.StatusNotFound, &UpdateDatasetResponse{
+			Message: fmt.Sprintf("failed to find dataset with id: %d", req.DatasetId),
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	err = ds.SetMetadata(dataset.Metadata{
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+		Tags:        req.Tags,
+		Source:      req.Source,
+		Owner:       req.Owner,
+	})
+	if err != nil {
+		log.Printf("Failed to update dataset with error: %v", err)
+		return http.StatusInternalServerError, &UpdateDatasetResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return http.StatusOK, &UpdateDatasetResponse{
+		Dataset: ds,
+		Code:    http.StatusOK,
+	}
+}
+
 func (m *Manager) ListDatasets(req *ListDatasetsRequest) (int, *ListDatasetsResponse) {
 	resp := &ListDatasetsResponse{
 		Results:       []*dataset.Dataset{},
@@ -104,7 +282,18 @@ func (m *Manager) ListDatasets(req *ListDatasetsRequest) (int, *ListDatasetsResp
 		Code:          http.StatusOK,
 	}
 
-	td, err := dataset.TotalDatasets(m.eng)
+	var filters []dataset.Filter
+	if req.Tag != "" {
+		filters = append(filters, dataset.FilterByTag(req.Tag))
+	}
+	if req.Search != "" {
+		filters = append(filters, dataset.FilterByName(req.Search))
+	}
+	if req.Empty != nil {
+		filters = append(filters, dataset.FilterByEmpty(*req.Empty))
+	}
+
+	td, err := dataset.TotalDatasets(m.eng, filters...)
 	if err != nil {
 		log.Printf("Failed to get total number of datasets with error: %v", err)
 		return http.StatusInternalServerError, &ListDatasetsResponse{
@@ -115,7 +304,7 @@ func (m *Manager) ListDatasets(req *ListDatasetsRequest) (int, *ListDatasetsResp
 	resp.TotalDatasets = td
 
 	// Add Datasets to Result
-	results, err := dataset.GetDatasets(m.eng, req.MaxDatasets)
+	results, next, err := dataset.ListDatasets(m.eng, req.MaxDatasets, req.Sort, req.PageToken, filters...)
 	if err != nil {
 		log.Printf("Failed to get datasets with error: %v", err)
 		return http.StatusInternalServerError, &ListDatasetsResponse{
@@ -124,6 +313,9 @@ func (m *Manager) ListDatasets(req *ListDatasetsRequest) (int, *ListDatasetsResp
 		}
 	}
 	resp.Results = results
+	if next != nil {
+		resp.NextPageToken = next.Encode()
+	}
 
 	return http.StatusOK, resp
 }
@@ -155,35 +347,146 @@ func (m *Manager) uploadRecordCount(ds *dataset.Dataset, op *operation.Operation
 	cancel <- true
 }
 
-func (m *Manager) createOrGetHeaders(rd io.Reader, op *operation.Operation, ds *dataset.Dataset) ([]*header.Header, error) {
+// columnMap lines up the columns of an upload with the dataset's headers.
+type columnMap struct {
+	// headers[i] is the Header for the i-th column of the file.
+	headers []*header.Header
+
+	// missing are the dataset's Headers that the file has no column for.
+	missing []*header.Header
+
+	// next is the column index of the next Header added to the dataset.
+	next int64
+
+	// declared holds the HeaderIds whose ValueType was declared by the
+	// file's schema, and isn't inferred from the values.
+	declared map[int64]bool
+
+	// namer names the columns added after the header row, if the file names
+	// them. Otherwise they are named column_1..N by position.
+	namer columnNamer
+
+	// typer declares the ValueTypes of the columns, if the file has a
+	// schema. Otherwise they are inferred from the values.
+	typer columnTyper
+}
+
+// columnNamer is implemented by rowReaders whose rows can have columns the
+// header row didn't, such as JSON objects with new keys.
+type columnNamer interface {
+	// columnName returns the name of the i-th column.
+	columnName(i int) string
+}
+
+// columnTyper is implemented by rowReaders of files whose schema types their
+// columns, such as Parquet files.
+type columnTyper interface {
+	// columnType returns the ValueType of the i-th column, or
+	// header.ValueType_RAW if it should be inferred.
+	columnType(i int) header.ValueType
+}
+
+// extend adds a Header named displayName to the dataset, and maps the next
+// column of the file to it.
+func (cm *columnMap) extend(eng *db.Engine, ds *dataset.Dataset, displayName string) (*header.Header, error) {
+	h, err := header.New(eng, ds.DatasetId, header.WithDisplayName(displayName))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.SetColumnIndex(cm.next); err != nil {
+		return nil, err
+	}
+	cm.next++
+	cm.headers = append(cm.headers, h)
+	return h, nil
+}
+
+// add maps the i-th column of the file, which is past the header row, to a
+// Header. A named column is matched to one of the missing Headers with its
+// name, and other columns are added to the dataset.
+func (cm *columnMap) add(eng *db.Engine, ds *dataset.Dataset, i int) error {
+	if cm.namer == nil {
+		_, err := cm.extend(eng, ds, header.DefaultDisplayName(i))
+		return err
+	}
+	name := cm.namer.columnName(i)
+	for j, h := range cm.missing {
+		if h.DisplayName == name {
+			cm.headers = append(cm.headers, h)
+			cm.missing = append(cm.missing[:j], cm.missing[j+1:]...)
+			return nil
+		}
+	}
+	_, err := cm.extend(eng, ds, name)
+	return err
+}
+
+// createOrGetHeaders maps the columns of the file to the dataset's headers.
+// first is the first row of the file, or nil if it is empty. If the dataset
+// has no headers, they are created from first. If hasHeaders
+// is false, the first row is data, new headers are named column_1..N and
+// columns are matched by position. Otherwise columns are matched by name, and
+// columns the dataset doesn't have yet are added to it.
+func (m *Manager) createOrGetHeaders(first []string, op *operation.Operation, ds *dataset.Dataset, req *UploadDatasetRequest) (*columnMap, error) {
 	// Load Headers from Database
 	headers, err := header.GetHeaders(m.eng, ds.DatasetId)
 	if err != nil {
 		return nil, err
 	}
-
-	// Return if we got a least one back
-	if len(headers) > 0 && ds.HeadersSet {
-		return headers, nil
+	cm := &columnMap{
+		next:     int64(len(headers)),
+		declared: make(map[int64]bool),
 	}
+
 	if len(headers) > 0 && !ds.HeadersSet {
-		err := ds.SetHeaders(true)
-		return headers, err
+		if err := ds.SetHeaders(true); err != nil {
+			return nil, err
+		}
 	}
 
-	// Read Headers from the file since we haven't seen any yet
-	reader := csv.NewReader(rd)
-	rawRecord, err := reader.Read()
+	// Without a header row, we can only match by position
+	if len(headers) > 0 && !req.HasHeaders {
+		cm.headers = headers
+		return cm, nil
+	}
 
-	// Unexpected Error
-	if err != nil && err != io.EOF {
-		return nil, err
+	// Empty file, so we return the existing header list
+	if first == nil {
+		cm.headers = headers
+		return cm, nil
 	}
+	rawRecord := first
 
-	// EOF, so we return empty header list
-	if err == io.EOF {
-		// no headers
-		return headers, nil
+	// Match the file's columns to existing Headers by name
+	if len(headers) > 0 {
+		byName := make(map[string][]*header.Header)
+		for _, h := range headers {
+			byName[h.DisplayName] = append(byName[h.DisplayName], h)
+		}
+		for _, dn := range rawRecord {
+			if hs := byName[dn]; len(hs) > 0 {
+				cm.headers = append(cm.headers, hs[0])
+				byName[dn] = hs[1:]
+				continue
+			}
+			if _, err := cm.extend(m.eng, ds, dn); err != nil {
+				return nil, err
+			}
+		}
+		for _, h := range headers {
+			if hs := byName[h.DisplayName]; len(hs) > 0 && hs[0] == h {
+				cm.missing = append(cm.missing, h)
+				byName[h.DisplayName] = hs[1:]
+			}
+		}
+		if len(cm.missing) > 0 && req.MissingColumns == MissingColumns_FAIL {
+			var names []string
+			for _, h := range cm.missing {
+				names = append(names, h.DisplayName)
+			}
+			return nil, fmt.Errorf("file is missing columns: %s", strings.Join(names, ", "))
+		}
+		return cm, nil
 	}
 
 	// Create Headers from input file
@@ -191,8 +494,12 @@ func (m *Manager) createOrGetHeaders(rd io.Reader, op *operation.Operation, ds *
 	if err != nil {
 		return nil, err
 	}
-	for _, dn := range rawRecord {
+	for i, dn := range rawRecord {
+		if !req.HasHeaders {
+			dn = header.DefaultDisplayName(i)
+		}
 		if err := tx.Exec(ds.DatasetId, dn, header.ValueType_RAW); err != nil {
+			tx.Rollback()
 			return nil, err
 		}
 	}
@@ -215,197 +522,398 @@ func (m *Manager) createOrGetHeaders(rd io.Reader, op *operation.Operation, ds *
 			return nil, err
 		}
 	}
+	cm.headers = headers
+	cm.next = int64(len(headers))
 
-	return headers, nil
+	return cm, nil
 }
 
-func (m *Manager) createRecords(rd io.Reader, op *operation.Operation, ds *dataset.Dataset) error {
-	// Create Records Transaction
-	tx, err := db.NewTx(m.eng, "records", "operationid", "datasetid")
-	if err != nil {
-		return fmt.Errorf("failed to create record tx with err: %v", err)
+func (m *Manager) processUpload(ctx context.Context, req *UploadDatasetRequest, op *operation.Operation, ds *dataset.Dataset) {
+	defer m.finish(op)
+
+	// Cancelled while queued
+	if ctx.Err() != nil {
+		op.MarkCancelled()
+		return
 	}
 
-	// Create Each Record
-	reader := csv.NewReader(rd)
-	reader.LazyQuotes = true
-	reader.ReuseRecord = true
-	for {
-		_, err := reader.Read()
-		// Unexpected Error
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("failed to read record with err: %v", err)
-		}
+	// Mark Operation as Running
+	if err := op.MarkRunning(); err != nil {
+		log.Printf("MarkRunning failed with error: %v", err)
+		return
+	}
 
-		// EOF, wait until all threads have finished
-		if err == io.EOF {
-			break
-		}
+	// Starts a background process to update the number of records in the dataset.
+	go m.uploadRecordCount(ds, op)
 
-		// Create Record
-		if err := tx.Exec(op.OperationId, ds.DatasetId); err != nil {
-			return fmt.Errorf("faield to Exec(op, ds) with err: %v", err)
+	// Replace loads into a hidden staging dataset, which is swapped in once
+	// the load has succeeded. Until then, the dataset is left untouched.
+	dst := ds
+	replaced := false
+	if req.Mode == UploadMode_REPLACE {
+		staging, err := dataset.New(m.eng,
+			dataset.WithDisplayName(fmt.Sprintf("%s-staging-%d", ds.DisplayName, op.OperationId)),
+			dataset.WithStagingFor(ds.DatasetId),
+		)
+		if err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to create staging dataset with error: %v", err))
+			return
 		}
+		dst = staging
+		defer func() {
+			if replaced {
+				return
+			}
+			if err := staging.Drop(); err != nil {
+				log.Printf("failed to drop staging dataset %d with err: %v", staging.DatasetId, err)
+			}
+		}()
 	}
-	return tx.Close()
-}
 
-func (m *Manager) createCells(rd io.Reader, op *operation.Operation, ds *dataset.Dataset, headers []*header.Header) error {
-	// Create RecordsProcessed Tx
-	rtx, err := db.NewTx(m.eng, "recordsprocessed", "recordid", "datasetid")
-	if err != nil {
-		return err
-	}
+	// Periodically save progress to the operation
+	p := newProgress(op, req.InputSize)
+	stop := p.report()
+	defer stop()
 
-	// Create Cells Tx
-	ctx, err := db.NewTx(m.eng, "cells", "recordid", "headerid", "operationid", "rawvalue")
-	if err != nil {
-		return err
+	// The upload is read in a single pass. Peek at its start to detect the
+	// compression, format and delimiter.
+	br := bufio.NewReaderSize(p.reader(&contextReader{ctx: ctx, r: req.InputFile}), detectSampleSize)
+	sample, err := br.Peek(detectSampleSize)
+	if err != nil && err != io.EOF {
+		m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to read upload with error: %v", err))
+		return
 	}
 
-	// Get RecordIds
-	records, err := m.eng.DatabaseHandle.Query("SELECT RecordId FROM Records WHERE OperationId = $1 ORDER BY RecordId", op.OperationId)
-	if err != nil {
-		return err
+	// file is the upload if it can be read at an offset, which it can't
+	// once decompressed.
+	var file io.ReaderAt
+	if ra, ok := req.InputFile.(io.ReaderAt); ok {
+		file = p.readerAt(&contextReaderAt{ctx: ctx, r: ra})
 	}
-	defer records.Close()
-
-	reader := csv.NewReader(rd)
-	reader.LazyQuotes = true
-	reader.ReuseRecord = true
-	first := true
-
-	// For each record, we go through the CSV and create a cell for each
-	// column in the row. Associate the correct foreign keys and then mark
-	// the record (row) as processed.
-	for records.Next() {
-		var recordId int64
-		if err := records.Scan(&recordId); err != nil {
-			return err
+	for depth := 0; ; depth++ {
+		c := detectCompression(sample)
+		if c == compressionNone {
+			break
 		}
-
-		// Read the row
-		rawRecord, err := reader.Read()
-		// Unexpected Error
-		if err != nil && err != io.EOF {
-			return err
+		if depth == maxCompressionDepth {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to decompress upload: compressed more than %d times", maxCompressionDepth))
+			return
+		}
+		log.Printf("Decompressing %s upload for operation: %d", c, op.OperationId)
+		rd, done, err := decompress(c, br, file, req.InputSize, req.Member)
+		if err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to decompress upload with error: %v", err))
+			return
 		}
-		// EOF
-		if err == io.EOF {
+		defer done()
+		file = nil
+		br = bufio.NewReaderSize(rd, detectSampleSize)
+		if sample, err = br.Peek(detectSampleSize); err != nil && err != io.EOF {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to decompress upload with error: %v", err))
+			return
+		}
+	}
+	format := req.Format
+	if format == "" {
+		format = detectUploadFormat(sample, req.Dialect)
+	}
+	var rr rowReader
+	switch format {
+	case UploadFormat_NDJSON, UploadFormat_JSON:
+		// JSON objects name their columns
+		rr = newJSONReader(req.Dialect.decode(br))
+		req.HasHeaders = true
+	case UploadFormat_XLSX, UploadFormat_PARQUET:
+		// Workbooks and Parquet files are read from their end
+		ra, size, cleanup, err := readerAt(file, req.InputSize, br)
+		if err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to read upload with error: %v", err))
+			return
+		}
+		defer cleanup()
+		if format == UploadFormat_PARQUET {
+			pr, err := openParquet(ra, size)
+			if err != nil {
+				m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to open Parquet file with error: %v", err))
+				return
+			}
+			// Parquet columns are named by the schema
+			rr = pr
+			req.HasHeaders = true
+			p.setTotalRows(pr.numRows)
 			break
 		}
-		// First should skip
-		if first {
-			first = false
-			continue
+		wb, err := openXLSX(ra, size)
+		if err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to open workbook with error: %v", err))
+			return
+		}
+		xr, err := wb.sheet(req.Sheet, req.SkipRows)
+		if err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to open sheet with error: %v", err))
+			return
+		}
+		defer xr.Close()
+		rr = xr
+	default:
+		if err := req.Dialect.detect(bytes.NewReader(sample)); err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to detect delimiter with error: %v", err))
+			return
 		}
+		rr = req.Dialect.newReader(br)
+		if req.SkipRows > 0 {
+			rr = &skipReader{r: rr, n: req.SkipRows}
+		}
+	}
 
-		headerIdx := 0
-		for _, rv := range rawRecord {
-			// Extend Headers if needed
-			if headerIdx >= len(headers) {
-				header, err := header.New(m.eng, ds.DatasetId)
-				if err != nil {
-					return err
-				}
-				headers = append(headers, header)
-			}
-			// Create Cell for (row, col)
-			if err := ctx.Exec(recordId, headers[headerIdx].HeaderId, op.OperationId, rv); err != nil {
-				return err
+	// Create Headers
+	log.Printf("Creating Headers for operation: %d", op.OperationId)
+	p.setPhase(operation.Phase_HEADERS)
+	first, err := rr.Read()
+	if err != nil && err != io.EOF {
+		m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to read first row with error: %v", err))
+		return
+	}
+	if first != nil {
+		first = append([]string{}, first...)
+	}
+	cm, err := m.createOrGetHeaders(first, op, dst, req)
+	if err != nil {
+		m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to load headers into memory: %v", err))
+		return
+	}
+	if n, ok := rr.(columnNamer); ok {
+		cm.namer = n
+	}
+	if t, ok := rr.(columnTyper); ok {
+		cm.typer = t
+	}
+	var key *header.Header
+	if req.Mode == UploadMode_UPSERT {
+		for _, h := range cm.headers {
+			if h.DisplayName == req.Key {
+				key = h
+				break
 			}
-			headerIdx++
 		}
-		// Mark Record as Processed
-		if err := rtx.Exec(recordId, ds.DatasetId); err != nil {
-			return err
+		if key == nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to find key column %q in file", req.Key))
+			return
 		}
 	}
 
-	if err := ctx.Close(); err != nil {
-		return err
+	// Create Records and Cells. Without a header row, the first row is data.
+	log.Printf("Creating Records for operation: %d", op.OperationId)
+	p.setPhase(operation.Phase_RECORDS)
+	p.save()
+	if req.HasHeaders {
+		first = nil
 	}
-	if err := rtx.Close(); err != nil {
-		return err
+	if err := m.ingest(ctx, rr, first, op, dst, cm, p); err != nil {
+		m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to create records: %v", err))
+		return
 	}
+	p.setTotalRows(p.snapshot().RowsProcessed)
 
-	return nil
+	switch req.Mode {
+	case UploadMode_REPLACE:
+		log.Printf("Replacing dataset %d for operation: %d", ds.DatasetId, op.OperationId)
+		if err := ds.Replace(dst); err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to replace dataset: %v", err))
+			return
+		}
+		replaced = true
+	case UploadMode_UPSERT:
+		log.Printf("Removing replaced records for operation: %d", op.OperationId)
+		if err := m.upsertRecords(ctx, op, key); err != nil {
+			m.abortUpload(ctx, op, dst, fmt.Sprintf("Failed to upsert records: %v", err))
+			return
+		}
+	}
+	log.Printf("Finishing operation: %d", op.OperationId)
+
+	ds.UpdateNumRecords()
+	op.MarkSuccess()
+
+	// Profile the new data in the background, unless the queue is busy
+	if _, err := m.enqueueProfile(ds.DatasetId); err != nil && err != errQueueFull {
+		log.Printf("failed to queue profile of dataset %d with err: %v", ds.DatasetId, err)
+	}
 }
 
-func (m *Manager) processUpload(req *UploadDatasetRequest, op *operation.Operation, ds *dataset.Dataset) {
-	// Mark Operation as Running
-	if err := op.MarkRunning(); err != nil {
-		log.Printf("MarkRunning failed with error: %v", err)
+// abortUpload marks op as FAILED with msg, or as CANCELLED if ctx was
+// cancelled. Cancelled uploads also remove the rows they already inserted.
+func (m *Manager) abortUpload(ctx context.Context, op *operation.Operation, ds *dataset.Dataset, msg string) {
+	if ctx.Err() == nil {
+		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
+		op.MarkFailed(msg)
 		return
 	}
 
-	// Starts a background process to update the number of records in the dataset.
-	go m.uploadRecordCount(ds, op)
+	log.Printf("/operation/%d cancelled, removing partial data", op.OperationId)
+	if err := m.purgeOperation(op); err != nil {
+		log.Printf("failed to purge data for operation %d with err: %v", op.OperationId, err)
+	}
+	ds.UpdateNumRecords()
+	op.MarkCancelled()
+}
 
-	// Store Request File to Disk
-	tmp, err := os.CreateTemp("", "spec_import")
+// purgeOperation deletes every Record and Cell created by op.
+func (m *Manager) purgeOperation(op *operation.Operation) error {
+	tx, err := m.eng.DatabaseHandle.Begin()
 	if err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to create temp file with error: %v", err))
-		return
+		return err
 	}
-	if _, err = io.Copy(tmp, req.InputFile); err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to copy to temp file with error: %v", err))
-		return
+	for _, q := range []string{
+		"DELETE FROM Cells WHERE OperationId = $1",
+		"DELETE FROM RecordsProcessed WHERE RecordId IN (SELECT RecordId FROM Records WHERE OperationId = $1)",
+		"DELETE FROM Records WHERE OperationId = $1",
+	} {
+		if _, err := tx.Exec(q, op.OperationId); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	defer os.Remove(tmp.Name())
+	return tx.Commit()
+}
 
-	// Create Headers
-	log.Printf("Creating Headers for operation: %d", op.OperationId)
-	tf, err := os.Open(tmp.Name())
+// upsertStale holds the records that op replaced: those with the same value
+// for the key header as a later record uploaded by op.
+const upsertStale = `CREATE TEMP TABLE UpsertStale ON COMMIT DROP AS
+	SELECT DISTINCT o.RecordId FROM Cells o, Cells n
+	WHERE n.OperationId = $1 AND n.HeaderId = $2
+	AND o.HeaderId = n.HeaderId AND o.RawValue = n.RawValue AND o.RecordId < n.RecordId`
+
+// upsertRecords deletes the records that op replaced, keyed by key.
+func (m *Manager) upsertRecords(ctx context.Context, op *operation.Operation, key *header.Header) error {
+	tx, err := m.eng.DatabaseHandle.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to copy to temp file for headers with error: %v", err))
-		return
+		return err
 	}
-	headers, err := m.createOrGetHeaders(tf, op, ds)
-	if err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to load headers into memory: %v", err))
-		return
+	if _, err := tx.ExecContext(ctx, upsertStale, op.OperationId, key.HeaderId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, q := range []string{
+		"DELETE FROM Cells WHERE RecordId IN (SELECT RecordId FROM UpsertStale)",
+		"DELETE FROM RecordsProcessed WHERE RecordId IN (SELECT RecordId FROM UpsertStale)",
+		"DELETE FROM Records WHERE RecordId IN (SELECT RecordId FROM UpsertStale)",
+	} {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
-	// Create Records
-	log.Printf("Creating Records for operation: %d", op.OperationId)
-	rf, err := os.Open(tmp.Name())
+// enqueueUpload queues req to be processed by a worker.
+func (m *Manager) enqueueUpload(req *UploadDatasetRequest, op *operation.Operation, ds *dataset.Dataset) error {
+	ctx := m.start(op)
+	return m.enqueue(op, ds.DatasetId, func() {
+		m.processUpload(ctx, req, op, ds)
+	})
+}
+
+// enqueueDelete queues the deletion of req.DatasetId to be run by a worker.
+func (m *Manager) enqueueDelete(req *DeleteDataRequest, op *operation.Operation) error {
+	ctx := m.start(op)
+	return m.enqueue(op, req.DatasetId, func() {
+		m.deleteDataset(ctx, req, op)
+	})
+}
+
+// enqueue pushes run onto the job queue. If op can't be queued, it is marked FAILED.
+func (m *Manager) enqueue(op *operation.Operation, datasetId int64, run func()) error {
+	// Mark QUEUED first, so a worker can't have already marked it RUNNING.
+	err := op.MarkQueued()
+	if err == nil {
+		err = m.jobs.push(&job{
+			op:        op,
+			datasetId: datasetId,
+			run:       run,
+		})
+	}
 	if err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to copy to temp file for records with error: %v", err))
-		return
+		m.finish(op)
+		op.MarkFailed(fmt.Sprintf("failed to queue operation with err: %v", err))
 	}
-	if err := m.createRecords(rf, op, ds); err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to create records: %v", err))
-		return
+	return err
+}
+
+// dequeue takes the operation with operationId off the queue, and cleans up
+// after it as its job would have. Returns false if a worker already claimed it.
+func (m *Manager) dequeue(operationId int64) bool {
+	j := m.jobs.remove(operationId)
+	if j == nil {
+		return false
+	}
+	m.finish(j.op)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if op, ok := m.prof[j.datasetId]; ok && op.OperationId == operationId {
+		delete(m.prof, j.datasetId)
 	}
+	return true
+}
 
-	// Create Cells
-	log.Printf("Creating Cells for operation: %d", op.OperationId)
-	cf, err := os.Open(tmp.Name())
-	if err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to copy to temp file for cells with error: %v", err))
-		return
+// task is an operation that is queued or running on this server.
+type task struct {
+	op     *operation.Operation
+	cancel context.CancelFunc
+}
+
+// start registers op as running and returns the context it should run with.
+// The context is cancelled by CancelOperation.
+func (m *Manager) start(op *operation.Operation) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running[op.OperationId] = &task{
+		op:     op,
+		cancel: cancel,
 	}
-	if err := m.createCells(cf, op, ds, headers); err != nil {
-		log.Printf("/operation/%d failed, check the logs to see a detailed error", op.OperationId)
-		op.MarkFailed(fmt.Sprintf("Failed to create cells: %v", err))
-		return
+	return ctx
+}
+
+// finish releases the resources held for a running op.
+func (m *Manager) finish(op *operation.Operation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, ok := m.running[op.OperationId]; ok {
+		t.cancel()
+		delete(m.running, op.OperationId)
 	}
-	log.Printf("Finishing operation: %d", op.OperationId)
+}
 
-	ds.UpdateNumRecords()
-	op.MarkSuccess()
+// contextReader stops reading once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// contextReaderAt stops reading once ctx is done.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (cr *contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.ReadAt(p, off)
 }
 
 func (m *Manager) UploadDataset(req *UploadDatasetRequest) (int, *UploadDatasetResponse) {
-	ds, err := dataset.GetDatasetFromId(m.eng, req.DatasetId)
+	ds, err := m.dataset(req.DatasetId)
 	if err != nil {
 		log.Printf("Query for Dataset failed with error: %v", err)
 		return http.StatusInternalServerError, &UploadDatasetResponse{
@@ -421,16 +929,26 @@ func (m *Manager) UploadDataset(req *UploadDatasetRequest) (int, *UploadDatasetR
 		}
 	}
 
-	op, err := operation.New(m.eng)
+	if req.Sheet == AllSheets {
+		return m.uploadSheets(req, ds)
+	}
+
+	// Zip archives of several files are uploaded a file at a time
+	members, err := zipMembers(req)
 	if err != nil {
-		log.Printf("Failed to build create operation statement with error: %v", err)
-		return http.StatusInternalServerError, &UploadDatasetResponse{
-			Message: "INTERNAL SERVER ERROR",
-			Code:    http.StatusInternalServerError,
+		return http.StatusBadRequest, &UploadDatasetResponse{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
 		}
 	}
+	if len(members) > 1 {
+		return m.uploadMembers(req, ds, members)
+	}
 
-	go m.processUpload(req, op, ds)
+	op, code, resp := m.queueUpload(req, ds)
+	if op == nil {
+		return code, resp
+	}
 
 	// Return Operation
 	return http.StatusOK, &UploadDatasetResponse{
@@ -439,8 +957,123 @@ func (m *Manager) UploadDataset(req *UploadDatasetRequest) (int, *UploadDatasetR
 	}
 }
 
+// queueUpload creates an operation uploading req to ds, and queues it. If
+// it fails, the operation is nil and the status and response to reply with
+// are returned.
+func (m *Manager) queueUpload(req *UploadDatasetRequest, ds *dataset.Dataset) (*operation.Operation, int, *UploadDatasetResponse) {
+	op, err := operation.New(m.eng, operation.WithType(operation.Type_UPLOAD), operation.WithDatasetId(ds.DatasetId))
+	if err != nil {
+		log.Printf("Failed to build create operation statement with error: %v", err)
+		return nil, http.StatusInternalServerError, &UploadDatasetResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	if err := m.enqueueUpload(req, op, ds); err != nil {
+		if err == errQueueFull {
+			return nil, http.StatusTooManyRequests, &UploadDatasetResponse{
+				OperationUrl: fmt.Sprintf("/operation/%d", op.OperationId),
+				Message:      "too many operations in progress, try again later",
+				Code:         http.StatusTooManyRequests,
+			}
+		}
+		log.Printf("Failed to queue upload with error: %v", err)
+		return nil, http.StatusInternalServerError, &UploadDatasetResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return op, http.StatusOK, nil
+}
+
+// uploadMembers queues an upload of each of members, the files of the zip
+// archive req.InputFile, to ds. They are uploaded in order, so when
+// replacing the dataset the first file replaces it and the rest are
+// appended.
+func (m *Manager) uploadMembers(req *UploadDatasetRequest, ds *dataset.Dataset, members []string) (int, *UploadDatasetResponse) {
+	ra := req.InputFile.(io.ReaderAt)
+	resp := &UploadDatasetResponse{Code: http.StatusOK}
+	for i, member := range members {
+		// Each file reads the archive independently
+		memberReq := *req
+		memberReq.Member = member
+		memberReq.InputFile = io.NewSectionReader(ra, 0, req.InputSize)
+		if i > 0 && req.Mode == UploadMode_REPLACE {
+			memberReq.Mode = UploadMode_APPEND
+		}
+		op, code, errResp := m.queueUpload(&memberReq, ds)
+		if op == nil {
+			errResp.Files = resp.Files
+			return code, errResp
+		}
+
+		resp.Files = append(resp.Files, &FileUpload{
+			File:         member,
+			OperationUrl: fmt.Sprintf("/operation/%d", op.OperationId),
+		})
+	}
+	resp.OperationUrl = resp.Files[0].OperationUrl
+	return http.StatusOK, resp
+}
+
+// uploadSheets queues an upload of each sheet of the workbook req.InputFile.
+// The first sheet is uploaded to ds, and each other sheet to a new dataset
+// named after it.
+func (m *Manager) uploadSheets(req *UploadDatasetRequest, ds *dataset.Dataset) (int, *UploadDatasetResponse) {
+	ra, ok := req.InputFile.(io.ReaderAt)
+	if !ok || req.InputSize <= 0 {
+		return http.StatusBadRequest, &UploadDatasetResponse{
+			Message: "failed to read sheets of workbook",
+			Code:    http.StatusBadRequest,
+		}
+	}
+	wb, err := openXLSX(ra, req.InputSize)
+	if err != nil {
+		return http.StatusBadRequest, &UploadDatasetResponse{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	resp := &UploadDatasetResponse{Code: http.StatusOK}
+	for i, sheet := range wb.sheetNames() {
+		dst := ds
+		if i > 0 {
+			dst, err = dataset.New(m.eng, dataset.WithDisplayName(fmt.Sprintf("%s - %s", ds.DisplayName, sheet)))
+			if err != nil {
+				log.Printf("Failed to create dataset for sheet %q with error: %v", sheet, err)
+				return http.StatusInternalServerError, &UploadDatasetResponse{
+					Message: "INTERNAL SERVER ERROR",
+					Code:    http.StatusInternalServerError,
+				}
+			}
+		}
+
+		// Each sheet reads the file independently
+		sheetReq := *req
+		sheetReq.DatasetId = dst.DatasetId
+		sheetReq.Format = UploadFormat_XLSX
+		sheetReq.Sheet = sheet
+		sheetReq.InputFile = io.NewSectionReader(ra, 0, req.InputSize)
+		op, code, errResp := m.queueUpload(&sheetReq, dst)
+		if op == nil {
+			errResp.Sheets = resp.Sheets
+			return code, errResp
+		}
+
+		resp.Sheets = append(resp.Sheets, &SheetUpload{
+			Sheet:        sheet,
+			DatasetId:    dst.DatasetId,
+			OperationUrl: fmt.Sprintf("/operation/%d", op.OperationId),
+		})
+	}
+	resp.OperationUrl = resp.Sheets[0].OperationUrl
+	return http.StatusOK, resp
+}
+
 func (m *Manager) GetHeaders(req *GetHeadersRequest) (int, *GetHeadersResponse) {
-	ds, err := dataset.GetDatasetFromId(m.eng, req.DatasetId)
+	ds, err := m.dataset(req.DatasetId)
 	if err != nil {
 		log.Printf("Query for Dataset failed with error: %v", err)
 		return http.StatusInternalServerError, &GetHeadersResponse{
@@ -472,30 +1105,92 @@ func (m *Manager) GetHeaders(req *GetHeadersRequest) (int, *GetHeadersResponse)
 	}
 }
 
-func convertHeadersToString(headers []*header.Header) (string, error) {
-	if headers == nil || len(headers) == 0 {
-		return "", fmt.Errorf("can't convert headers for nil or empty list")
+// UpdateHeader sets the ValueType of a header, and re-parses its cells.
+// Inference from later uploads won't change it.
+func (m *Manager) UpdateHeader(req *UpdateHeaderRequest) (int, *UpdateHeaderResponse) {
+	ds, err := m.dataset(req.DatasetId)
+	if err != nil {
+		log.Printf("Query for Dataset failed with error: %v", err)
+		return http.StatusInternalServerError, &UpdateHeaderResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	var h *header.Header
+	if ds != nil {
+		h, err = header.GetHeader(m.eng, req.DatasetId, req.HeaderId)
+	}
+	if err != nil {
+		log.Printf("Failed to get header with err: %v", err)
+		return http.StatusInternalServerError, &UpdateHeaderResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if h == nil {
+		return http.StatusNotFound, &UpdateHeaderResponse{
+			Message: fmt.Sprintf("failed to find header %d in dataset: %d", req.HeaderId, req.DatasetId),
+			Code:    http.StatusNotFound,
+		}
 	}
 
-	if len(headers) == 1 {
-		return fmt.Sprintf("HeaderId = %d", headers[0].HeaderId), nil
+	old := h.ValueType
+	if err := m.setValueType(context.Background(), h, req.ValueType); err != nil {
+		log.Printf("Failed to set header value type with err: %v", err)
+		return http.StatusInternalServerError, &UpdateHeaderResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
 	}
+	if old != h.ValueType {
+		if err := m.markChanged(req.DatasetId); err != nil {
+			log.Printf("Failed to mark dataset changed with err: %v", err)
+			return http.StatusInternalServerError, &UpdateHeaderResponse{
+				Message: "INTERNAL SERVER ERROR",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+	}
+	return http.StatusOK, &UpdateHeaderResponse{
+		Header: h,
+		Code:   http.StatusOK,
+	}
+}
 
-	result := "HeaderId IN ("
-	for i, h := range headers {
-		result += fmt.Sprintf("%d", h.HeaderId)
-		// Append , if this is not the last header
-		if i+1 < len(headers) {
-			result += ","
+// setValueType sets the ValueType of h and re-parses its cells in one
+// transaction, so the cells always match the header.
+func (m *Manager) setValueType(ctx context.Context, h *header.Header, vt header.ValueType) error {
+	tx, err := m.eng.DatabaseHandle.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if vt != h.ValueType {
+		if err := cell.RetypeTx(ctx, m.eng, tx, h.HeaderId, vt); err != nil {
+			return err
 		}
 	}
-	result += ")"
-	return result, nil
+	if err := h.SetValueTypeTx(ctx, tx, vt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// markChanged invalidates what was computed from the data of a dataset.
+func (m *Manager) markChanged(datasetId int64) error {
+	ds, err := dataset.GetDatasetFromId(m.eng, datasetId)
+	if err != nil {
+		return err
+	}
+	if ds == nil {
+		return nil
+	}
+	return ds.MarkChanged()
 }
 
 func (m *Manager) GetData(req *DataRequest) (int, *DataResponse) {
 	// Query for Dataset
-	ds, err := dataset.GetDatasetFromId(m.eng, req.DatasetId)
+	ds, err := m.dataset(req.DatasetId)
 	if err != nil {
 		log.Printf("Query for Dataset failed with error: %v", err)
 		return http.StatusInternalServerError, &DataResponse{
@@ -527,6 +1222,32 @@ func (m *Manager) GetData(req *DataRequest) (int, *DataResponse) {
 		}
 	}
 
+	// Translate the filter and sort. Their columns needn't be among req.Headers.
+	resolve := query.HeaderResolver(headers)
+	args := query.NewArgs(ds.DatasetId)
+	where := "rp.DatasetId = $1"
+	if req.Where != nil {
+		f, err := query.SQL(req.Where, "rp.RecordId", resolve, args)
+		if err != nil {
+			return http.StatusBadRequest, &DataResponse{
+				Message: fmt.Sprintf("invalid filter: %v", err),
+				Code:    http.StatusBadRequest,
+			}
+		}
+		where += " AND " + f
+	}
+	var sortColumns []string
+	if req.Order != nil {
+		var err error
+		sortColumns, err = query.SortColumns(req.Order, "rp.RecordId", resolve, args)
+		if err != nil {
+			return http.StatusBadRequest, &DataResponse{
+				Message: fmt.Sprintf("invalid sort: %v", err),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
 	// Exclude headers not included in req.Headers
 	hasExclusions := false
 	if len(req.Headers) > 0 {
@@ -548,36 +1269,93 @@ func (m *Manager) GetData(req *DataRequest) (int, *DataResponse) {
 	if len(headers) == 0 {
 		return http.StatusOK, resp
 	}
-	hs, err := convertHeadersToString(headers)
+
+	// Get the RecordIds of this page, and one more to tell if there's a next page.
+	// Sorted pages continue after req.Cursor, and others from req.LastRecordId.
+	var q string
+	if req.Order != nil {
+		aliases := make([]string, len(sortColumns))
+		selects := make([]string, len(sortColumns))
+		for i, c := range sortColumns {
+			aliases[i] = fmt.Sprintf("t.s%d", i)
+			selects[i] = fmt.Sprintf("%s AS s%d", c, i)
+		}
+		after := ""
+		if req.Cursor != nil {
+			a, err := query.After(req.Order, aliases, "t.RecordId", req.Cursor, args)
+			if err != nil {
+				return http.StatusBadRequest, &DataResponse{
+					Message: fmt.Sprintf("invalid cursor: %v", err),
+					Code:    http.StatusBadRequest,
+				}
+			}
+			after = " WHERE " + a
+		}
+		q = fmt.Sprintf("SELECT t.RecordId, %s FROM (SELECT rp.RecordId, %s FROM RecordsProcessed rp WHERE %s) t%s ORDER BY %s LIMIT %s", strings.Join(aliases, ", "), strings.Join(selects, ", "), where, after, query.OrderBy(req.Order, aliases, "t.RecordId"), args.Add(req.MaxResults+1))
+	} else {
+		q = fmt.Sprintf("SELECT rp.RecordId FROM RecordsProcessed rp WHERE %s AND rp.RecordId >= %s ORDER BY rp.RecordId LIMIT %s", where, args.Add(req.LastRecordId), args.Add(req.MaxResults+1))
+	}
+	rows, err := m.eng.DatabaseHandle.Query(q, args.Values()...)
 	if err != nil {
-		log.Printf("failed to get headers string with err: %v", err)
+		log.Printf("failed to query RecordsProcessed with err: %v", err)
 		return http.StatusInternalServerError, &DataResponse{
 			Message: "INTERNAL SERVER ERROR",
 			Code:    http.StatusInternalServerError,
 		}
 	}
+	defer rows.Close()
 
-	// Get MinRecordId
-	minRecord := ds.MinRecordId
-	if req.LastRecordId > minRecord {
-		minRecord = req.LastRecordId
+	var recordIds []int64
+	var sortValues [][]sql.NullString
+	for rows.Next() {
+		var recordId int64
+		values := make([]sql.NullString, len(sortColumns))
+		dest := []any{&recordId}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("failed to Scan(RecordId) from RecordsProcessed with err: %v", err)
+			return http.StatusInternalServerError, &DataResponse{
+				Message: "INTERNAL SERVER ERROR",
+				Code:    http.StatusInternalServerError,
+			}
+		}
+		recordIds = append(recordIds, recordId)
+		sortValues = append(sortValues, values)
 	}
-
-	// Get MaxRecordId for this Block
-	row := m.eng.DatabaseHandle.QueryRow("SELECT MAX(tmp.RecordId) FROM (SELECT RecordId FROM Records WHERE RecordId > $1 AND DatasetId = $2 LIMIT $3) AS tmp", req.LastRecordId, ds.DatasetId, req.MaxResults)
-	var maxRecordId int64
-	if err := row.Scan(&maxRecordId); err != nil {
-		log.Printf("failed to get max record id with err: %v", err)
+	if err := rows.Err(); err != nil {
+		log.Printf("failed to read RecordsProcessed with err: %v", err)
 		return http.StatusInternalServerError, &DataResponse{
 			Message: "INTERNAL SERVER ERROR",
 			Code:    http.StatusInternalServerError,
 		}
 	}
 
+	hasNext := int64(len(recordIds)) > req.MaxResults
+	if hasNext {
+		recordIds = recordIds[:req.MaxResults]
+	}
+	if len(recordIds) == 0 {
+		return http.StatusOK, resp
+	}
+
 	// Return Block of data
-	limit := int64(len(headers)) * req.MaxResults
-	q := fmt.Sprintf("SELECT RecordId, HeaderId, RawValue FROM Cells WHERE %s AND RecordId >= %d AND RecordId <= %d ORDER BY RecordId, HeaderId  LIMIT %d", hs, minRecord, ds.MaxRecordId, limit)
-	rows, err := m.eng.DatabaseHandle.Query(q)
+	rowIndex := make(map[int64]int, len(recordIds))
+	for i, id := range recordIds {
+		rowIndex[id] = i
+		resp.Results = append(resp.Results, &ResultSet{
+			Data: make([]string, len(headers)),
+		})
+	}
+	colIndex := make(map[int64]int, len(headers))
+	headerIds := make([]int64, len(headers))
+	for i, h := range headers {
+		colIndex[h.HeaderId] = i
+		headerIds[i] = h.HeaderId
+	}
+
+	cells, err := m.eng.DatabaseHandle.Query("SELECT RecordId, HeaderId, COALESCE(RawValue, '') FROM Cells WHERE RecordId = ANY($1) AND HeaderId = ANY($2)", pq.Array(recordIds), pq.Array(headerIds))
 	if err != nil {
 		log.Printf("failed to build query for Cells with err: %v", err)
 		return http.StatusInternalServerError, &DataResponse{
@@ -585,47 +1363,76 @@ func (m *Manager) GetData(req *DataRequest) (int, *DataResponse) {
 			Code:    http.StatusInternalServerError,
 		}
 	}
-	defer rows.Close()
+	defer cells.Close()
 
-	prevRecordId := int64(-1)
-	for rows.Next() {
+	for cells.Next() {
 		var recordId int64
 		var headerId int64
 		var rv string
-		if err := rows.Scan(&recordId, &headerId, &rv); err != nil {
+		if err := cells.Scan(&recordId, &headerId, &rv); err != nil {
 			log.Printf("failed to Scan(RecordId, HeaderId, RawValue) from Cells with err: %v", err)
 			return http.StatusInternalServerError, &DataResponse{
 				Message: "INTERNAL SERVER ERROR",
 				Code:    http.StatusInternalServerError,
 			}
 		}
-
-		if prevRecordId != recordId {
-			resp.Results = append(resp.Results, &ResultSet{
-				Data: make([]string, 0),
-			})
-			prevRecordId = recordId
+		resp.Results[rowIndex[recordId]].Data[colIndex[headerId]] = rv
+	}
+	if err := cells.Err(); err != nil {
+		log.Printf("failed to read Cells with err: %v", err)
+		return http.StatusInternalServerError, &DataResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
 		}
-		resp.Results[len(resp.Results)-1].Data = append(resp.Results[len(resp.Results)-1].Data, rv)
 	}
 
 	// Populate the Next Page
-	if ds.MaxRecordId > maxRecordId {
-		baseUrl := fmt.Sprintf("/data/%d?recordid=%d", ds.DatasetId, maxRecordId+1)
+	if hasNext {
+		last := len(recordIds) - 1
+		baseUrl := fmt.Sprintf("/data/%d?recordid=%d&maxresults=%d", ds.DatasetId, recordIds[last]+1, req.MaxResults)
+		if req.Order != nil {
+			cursor := &query.Cursor{RecordId: recordIds[last]}
+			for i := range sortValues[last] {
+				var v *string
+				if sortValues[last][i].Valid {
+					v = &sortValues[last][i].String
+				}
+				cursor.Values = append(cursor.Values, v)
+			}
+			baseUrl = fmt.Sprintf("/data/%d?cursor=%s&maxresults=%d", ds.DatasetId, cursor.Encode(), req.MaxResults)
+		}
 		if hasExclusions {
-			baseUrl += "&headers="
 			var headerIds []string
 			for _, h := range headers {
-				headerIds = append(headerIds, fmt.Sprintf("%d", h.HeaderId))
+				headerIds = append(headerIds, strconv.FormatInt(h.HeaderId, 10))
 			}
-			baseUrl += fmt.Sprintf("%s", strings.Join(headerIds, ","))
+			baseUrl += "&headers=" + strings.Join(headerIds, ",")
+		}
+		if req.Where != nil {
+			baseUrl += "&filter=" + url.QueryEscape(req.Filter)
+		}
+		if req.Order != nil {
+			baseUrl += "&sort=" + url.QueryEscape(req.Sort)
 		}
 		resp.Next = baseUrl
 	}
 	return http.StatusOK, resp
 }
 
-func (m *Manager) deleteDataset(req *DeleteDataRequest, op *operation.Operation) {
+func (m *Manager) deleteDataset(ctx context.Context, req *DeleteDataRequest, op *operation.Operation) {
+	defer func() {
+		m.finish(op)
+		m.mu.Lock()
+		delete(m.del, req.DatasetId)
+		m.mu.Unlock()
+	}()
+
+	// Cancelled while queued
+	if ctx.Err() != nil {
+		op.MarkCancelled()
+		return
+	}
+
 	// Mark Operation Running
 	if err := op.MarkRunning(); err != nil {
 		log.Printf("failed to set operation running with err: %v", err)
@@ -633,76 +1440,51 @@ func (m *Manager) deleteDataset(req *DeleteDataRequest, op *operation.Operation)
 		return
 	}
 
-	// Create Tx
-	tx, err := m.eng.DatabaseHandle.Begin()
+	// Create Tx. Everything is deleted atomically, so a cancelled delete
+	// leaves the dataset untouched.
+	tx, err := m.eng.DatabaseHandle.BeginTx(ctx, nil)
 	if err != nil {
 		log.Printf("failed to create transaction with err: %v", err)
 		op.MarkFailed(fmt.Sprintf("failed to create tx with err: %v", err))
 		return
 	}
-	defer tx.Commit()
-
-	// Delete Cells
-	stmt, err := tx.Prepare("DELETE FROM CELLS Where CellId IN (SELECT CellId FROM (SELECT Records.RecordId AS RecordId, Cells.CellId AS CellId FROM Records, Cells WHERE Records.DatasetId = $1 AND Records.RecordId = Cells.RecordId ORDER BY Records.RecordId) AS Cells)")
-	if err != nil {
-		log.Printf("failed to create a delete cells stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to create cells stmt with err: %v", err))
-	}
-	if _, err := stmt.Exec(req.DatasetId); err != nil {
-		log.Printf("failed to Exec cells stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to delete cells with err: %v", err))
-	}
-
-	// Delete RecordsProcessed
-	stmt, err = tx.Prepare("DELETE FROM RecordsProcessed WHERE DatasetId = $1")
-	if err != nil {
-		log.Printf("failed to create a delete recordsprocessed stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to create recordsprocessed stmt with err: %v", err))
-	}
-	if _, err := stmt.Exec(req.DatasetId); err != nil {
-		log.Printf("failed to Exec recordsprocessed stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to delete recordsprocessed with err: %v", err))
-	}
-
-	// Delete Records
-	stmt, err = tx.Prepare("DELETE FROM Records WHERE DatasetId = $1")
-	if err != nil {
-		log.Printf("failed to create a delete records stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to create delete records stmt with err: %v", err))
-	}
-	if _, err := stmt.Exec(req.DatasetId); err != nil {
-		log.Printf("failed to Exec records stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to delete records with err: %v", err))
-	}
 
-	// Delete Headers
-	stmt, err = tx.Prepare("DELETE FROM Headers WHERE DatasetId = $1")
-	if err != nil {
-		log.Printf("failed to create a delete headers stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to create delete headers stmt with err: %v", err))
-	}
-	if _, err := stmt.Exec(req.DatasetId); err != nil {
-		log.Printf("failed to Exec headers stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to delete headers with err: %v", err))
+	stmts := []struct {
+		table string
+		query string
+	}{
+		{"cells", "DELETE FROM CELLS Where CellId IN (SELECT CellId FROM (SELECT Records.RecordId AS RecordId, Cells.CellId AS CellId FROM Records, Cells WHERE Records.DatasetId = $1 AND Records.RecordId = Cells.RecordId ORDER BY Records.RecordId) AS Cells)"},
+		{"recordsprocessed", "DELETE FROM RecordsProcessed WHERE DatasetId = $1"},
+		{"records", "DELETE FROM Records WHERE DatasetId = $1"},
+		{"headers", "DELETE FROM Headers WHERE DatasetId = $1"},
+		{"profiles", "DELETE FROM Profiles WHERE DatasetId = $1"},
+		{"datasets", "DELETE FROM Datasets WHERE DatasetId = $1"},
+	}
+	for _, st := range stmts {
+		if _, err := tx.ExecContext(ctx, st.query, req.DatasetId); err != nil {
+			tx.Rollback()
+			if ctx.Err() != nil {
+				log.Printf("/operation/%d cancelled", op.OperationId)
+				op.MarkCancelled()
+				return
+			}
+			log.Printf("failed to Exec delete %s stmt with err: %v", st.table, err)
+			op.MarkFailed(fmt.Sprintf("failed to delete %s with err: %v", st.table, err))
+			return
+		}
 	}
 
-	// Delete Datasets
-	stmt, err = tx.Prepare("DELETE FROM Datasets WHERE DatasetId = $1")
-	if err != nil {
-		log.Printf("failed to create a delete datasets stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to create delete datasets stmt with err: %v", err))
-	}
-	if _, err := stmt.Exec(req.DatasetId); err != nil {
-		log.Printf("failed to Exec delete dataset stmt with err: %v", err)
-		op.MarkFailed(fmt.Sprintf("failed to delete datasets with err: %v", err))
+	if err := tx.Commit(); err != nil {
+		log.Printf("failed to commit delete with err: %v", err)
+		op.MarkFailed(fmt.Sprintf("failed to commit delete with err: %v", err))
+		return
 	}
-
 	op.MarkSuccess()
 }
 
 func (m *Manager) DeleteDataset(req *DeleteDataRequest) (int, *DeleteDataResponse) {
 	// Get DatasetId
-	ds, err := dataset.GetDatasetFromId(m.eng, req.DatasetId)
+	ds, err := m.dataset(req.DatasetId)
 	if err != nil {
 		log.Printf("failed to GetDatasetFromId with err: %v", err)
 		return http.StatusInternalServerError, &DeleteDataResponse{
@@ -721,24 +1503,232 @@ func (m *Manager) DeleteDataset(req *DeleteDataRequest) (int, *DeleteDataRespons
 
 	// Check for existing deletion operation
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	if _, ok := m.del[req.DatasetId]; ok {
+		m.mu.Unlock()
 		return http.StatusNoContent, nil
 	}
+	m.del[req.DatasetId] = nil
+	m.mu.Unlock()
 
 	// Create Operation
-	op, err := operation.New(m.eng)
+	op, err := operation.New(m.eng, operation.WithType(operation.Type_DELETE), operation.WithDatasetId(ds.DatasetId))
 	if err != nil {
 		log.Printf("Failed to build create operation statement with error: %v", err)
+		m.mu.Lock()
+		delete(m.del, req.DatasetId)
+		m.mu.Unlock()
 		return http.StatusInternalServerError, &DeleteDataResponse{
 			Message: "INTERNAL SERVER ERROR",
 			Code:    http.StatusInternalServerError,
 		}
 	}
+	m.mu.Lock()
 	m.del[req.DatasetId] = op
+	m.mu.Unlock()
 
 	// Background delete
-	go m.deleteDataset(req, op)
+	if err := m.enqueueDelete(req, op); err != nil {
+		m.mu.Lock()
+		delete(m.del, req.DatasetId)
+		m.mu.Unlock()
+		if err == errQueueFull {
+			return http.StatusTooManyRequests, &DeleteDataResponse{
+				Message: "too many operations in progress, try again later",
+				Code:    http.StatusTooManyRequests,
+			}
+		}
+		log.Printf("Failed to queue delete with error: %v", err)
+		return http.StatusInternalServerError, &DeleteDataResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
 
 	return http.StatusNoContent, nil
 }
+
+func (m *Manager) GetOperation(req *GetOperationRequest) (int, *GetOperationResponse) {
+	op, err := operation.GetOperationFromId(m.eng, req.OperationId)
+	if err != nil {
+		log.Printf("Query for Operation failed with error: %v", err)
+		return http.StatusInternalServerError, &GetOperationResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	// We should 404, because operation was not found and err was nil.
+	if op == nil {
+		return http.StatusNotFound, &GetOperationResponse{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("failed to find operation with id: %d", req.OperationId),
+		}
+	}
+
+	return http.StatusOK, &GetOperationResponse{
+		Operation: op,
+		Code:      http.StatusOK,
+	}
+}
+
+func (m *Manager) ListOperations(req *ListOperationsRequest) (int, *ListOperationsResponse) {
+	var filters []operation.Filter
+	if len(req.Statuses) > 0 {
+		filters = append(filters, operation.FilterByStatus(req.Statuses...))
+	}
+	if req.DatasetId > 0 {
+		filters = append(filters, operation.FilterByDataset(req.DatasetId))
+	}
+
+	results, err := operation.GetOperations(m.eng, req.MaxOperations, filters...)
+	if err != nil {
+		log.Printf("Failed to get operations with error: %v", err)
+		return http.StatusInternalServerError, &ListOperationsResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return http.StatusOK, &ListOperationsResponse{
+		Results: results,
+		Code:    http.StatusOK,
+	}
+}
+
+func (m *Manager) CancelOperation(req *CancelOperationRequest) (int, *CancelOperationResponse) {
+	op, err := operation.GetOperationFromId(m.eng, req.OperationId)
+	if err != nil {
+		log.Printf("Query for Operation failed with error: %v", err)
+		return http.StatusInternalServerError, &CancelOperationResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	// We should 404, because operation was not found and err was nil.
+	if op == nil {
+		return http.StatusNotFound, &CancelOperationResponse{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("failed to find operation with id: %d", req.OperationId),
+		}
+	}
+
+	if op.Complete() {
+		return http.StatusConflict, &CancelOperationResponse{
+			Operation: op,
+			Code:      http.StatusConflict,
+			Message:   fmt.Sprintf("operation %d has already completed", req.OperationId),
+		}
+	}
+
+	m.mu.RLock()
+	t, ok := m.running[op.OperationId]
+	m.mu.RUnlock()
+
+	// Queued operations are taken off the queue, so they don't hold their
+	// slot until a worker gets to them.
+	queued := ok && m.dequeue(op.OperationId)
+	if queued {
+		op = t.op
+	}
+
+	// The goroutine running op marks it CANCELLED once it has stopped and
+	// cleaned up. Operations that nothing is running can be marked directly.
+	if ok && !queued {
+		t.cancel()
+	} else if err := op.MarkCancelled(); err != nil {
+		log.Printf("Failed to mark operation cancelled with error: %v", err)
+		return http.StatusInternalServerError, &CancelOperationResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	return http.StatusOK, &CancelOperationResponse{
+		Operation: op,
+		Code:      http.StatusOK,
+	}
+}
+
+// watchInterval is how often WatchOperation polls for operations that are not
+// running on this server.
+const watchInterval = time.Second
+
+func (m *Manager) WatchOperation(req *GetOperationRequest) (int, *WatchOperationResponse) {
+	// Operations running on this server publish their own updates.
+	m.mu.RLock()
+	t, ok := m.running[req.OperationId]
+	m.mu.RUnlock()
+	if ok {
+		events, stop := t.op.Subscribe()
+		return http.StatusOK, &WatchOperationResponse{
+			Events: events,
+			Stop:   stop,
+			Code:   http.StatusOK,
+		}
+	}
+
+	op, err := operation.GetOperationFromId(m.eng, req.OperationId)
+	if err != nil {
+		log.Printf("Query for Operation failed with error: %v", err)
+		return http.StatusInternalServerError, &WatchOperationResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	// We should 404, because operation was not found and err was nil.
+	if op == nil {
+		return http.StatusNotFound, &WatchOperationResponse{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("failed to find operation with id: %d", req.OperationId),
+		}
+	}
+
+	// Otherwise poll the database until the operation completes.
+	events := make(chan operation.Event)
+	done := make(chan bool)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		last := op.Event()
+		for {
+			select {
+			case events <- last:
+			case <-done:
+				return
+			}
+			if last.Complete() {
+				return
+			}
+
+			// Wait for the next change
+			for {
+				select {
+				case <-ticker.C:
+				case <-done:
+					return
+				}
+				op, err := operation.GetOperationFromId(m.eng, req.OperationId)
+				if err != nil || op == nil {
+					log.Printf("failed to poll operation %d with err: %v", req.OperationId, err)
+					return
+				}
+				if e := op.Event(); e != last {
+					last = e
+					break
+				}
+			}
+		}
+	}()
+
+	return http.StatusOK, &WatchOperationResponse{
+		Events: events,
+		Stop: func() {
+			close(done)
+		},
+		Code: http.StatusOK,
+	}
+}
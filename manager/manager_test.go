@@ -0,0 +1,59 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/manager"
+	"github.com/dantespe/spectacle/operation"
+	spectesting "github.com/dantespe/spectacle/testing"
+)
+
+func TestRecover(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+
+	// An upload that was interrupted after inserting a record
+	op, err := operation.New(tmp.Engine, operation.WithType(operation.Type_UPLOAD), operation.WithDatasetId(ds.DatasetId))
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	if err := op.MarkRunning(); err != nil {
+		t.Fatalf("failed to set status to running: %v", err)
+	}
+	if _, err := tmp.Engine.DatabaseHandle.Exec("INSERT INTO Records(OperationId, DatasetId) VALUES($1, $2)", op.OperationId, ds.DatasetId); err != nil {
+		t.Fatalf("failed to insert record with err: %v", err)
+	}
+
+	mgr, err := manager.NewWithEngine(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create manager with err: %v", err)
+	}
+	if err := mgr.Recover(); err != nil {
+		t.Fatalf("got unexpected error for Recover(): %v", err)
+	}
+
+	got, err := operation.GetOperationFromId(tmp.Engine, op.OperationId)
+	if err != nil {
+		t.Fatalf("failed to GetOperationFromId(%d) with err: %v", op.OperationId, err)
+	}
+	if got.OperationStatus != operation.Status_FAILED {
+		t.Errorf("got Status %s, want: %s", got.OperationStatus, operation.Status_FAILED)
+	}
+
+	var records int64
+	if err := tmp.Engine.DatabaseHandle.QueryRow("SELECT COUNT(*) FROM Records WHERE OperationId = $1", op.OperationId).Scan(&records); err != nil {
+		t.Fatalf("failed to count records with err: %v", err)
+	}
+	if records != 0 {
+		t.Errorf("got %d records for recovered operation, want: 0", records)
+	}
+}
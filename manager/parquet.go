@@ -0,0 +1,533 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// parquetMagic starts and ends every Parquet file.
+var parquetMagic = []byte("PAR1")
+
+// isParquet reports whether sample is the start of a Parquet file.
+func isParquet(sample []byte) bool {
+	return bytes.HasPrefix(sample, parquetMagic)
+}
+
+// parquetKind is how the values of a Parquet column are written as text,
+// from its logical type.
+type parquetKind int
+
+const (
+	parquetPlain parquetKind = iota
+	parquetUnsigned
+	parquetDecimal
+	parquetDate
+	parquetTime
+	parquetTimestamp
+	parquetInt96
+	parquetUUID
+)
+
+// parquetColumn is a leaf column of a Parquet file.
+type parquetColumn struct {
+	name string
+	el   *parquet.SchemaElement
+	kind parquetKind
+
+	// unit of TIME and TIMESTAMP values.
+	unit time.Duration
+	// scale of DECIMAL values.
+	scale int
+
+	// maxDL is the definition level of a value that isn't null.
+	maxDL int32
+	// repDL is the definition level of an element of the column's innermost
+	// repeated field, or 0 if the column isn't repeated.
+	repDL int32
+}
+
+// parquetReader reads the rows of a Parquet file. Rows are read a batch at a
+// time, each column from its own position in the file, so only the pages of
+// the current row group are held in memory.
+//
+// The first row read holds the names of the columns. Fields of nested
+// groups are named by their dotted path, and repeated fields are read as a
+// JSON array of their values in each row.
+type parquetReader struct {
+	r       *reader.ParquetReader
+	columns []*parquetColumn
+	numRows int64
+
+	// started is true once the header row has been read.
+	started bool
+	// read is the number of rows read from the file.
+	read int64
+	// rows are the rows of the current batch not yet returned.
+	rows [][]string
+}
+
+// openParquet opens the Parquet file ra of size bytes.
+func openParquet(ra io.ReaderAt, size int64) (pr *parquetReader, err error) {
+	defer recoverParquet(&err)
+	tail := make([]byte, len(parquetMagic))
+	if size < 2*int64(len(parquetMagic)) {
+		return nil, fmt.Errorf("invalid Parquet file: too short")
+	}
+	if _, err := ra.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return nil, fmt.Errorf("invalid Parquet file: %v", err)
+	}
+	if !bytes.Equal(tail, parquetMagic) {
+		return nil, fmt.Errorf("invalid Parquet file: missing footer")
+	}
+
+	r, err := reader.NewParquetColumnReader(newParquetFile(ra, size), 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Parquet file: %v", err)
+	}
+	// The reader renames the schema's fields as Go identifiers
+	names := make([]string, len(r.SchemaHandler.Infos))
+	for i, info := range r.SchemaHandler.Infos {
+		names[i] = info.ExName
+	}
+	columns, err := parquetColumns(r.Footer.GetSchema(), names)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != len(r.SchemaHandler.ValueColumns) {
+		return nil, fmt.Errorf("invalid Parquet file: schema has %d columns, want: %d", len(columns), len(r.SchemaHandler.ValueColumns))
+	}
+	return &parquetReader{
+		r:       r,
+		columns: columns,
+		numRows: r.GetNumRows(),
+	}, nil
+}
+
+// recoverParquet turns a panic while decoding a malformed file into *err.
+func recoverParquet(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("invalid Parquet file: %v", r)
+	}
+}
+
+// parquetColumns returns the leaf columns of schema, whose fields are named
+// names, in order. The repeated groups of LISTs and MAPs, and the element of
+// a LIST, are left out of column names, so a list of strings "tags" is a
+// "tags" column.
+func parquetColumns(schema []*parquet.SchemaElement, names []string) ([]*parquetColumn, error) {
+	var columns []*parquetColumn
+	var walk func(i int, path []string, hide int, dl, repDL int32) (int, error)
+	walk = func(i int, path []string, hide int, dl, repDL int32) (int, error) {
+		if i >= len(schema) || i >= len(names) {
+			return 0, fmt.Errorf("invalid Parquet file: truncated schema")
+		}
+		el := schema[i]
+		if i > 0 {
+			switch el.GetRepetitionType() {
+			case parquet.FieldRepetitionType_OPTIONAL:
+				dl++
+			case parquet.FieldRepetitionType_REPEATED:
+				dl++
+				repDL = dl
+			}
+		}
+		if hide > 0 {
+			hide--
+		} else {
+			path = append(path, names[i])
+		}
+
+		if el.GetNumChildren() == 0 {
+			if i == 0 {
+				return 0, fmt.Errorf("invalid Parquet file: no columns")
+			}
+			c := &parquetColumn{
+				name:  strings.Join(path, "."),
+				el:    el,
+				maxDL: dl,
+				repDL: repDL,
+			}
+			c.setKind()
+			columns = append(columns, c)
+			return i + 1, nil
+		}
+
+		lt, ct := el.GetLogicalType(), el.GetConvertedType()
+		switch {
+		case (lt != nil && lt.IsSetLIST()) || (el.IsSetConvertedType() && ct == parquet.ConvertedType_LIST):
+			hide = 2
+		case (lt != nil && lt.IsSetMAP()) || (el.IsSetConvertedType() && (ct == parquet.ConvertedType_MAP || ct == parquet.ConvertedType_MAP_KEY_VALUE)):
+			hide = 1
+		}
+		next := i + 1
+		for n := int32(0); n < el.GetNumChildren(); n++ {
+			var err error
+			if next, err = walk(next, append([]string{}, path...), hide, dl, repDL); err != nil {
+				return 0, err
+			}
+		}
+		return next, nil
+	}
+
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("invalid Parquet file: no schema")
+	}
+	// The root is the schema itself, not a column
+	if _, err := walk(0, nil, 1, 0, 0); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// setKind sets how the column's values are written, from its logical type
+// or, in older files, its converted type.
+func (c *parquetColumn) setKind() {
+	el := c.el
+	if el.GetType() == parquet.Type_INT96 {
+		c.kind = parquetInt96
+		return
+	}
+
+	if lt := el.GetLogicalType(); lt != nil {
+		switch {
+		case lt.IsSetINTEGER():
+			if !lt.INTEGER.IsSigned {
+				c.kind = parquetUnsigned
+			}
+			return
+		case lt.IsSetDECIMAL():
+			c.kind, c.scale = parquetDecimal, int(lt.DECIMAL.Scale)
+			return
+		case lt.IsSetDATE():
+			c.kind = parquetDate
+			return
+		case lt.IsSetTIME():
+			c.kind, c.unit = parquetTime, parquetUnit(lt.TIME.GetUnit())
+			return
+		case lt.IsSetTIMESTAMP():
+			c.kind, c.unit = parquetTimestamp, parquetUnit(lt.TIMESTAMP.GetUnit())
+			return
+		case lt.IsSetUUID():
+			c.kind = parquetUUID
+			return
+		}
+	}
+
+	if !el.IsSetConvertedType() {
+		return
+	}
+	switch el.GetConvertedType() {
+	case parquet.ConvertedType_UINT_8, parquet.ConvertedType_UINT_16, parquet.ConvertedType_UINT_32, parquet.ConvertedType_UINT_64:
+		c.kind = parquetUnsigned
+	case parquet.ConvertedType_DECIMAL:
+		c.kind, c.scale = parquetDecimal, int(el.GetScale())
+	case parquet.ConvertedType_DATE:
+		c.kind = parquetDate
+	case parquet.ConvertedType_TIME_MILLIS:
+		c.kind, c.unit = parquetTime, time.Millisecond
+	case parquet.ConvertedType_TIME_MICROS:
+		c.kind, c.unit = parquetTime, time.Microsecond
+	case parquet.ConvertedType_TIMESTAMP_MILLIS:
+		c.kind, c.unit = parquetTimestamp, time.Millisecond
+	case parquet.ConvertedType_TIMESTAMP_MICROS:
+		c.kind, c.unit = parquetTimestamp, time.Microsecond
+	}
+}
+
+// parquetUnit returns the duration of a Parquet TimeUnit.
+func parquetUnit(u *parquet.TimeUnit) time.Duration {
+	switch {
+	case u == nil:
+		return time.Millisecond
+	case u.IsSetMICROS():
+		return time.Microsecond
+	case u.IsSetNANOS():
+		return time.Nanosecond
+	}
+	return time.Millisecond
+}
+
+// valueType returns the ValueType of the column's values, or
+// header.ValueType_RAW if it should be inferred from them.
+func (c *parquetColumn) valueType() header.ValueType {
+	if c.repDL > 0 {
+		return header.ValueType_RAW
+	}
+	switch c.kind {
+	case parquetUnsigned:
+		// Unsigned 64-bit values may not fit an INT
+		if c.el.GetType() == parquet.Type_INT64 {
+			return header.ValueType_RAW
+		}
+		return header.ValueType_INT
+	case parquetDecimal:
+		return header.ValueType_FLOAT
+	case parquetDate:
+		return header.ValueType_DATE
+	case parquetTimestamp, parquetInt96:
+		return header.ValueType_TIMESTAMP
+	case parquetTime, parquetUUID:
+		return header.ValueType_STRING
+	}
+	switch c.el.GetType() {
+	case parquet.Type_BOOLEAN:
+		return header.ValueType_BOOL
+	case parquet.Type_INT32, parquet.Type_INT64:
+		return header.ValueType_INT
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		return header.ValueType_FLOAT
+	}
+	return header.ValueType_STRING
+}
+
+// text returns the value v of the column as text, in the layouts that
+// header.ValueType.Parse reads.
+func (c *parquetColumn) text(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		if c.kind == parquetUnsigned {
+			return strconv.FormatUint(uint64(uint32(v)), 10)
+		}
+		return c.int(int64(v))
+	case int64:
+		if c.kind == parquetUnsigned {
+			return strconv.FormatUint(uint64(v), 10)
+		}
+		return c.int(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return c.bytes(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *parquetColumn) int(v int64) string {
+	switch c.kind {
+	case parquetDecimal:
+		return decimal(big.NewInt(v), c.scale)
+	case parquetDate:
+		return time.Unix(v*24*60*60, 0).UTC().Format("2006-01-02")
+	case parquetTime:
+		return time.Time{}.Add(time.Duration(v) * c.unit).Format("15:04:05.999999999")
+	case parquetTimestamp:
+		var t time.Time
+		switch c.unit {
+		case time.Millisecond:
+			t = time.UnixMilli(v)
+		case time.Microsecond:
+			t = time.UnixMicro(v)
+		default:
+			t = time.Unix(0, v)
+		}
+		return t.UTC().Format("2006-01-02 15:04:05.999999999")
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func (c *parquetColumn) bytes(v string) string {
+	switch c.kind {
+	case parquetDecimal:
+		// Big-endian two's complement
+		d := new(big.Int).SetBytes([]byte(v))
+		if len(v) > 0 && v[0]&0x80 != 0 {
+			d.Sub(d, new(big.Int).Lsh(big.NewInt(1), uint(8*len(v))))
+		}
+		return decimal(d, c.scale)
+	case parquetInt96:
+		return types.INT96ToTime(v).UTC().Format("2006-01-02 15:04:05.999999999")
+	case parquetUUID:
+		if len(v) == 16 {
+			b := []byte(v)
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+		}
+	}
+	// Binary values that aren't text are written as base64
+	if !utf8.ValidString(v) {
+		return base64.StdEncoding.EncodeToString([]byte(v))
+	}
+	return v
+}
+
+// decimal returns the unscaled DECIMAL value v, with scale digits after the
+// decimal point.
+func decimal(v *big.Int, scale int) string {
+	s := new(big.Int).Abs(v).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// element returns the value v of the column as an element of a JSON array.
+func (c *parquetColumn) element(v any) string {
+	s := c.text(v)
+	switch c.el.GetType() {
+	case parquet.Type_BOOLEAN, parquet.Type_INT32, parquet.Type_INT64:
+		if c.kind == parquetPlain || c.kind == parquetUnsigned {
+			return s
+		}
+	case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return s
+		}
+	}
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// fill sets the j-th value of each of rows from a batch of the column's
+// values and their repetition and definition levels.
+func (c *parquetColumn) fill(rows [][]string, j int, values []any, rls, dls []int32) error {
+	r := -1
+	var elems []string
+	flush := func() {
+		if r >= 0 && elems != nil {
+			rows[r][j] = "[" + strings.Join(elems, ",") + "]"
+		}
+	}
+	for k, v := range values {
+		if rls[k] == 0 {
+			flush()
+			elems = nil
+			if r++; r >= len(rows) {
+				return fmt.Errorf("invalid Parquet file: column %q has more than %d rows", c.name, len(rows))
+			}
+		}
+		if r < 0 {
+			return fmt.Errorf("invalid Parquet file: column %q starts with a repeated value", c.name)
+		}
+		switch {
+		case c.repDL == 0:
+			if dls[k] == c.maxDL {
+				rows[r][j] = c.text(v)
+			}
+		case dls[k] == c.maxDL:
+			elems = append(elems, c.element(v))
+		case dls[k] >= c.repDL:
+			elems = append(elems, "null")
+		}
+	}
+	flush()
+	if r+1 != len(rows) {
+		return fmt.Errorf("invalid Parquet file: column %q has %d rows, want: %d", c.name, r+1, len(rows))
+	}
+	return nil
+}
+
+func (pr *parquetReader) Read() ([]string, error) {
+	if !pr.started {
+		pr.started = true
+		names := make([]string, len(pr.columns))
+		for i, c := range pr.columns {
+			names[i] = c.name
+		}
+		return names, nil
+	}
+	if len(pr.rows) == 0 {
+		if err := pr.next(); err != nil {
+			return nil, err
+		}
+	}
+	row := pr.rows[0]
+	pr.rows = pr.rows[1:]
+	return row, nil
+}
+
+// columnType returns the ValueType declared by the schema of the i-th
+// column.
+func (pr *parquetReader) columnType(i int) header.ValueType {
+	return pr.columns[i].valueType()
+}
+
+// next reads the next batch of rows.
+func (pr *parquetReader) next() (err error) {
+	defer recoverParquet(&err)
+	n := pr.numRows - pr.read
+	if n <= 0 {
+		return io.EOF
+	}
+	if n > ingestBatchSize {
+		n = ingestBatchSize
+	}
+
+	rows := make([][]string, n)
+	for i := range rows {
+		rows[i] = make([]string, len(pr.columns))
+	}
+	for j, c := range pr.columns {
+		values, rls, dls, err := pr.r.ReadColumnByIndex(int64(j), n)
+		if err != nil {
+			return fmt.Errorf("failed to read column %q with err: %v", c.name, err)
+		}
+		if err := c.fill(rows, j, values, rls, dls); err != nil {
+			return err
+		}
+	}
+	pr.read += n
+	pr.rows = rows
+	return nil
+}
+
+// parquetFile is a read-only source.ParquetFile over an io.ReaderAt. The
+// reader opens a parquetFile for each column, so each reads the file from
+// its own offset.
+type parquetFile struct {
+	*io.SectionReader
+	ra   io.ReaderAt
+	size int64
+}
+
+func newParquetFile(ra io.ReaderAt, size int64) *parquetFile {
+	return &parquetFile{
+		SectionReader: io.NewSectionReader(ra, 0, size),
+		ra:            ra,
+		size:          size,
+	}
+}
+
+func (pf *parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name != "" {
+		return nil, fmt.Errorf("columns in other files are not supported: %q", name)
+	}
+	return newParquetFile(pf.ra, pf.size), nil
+}
+
+func (*parquetFile) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("parquetFile is read only")
+}
+
+func (*parquetFile) Write([]byte) (int, error) {
+	return 0, errors.New("parquetFile is read only")
+}
+
+func (*parquetFile) Close() error {
+	return nil
+}
@@ -0,0 +1,193 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+type testTeam struct {
+	Team    string  `parquet:"name=team, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Wins    *int32  `parquet:"name=wins, type=INT32, repetitiontype=OPTIONAL"`
+	Pct     float64 `parquet:"name=pct, type=DOUBLE"`
+	Founded int32   `parquet:"name=founded, type=INT32, convertedtype=DATE"`
+	Updated int64   `parquet:"name=updated, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Payroll int64   `parquet:"name=payroll, type=INT64, convertedtype=DECIMAL, scale=2, precision=18"`
+	Active  bool    `parquet:"name=active, type=BOOLEAN"`
+	Coach   struct {
+		Name string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	} `parquet:"name=coach"`
+	Titles []int32 `parquet:"name=titles, type=LIST, valuetype=INT32"`
+}
+
+// testParquet returns a Parquet file of rows, in row groups of about
+// rowGroupSize bytes and small pages.
+func testParquet[T any](t *testing.T, rows []T, rowGroupSize int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	pw, err := writer.NewParquetWriterFromWriter(&buf, new(T), 1)
+	if err != nil {
+		t.Fatalf("NewParquetWriterFromWriter() failed with err: %v", err)
+	}
+	pw.RowGroupSize = rowGroupSize
+	pw.PageSize = 1024
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			t.Fatalf("Write() failed with err: %v", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatalf("WriteStop() failed with err: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetReader(t *testing.T) {
+	wins := int32(64)
+	celtics := testTeam{
+		Team:    "Celtics",
+		Wins:    &wins,
+		Pct:     0.78,
+		Founded: int32(time.Date(1946, 6, 6, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)),
+		Updated: time.Date(2024, 4, 14, 19, 30, 0, 500e6, time.UTC).UnixMilli(),
+		Payroll: 18512345,
+		Active:  true,
+		Titles:  []int32{2008, 2024},
+	}
+	celtics.Coach.Name = "Joe Mazzulla"
+	file := testParquet(t, []testTeam{celtics, {Team: "Lakers"}}, 128*1024*1024)
+
+	pr, err := openParquet(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("openParquet() failed with err: %v", err)
+	}
+	want := [][]string{
+		{"team", "wins", "pct", "founded", "updated", "payroll", "active", "coach.name", "titles"},
+		{"Celtics", "64", "0.78", "1946-06-06", "2024-04-14 19:30:00.5", "185123.45", "true", "Joe Mazzulla", "[2008,2024]"},
+		{"Lakers", "", "0", "1970-01-01", "1970-01-01 00:00:00", "0.00", "false", "", ""},
+	}
+	if diff := cmp.Diff(want, readAll(t, pr)); diff != "" {
+		t.Errorf("got diff (-want +got): %s", diff)
+	}
+
+	wantTypes := []header.ValueType{
+		header.ValueType_STRING,
+		header.ValueType_INT,
+		header.ValueType_FLOAT,
+		header.ValueType_DATE,
+		header.ValueType_TIMESTAMP,
+		header.ValueType_FLOAT,
+		header.ValueType_BOOL,
+		header.ValueType_STRING,
+		header.ValueType_RAW,
+	}
+	for i, want := range wantTypes {
+		if got := pr.columnType(i); got != want {
+			t.Errorf("columnType(%d) = %q, want: %q", i, got, want)
+		}
+	}
+
+	// Each value parses as its column's type
+	for _, row := range want[1:] {
+		for i, v := range row {
+			if v == "" {
+				continue
+			}
+			if vt := wantTypes[i]; vt != header.ValueType_RAW {
+				if _, err := vt.Parse(v); err != nil {
+					t.Errorf("%s.Parse(%q) failed with err: %v", vt, v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestParquetReaderRowGroups(t *testing.T) {
+	type testRow struct {
+		Id   int64  `parquet:"name=id, type=INT64"`
+		Name string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	}
+	n := 2*ingestBatchSize + 10
+	var rows []testRow
+	for i := 0; i < n; i++ {
+		rows = append(rows, testRow{Id: int64(i), Name: fmt.Sprintf("row %d", i)})
+	}
+	file := testParquet(t, rows, 4*1024)
+
+	pr, err := openParquet(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("openParquet() failed with err: %v", err)
+	}
+	if groups := len(pr.r.Footer.GetRowGroups()); groups < 2 {
+		t.Fatalf("got %d row groups, want more than 1", groups)
+	}
+	got := readAll(t, pr)
+	if len(got) != n+1 {
+		t.Fatalf("got %d rows, want: %d", len(got), n+1)
+	}
+	for i, row := range got[1:] {
+		if want := []string{fmt.Sprint(i), fmt.Sprintf("row %d", i)}; !cmp.Equal(row, want) {
+			t.Fatalf("row %d = %q, want: %q", i, row, want)
+		}
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	resp := &DataResponse{
+		Headers: []*header.Header{
+			{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+			{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+			{HeaderId: 12, DisplayName: "OPENED", ValueType: header.ValueType_DATE},
+			{HeaderId: 14, DisplayName: "UPDATED", ValueType: header.ValueType_TIMESTAMP},
+		},
+		Results: []*ResultSet{
+			{Data: []string{"Boston", "18624", "1995-09-30", "2024-04-14 19:30:00"}},
+			{Data: []string{"New York, NY", "", "", ""}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := resp.Export(ExportFormat_PARQUET, &buf); err != nil {
+		t.Fatalf("got unexpected error for Export(): %v", err)
+	}
+
+	pr, err := openParquet(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("openParquet() failed with err: %v", err)
+	}
+	want := [][]string{
+		{"CITY", "ARENACAPACITY", "OPENED", "UPDATED"},
+		{"Boston", "18624", "1995-09-30", "2024-04-14 19:30:00"},
+		{"New York, NY", "", "", ""},
+	}
+	if diff := cmp.Diff(want, readAll(t, pr)); diff != "" {
+		t.Errorf("got diff (-want +got): %s", diff)
+	}
+	for i, h := range resp.Headers {
+		if got := pr.columnType(i); got != h.ValueType {
+			t.Errorf("columnType(%d) = %q, want: %q", i, got, h.ValueType)
+		}
+	}
+}
+
+func TestOpenParquetErrors(t *testing.T) {
+	for _, input := range []string{"", "a,b\n1,2\n", "PAR1", "PAR1garbagePAR1", "PAR1\x00\x00\x00\x00\x04\x00\x00\x00PAR1"} {
+		if _, err := openParquet(bytes.NewReader([]byte(input)), int64(len(input))); err == nil {
+			t.Errorf("openParquet(%q) expected error", input)
+		}
+	}
+}
+
+func TestDetectUploadFormatParquet(t *testing.T) {
+	if got := detectUploadFormat([]byte("PAR1\x15\x04"), DefaultDialect()); got != UploadFormat_PARQUET {
+		t.Errorf("detectUploadFormat() = %q, want: %q", got, UploadFormat_PARQUET)
+	}
+	if got := uploadFormatOf("application/vnd.apache.parquet"); got != UploadFormat_PARQUET {
+		t.Errorf("uploadFormatOf() = %q, want: %q", got, UploadFormat_PARQUET)
+	}
+}
@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/operation"
+	"github.com/dantespe/spectacle/profile"
+)
+
+// GetProfile returns the profile of a dataset. Profiles are cached until the
+// data changes; if it has, a PROFILE operation is started (or the one already
+// running is returned) and the response is 202 Accepted.
+func (m *Manager) GetProfile(req *GetProfileRequest) (int, *GetProfileResponse) {
+	ds, err := m.dataset(req.DatasetId)
+	if err != nil {
+		log.Printf("Query for Dataset failed with error: %v", err)
+		return http.StatusInternalServerError, &GetProfileResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if ds == nil {
+		return http.StatusNotFound, &GetProfileResponse{
+			Message: fmt.Sprintf("failed to find dataset with id: %d", req.DatasetId),
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	p, err := profile.Get(m.eng, ds.DatasetId)
+	if err != nil {
+		log.Printf("Failed to get profile with error: %v", err)
+		return http.StatusInternalServerError, &GetProfileResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if p.Current(ds) {
+		return http.StatusOK, &GetProfileResponse{
+			Profile: p,
+			Code:    http.StatusOK,
+		}
+	}
+
+	op, err := m.enqueueProfile(ds.DatasetId)
+	if err != nil {
+		if err == errQueueFull {
+			return http.StatusTooManyRequests, &GetProfileResponse{
+				Message: "too many operations in progress, try again later",
+				Code:    http.StatusTooManyRequests,
+			}
+		}
+		log.Printf("Failed to queue profile with error: %v", err)
+		return http.StatusInternalServerError, &GetProfileResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	return http.StatusAccepted, &GetProfileResponse{
+		OperationUrl: fmt.Sprintf("/operation/%d", op.OperationId),
+		Code:         http.StatusAccepted,
+	}
+}
+
+// enqueueProfile queues a PROFILE operation for a dataset, unless one is
+// already queued or running on this server, in which case that is returned.
+// No operation is created when the queue is full, as profiles are recomputed
+// when they are next requested.
+func (m *Manager) enqueueProfile(datasetId int64) (*operation.Operation, error) {
+	m.mu.Lock()
+	if op, ok := m.prof[datasetId]; ok {
+		m.mu.Unlock()
+		return op, nil
+	}
+	if m.jobs.full() {
+		m.mu.Unlock()
+		return nil, errQueueFull
+	}
+	op, err := operation.New(m.eng, operation.WithType(operation.Type_PROFILE), operation.WithDatasetId(datasetId))
+	if err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.prof[datasetId] = op
+	m.mu.Unlock()
+
+	ctx := m.start(op)
+	if err := m.enqueue(op, datasetId, func() {
+		m.processProfile(ctx, op, datasetId)
+	}); err != nil {
+		m.mu.Lock()
+		delete(m.prof, datasetId)
+		m.mu.Unlock()
+		return nil, err
+	}
+	return op, nil
+}
+
+// processProfile computes and caches the profile of a dataset.
+func (m *Manager) processProfile(ctx context.Context, op *operation.Operation, datasetId int64) {
+	defer func() {
+		m.finish(op)
+		m.mu.Lock()
+		delete(m.prof, datasetId)
+		m.mu.Unlock()
+	}()
+
+	// Cancelled while queued
+	if ctx.Err() != nil {
+		op.MarkCancelled()
+		return
+	}
+
+	if err := op.MarkRunning(); err != nil {
+		log.Printf("MarkRunning failed with error: %v", err)
+		return
+	}
+
+	// Read the dataset again, it may have changed while queued
+	ds, err := dataset.GetDatasetFromId(m.eng, datasetId)
+	if err != nil {
+		op.MarkFailed(fmt.Sprintf("failed to get dataset with err: %v", err))
+		return
+	}
+	if ds == nil {
+		op.MarkFailed(fmt.Sprintf("failed to find dataset with id: %d", datasetId))
+		return
+	}
+
+	p, err := profile.Compute(ctx, m.eng, ds)
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("/operation/%d cancelled", op.OperationId)
+			op.MarkCancelled()
+			return
+		}
+		log.Printf("/operation/%d failed with err: %v", op.OperationId, err)
+		op.MarkFailed(fmt.Sprintf("failed to profile dataset with err: %v", err))
+		return
+	}
+	if err := p.Save(m.eng); err != nil {
+		op.MarkFailed(err.Error())
+		return
+	}
+	op.MarkSuccess()
+}
@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dantespe/spectacle/operation"
+)
+
+// progressInterval is how often upload progress is saved to the Operation.
+const progressInterval = 2 * time.Second
+
+// progress tracks how far an upload has got. Counters are updated by the
+// goroutine processing the upload and saved by report.
+type progress struct {
+	op         *operation.Operation
+	totalBytes int64
+
+	mu    sync.Mutex
+	phase operation.Phase
+
+	bytesRead atomic.Int64
+	rows      atomic.Int64
+	totalRows atomic.Int64
+}
+
+func newProgress(op *operation.Operation, totalBytes int64) *progress {
+	return &progress{
+		op:         op,
+		totalBytes: totalBytes,
+	}
+}
+
+// setPhase moves to phase. The upload is read once, so bytes read carry over
+// between phases.
+func (p *progress) setPhase(phase operation.Phase) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase = phase
+}
+
+// reader counts the bytes read from rd, the upload from its start.
+func (p *progress) reader(rd io.Reader) io.Reader {
+	return &countingReader{r: rd, n: &p.bytesRead}
+}
+
+// readerAt counts the bytes read from ra, the upload. Bytes are counted
+// once, however many times they are read by it and by reader.
+func (p *progress) readerAt(ra io.ReaderAt) io.ReaderAt {
+	return &countingReaderAt{r: ra, n: &p.bytesRead}
+}
+
+// addRows counts n rows as written.
+func (p *progress) addRows(n int64) {
+	p.rows.Add(n)
+}
+
+// setTotalRows records the exact number of rows in the upload.
+func (p *progress) setTotalRows(n int64) {
+	p.totalRows.Store(n)
+}
+
+func (p *progress) snapshot() operation.Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := operation.Progress{
+		Phase:         p.phase,
+		BytesRead:     p.bytesRead.Load(),
+		RowsProcessed: p.rows.Load(),
+		TotalRows:     p.totalRows.Load(),
+	}
+
+	if p.phase == operation.Phase_RECORDS || p.phase == operation.Phase_CELLS {
+		switch {
+		case s.TotalRows > 0:
+			// Files that record their number of rows, e.g. Parquet, may not
+			// be read in order.
+			s.PercentComplete = 100 * float64(s.RowsProcessed) / float64(s.TotalRows)
+		case p.totalBytes > 0:
+			// Extrapolate the number of rows from how much of the file we've seen.
+			if s.BytesRead > 0 {
+				s.TotalRows = s.RowsProcessed * p.totalBytes / s.BytesRead
+			}
+			s.PercentComplete = 100 * float64(s.BytesRead) / float64(p.totalBytes)
+		}
+	}
+	if s.PercentComplete > 100 {
+		s.PercentComplete = 100
+	}
+	return s
+}
+
+// save writes the current progress to the Operation.
+func (p *progress) save() {
+	if p.op.Complete() {
+		return
+	}
+	if err := p.op.UpdateProgress(p.snapshot()); err != nil {
+		log.Printf("failed to update progress for operation %d with err: %v", p.op.OperationId, err)
+	}
+}
+
+// report saves progress every progressInterval until the returned func is called.
+func (p *progress) report() func() {
+	ticker := time.NewTicker(progressInterval)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.save()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// countingReader raises n to the offset it has read up to.
+type countingReader struct {
+	r   io.Reader
+	n   *atomic.Int64
+	off int64
+}
+
+func (cr *countingReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.off += int64(n)
+	storeMax(cr.n, cr.off)
+	return n, err
+}
+
+// countingReaderAt raises n to the furthest offset read.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n *atomic.Int64
+}
+
+func (cr *countingReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(b, off)
+	storeMax(cr.n, off+int64(n))
+	return n, err
+}
+
+// storeMax sets n to v, if v is larger.
+func storeMax(n *atomic.Int64, v int64) {
+	for {
+		old := n.Load()
+		if v <= old || n.CompareAndSwap(old, v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dantespe/spectacle/operation"
+)
+
+func TestProgressSnapshot(t *testing.T) {
+	p := newProgress(nil, 100)
+
+	// HEADERS: bytes read carry over to the next phase
+	p.setPhase(operation.Phase_HEADERS)
+	rd := p.reader(strings.NewReader(strings.Repeat("x", 100)))
+	buf := make([]byte, 25)
+	if _, err := rd.Read(buf); err != nil {
+		t.Fatalf("got unexpected error for Read(): %v", err)
+	}
+	if got := p.snapshot(); got.PercentComplete != 0 {
+		t.Errorf("got PercentComplete: %f, want: 0", got.PercentComplete)
+	}
+
+	// RECORDS: halfway through the file after 10 rows
+	p.setPhase(operation.Phase_RECORDS)
+	if _, err := rd.Read(buf); err != nil {
+		t.Fatalf("got unexpected error for Read(): %v", err)
+	}
+	p.addRows(10)
+	got := p.snapshot()
+	if got.BytesRead != 50 {
+		t.Errorf("got BytesRead: %d, want: 50", got.BytesRead)
+	}
+	if got.TotalRows != 20 {
+		t.Errorf("got TotalRows: %d, want: 20", got.TotalRows)
+	}
+	if got.PercentComplete != 50 {
+		t.Errorf("got PercentComplete: %f, want: 50", got.PercentComplete)
+	}
+
+	// CELLS: the cells of the same rows, so the counters carry over
+	p.setPhase(operation.Phase_CELLS)
+	if got := p.snapshot(); got.PercentComplete != 50 || got.RowsProcessed != 10 {
+		t.Errorf("got PercentComplete: %f, RowsProcessed: %d, want: 50, 10", got.PercentComplete, got.RowsProcessed)
+	}
+
+	// TotalRows is exact once set
+	p.setTotalRows(21)
+	if got := p.snapshot(); got.TotalRows != 21 {
+		t.Errorf("got TotalRows: %d, want: 21", got.TotalRows)
+	}
+
+	// Files that record their number of rows complete by rows written
+	p = newProgress(nil, 100)
+	p.setPhase(operation.Phase_RECORDS)
+	p.setTotalRows(40)
+	p.addRows(10)
+	if got := p.snapshot(); got.PercentComplete != 25 {
+		t.Errorf("got PercentComplete: %f, want: 25", got.PercentComplete)
+	}
+}
+
+func TestProgressBytesReadOnce(t *testing.T) {
+	p := newProgress(nil, 100)
+	file := strings.NewReader(strings.Repeat("x", 100))
+
+	// Peek at the start, then read it again at an offset, twice
+	buf := make([]byte, 10)
+	if _, err := p.reader(file).Read(buf); err != nil {
+		t.Fatalf("got unexpected error for Read(): %v", err)
+	}
+	ra := p.readerAt(file)
+	buf = make([]byte, 30)
+	for i := 0; i < 2; i++ {
+		if _, err := ra.ReadAt(buf, 0); err != nil {
+			t.Fatalf("got unexpected error for ReadAt(): %v", err)
+		}
+	}
+	if got := p.snapshot(); got.BytesRead != 30 {
+		t.Errorf("got BytesRead: %d, want: 30", got.BytesRead)
+	}
+}
@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+// Query Defaults
+const (
+	DefaultQueryTimeout = 30 * time.Second
+	DefaultMaxQueryRows = 10000
+)
+
+// datasetIdName names a dataset by id, e.g. dataset_9.
+var datasetIdName = regexp.MustCompile(`(?i)^dataset_(\d+)$`)
+
+// Query runs req.Query, a read-only SELECT over a dataset (see
+// query.CompileSelect), in a read-only transaction. Queries that run longer
+// than the query timeout are cancelled.
+func (m *Manager) Query(req *QueryRequest) (int, *DataResponse) {
+	// Errors looking up the dataset are ours, not the query's
+	var dbErr error
+	resolve := func(name string) (*query.Table, error) {
+		t, err := m.table(name)
+		if err != nil && !errors.Is(err, errUnknownTable) {
+			dbErr = err
+		}
+		return t, err
+	}
+
+	maxRows := m.maxQueryRows
+	if req.MaxResults > 0 && req.MaxResults < maxRows {
+		maxRows = req.MaxResults
+	}
+	compiled, err := query.CompileSelect(req.Query, resolve, maxRows)
+	if dbErr != nil {
+		log.Printf("failed to look up dataset with err: %v", dbErr)
+		return http.StatusInternalServerError, &DataResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	if err != nil {
+		return http.StatusBadRequest, &DataResponse{
+			Message: fmt.Sprintf("invalid query: %v", err),
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.queryTimeout)
+	defer cancel()
+	tx, err := m.eng.DatabaseHandle.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		log.Printf("failed to create transaction with err: %v", err)
+		return http.StatusInternalServerError, &DataResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+	defer tx.Rollback()
+
+	// The server enforces the timeout too, in case the context can't
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", m.queryTimeout.Milliseconds())); err != nil {
+		log.Printf("failed to set statement_timeout with err: %v", err)
+		return http.StatusInternalServerError, &DataResponse{
+			Message: "INTERNAL SERVER ERROR",
+			Code:    http.StatusInternalServerError,
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, compiled.SQL, compiled.Args...)
+	if err != nil {
+		return queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	resp := &DataResponse{
+		Code:    http.StatusOK,
+		Headers: compiled.Columns,
+		Results: make([]*ResultSet, 0),
+	}
+	row := make([]any, len(compiled.Columns))
+	dest := make([]any, len(row))
+	for i := range row {
+		dest[i] = &row[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return queryError(ctx, err)
+		}
+		rs := &ResultSet{
+			Data: make([]string, len(row)),
+		}
+		for i, v := range row {
+			rs.Data[i] = stringValue(v)
+		}
+		resp.Results = append(resp.Results, rs)
+	}
+	if err := rows.Err(); err != nil {
+		return queryError(ctx, err)
+	}
+	return http.StatusOK, resp
+}
+
+// errUnknownTable is returned by table for names that match no dataset.
+var errUnknownTable = errors.New("unknown dataset")
+
+// table returns the dataset name refers to: by id if it is dataset_<id>, and
+// otherwise by its display name.
+func (m *Manager) table(name string) (*query.Table, error) {
+	var ds *dataset.Dataset
+	if match := datasetIdName.FindStringSubmatch(name); match != nil {
+		id, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errUnknownTable, name)
+		}
+		if ds, err = m.dataset(id); err != nil {
+			return nil, err
+		}
+	} else {
+		matches, err := dataset.GetDatasetsByName(m.eng, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("%w: %q names %d datasets, use dataset_<datasetId>", errUnknownTable, name, len(matches))
+		}
+		if len(matches) == 1 {
+			ds = matches[0]
+		}
+	}
+	if ds == nil {
+		return nil, fmt.Errorf("%w: %q", errUnknownTable, name)
+	}
+
+	headers, err := header.GetHeaders(m.eng, ds.DatasetId)
+	if err != nil {
+		return nil, err
+	}
+	return &query.Table{
+		DatasetId: ds.DatasetId,
+		Headers:   headers,
+	}, nil
+}
+
+// queryError returns the response for err, an error running a query. Errors
+// in the query itself, such as comparing a number to a string, are the
+// client's.
+func queryError(ctx context.Context, err error) (int, *DataResponse) {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded), errors.As(err, &pqErr) && pqErr.Code == "57014":
+		return http.StatusBadRequest, &DataResponse{
+			Message: "query exceeded the time limit",
+			Code:    http.StatusBadRequest,
+		}
+	case errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "42"):
+		return http.StatusBadRequest, &DataResponse{
+			Message: fmt.Sprintf("invalid query: %s", pqErr.Message),
+			Code:    http.StatusBadRequest,
+		}
+	}
+	log.Printf("failed to run query with err: %v", err)
+	return http.StatusInternalServerError, &DataResponse{
+		Message: "INTERNAL SERVER ERROR",
+		Code:    http.StatusInternalServerError,
+	}
+}
+
+// stringValue formats a value scanned from Postgres as a cell. NULLs are
+// blank.
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/dantespe/spectacle/operation"
+)
+
+// Queue Defaults
+const (
+	DefaultWorkers   = 4
+	DefaultQueueSize = 64
+)
+
+// errQueueFull is returned by push when the queue is at capacity.
+var errQueueFull = errors.New("job queue is full")
+
+// job is a background operation waiting for a worker.
+type job struct {
+	op        *operation.Operation
+	datasetId int64
+	run       func()
+}
+
+// queue runs jobs on a fixed number of workers. Jobs for the same dataset
+// run one at a time, in the order they were pushed.
+type queue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []*job
+	active   map[int64]bool
+	capacity int
+}
+
+func newQueue(workers int, capacity int) *queue {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if capacity <= 0 {
+		capacity = DefaultQueueSize
+	}
+	q := &queue{
+		active:   make(map[int64]bool),
+		capacity: capacity,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// push adds j to the queue.
+func (q *queue) push(j *job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) >= q.capacity {
+		return errQueueFull
+	}
+	q.pending = append(q.pending, j)
+	q.cond.Broadcast()
+	return nil
+}
+
+// remove takes the job for operationId off the queue, if it hasn't been
+// claimed by a worker yet. Returns the removed job, or nil.
+func (q *queue) remove(operationId int64) *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, j := range q.pending {
+		if j.op != nil && j.op.OperationId == operationId {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return j
+		}
+	}
+	return nil
+}
+
+// full reports whether push would return errQueueFull.
+func (q *queue) full() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) >= q.capacity
+}
+
+// next blocks until there is a job whose dataset is not busy, and claims it.
+func (q *queue) next() *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for i, j := range q.pending {
+			if q.active[j.datasetId] {
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.active[j.datasetId] = true
+			return j
+		}
+		q.cond.Wait()
+	}
+}
+
+// done releases the dataset claimed by j.
+func (q *queue) done(j *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.active, j.datasetId)
+	q.cond.Broadcast()
+}
+
+func (q *queue) work() {
+	for {
+		j := q.next()
+		j.run()
+		q.done(j)
+	}
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dantespe/spectacle/operation"
+)
+
+func TestQueueFull(t *testing.T) {
+	q := newQueue(1, 1)
+
+	// Occupy the only worker
+	block := make(chan bool)
+	started := make(chan bool)
+	if err := q.push(&job{datasetId: 1, run: func() { started <- true; <-block }}); err != nil {
+		t.Fatalf("got unexpected error for push(): %v", err)
+	}
+	<-started
+
+	if err := q.push(&job{datasetId: 2, run: func() {}}); err != nil {
+		t.Fatalf("got unexpected error for push(): %v", err)
+	}
+	if !q.full() {
+		t.Errorf("got full(): false, want: true")
+	}
+	if err := q.push(&job{datasetId: 3, run: func() {}}); err != errQueueFull {
+		t.Errorf("got err: %v, want: %v", err, errQueueFull)
+	}
+	close(block)
+}
+
+func TestQueueSerializesDataset(t *testing.T) {
+	q := newQueue(4, 10)
+
+	var (
+		mu      sync.Mutex
+		running int
+		maxSeen int
+		order   []int
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		i := i
+		wg.Add(1)
+		err := q.push(&job{datasetId: 1, run: func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			if running > maxSeen {
+				maxSeen = running
+			}
+			order = append(order, i)
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}})
+		if err != nil {
+			t.Fatalf("got unexpected error for push(): %v", err)
+		}
+	}
+	wg.Wait()
+
+	if maxSeen != 1 {
+		t.Errorf("got %d concurrent jobs for one dataset, want: 1", maxSeen)
+	}
+	for i, got := range order {
+		if got != i {
+			t.Errorf("got jobs in order %v, want: [0 1 2 3 4]", order)
+			break
+		}
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	q := newQueue(1, 1)
+
+	// Occupy the only worker
+	block := make(chan bool)
+	started := make(chan bool)
+	if err := q.push(&job{op: &operation.Operation{OperationId: 1}, datasetId: 1, run: func() { started <- true; <-block }}); err != nil {
+		t.Fatalf("got unexpected error for push(): %v", err)
+	}
+	<-started
+	defer close(block)
+
+	if err := q.push(&job{op: &operation.Operation{OperationId: 2}, datasetId: 1, run: func() {}}); err != nil {
+		t.Fatalf("got unexpected error for push(): %v", err)
+	}
+	if j := q.remove(1); j != nil {
+		t.Errorf("remove(1) = %v, want: nil for a running job", j)
+	}
+	if j := q.remove(2); j == nil || j.op.OperationId != 2 {
+		t.Errorf("remove(2) = %v, want: the queued job", j)
+	}
+
+	// Its slot is free again
+	if q.full() {
+		t.Errorf("got full(): true, want: false")
+	}
+}
@@ -1,10 +1,15 @@
 package manager
 
 import (
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/operation"
+	"github.com/dantespe/spectacle/query"
 	"github.com/gin-gonic/gin"
 )
 
@@ -37,33 +42,184 @@ func (*RequestBuilder) GetDatasetRequestBuilder(c *gin.Context) (*GetDatasetRequ
 	}, nil
 }
 
+// UpdateDatasetRequest sets the metadata of a dataset. Nil fields are left
+// unchanged.
+type UpdateDatasetRequest struct {
+	DatasetId   int64     `json:"datasetId"`
+	DisplayName *string   `json:"displayName"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+	Source      *string   `json:"source"`
+	Owner       *string   `json:"owner"`
+}
+
+func (*RequestBuilder) UpdateDatasetRequestBuilder(c *gin.Context) (*UpdateDatasetRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	req := &UpdateDatasetRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		return nil, err
+	}
+	req.DatasetId = id
+
+	if req.DisplayName == nil && req.Description == nil && req.Tags == nil && req.Source == nil && req.Owner == nil {
+		return nil, fmt.Errorf("nothing to update, set one of displayName, description, tags, source or owner")
+	}
+	if req.DisplayName != nil && strings.TrimSpace(*req.DisplayName) == "" {
+		return nil, fmt.Errorf("displayName must be non-empty")
+	}
+	return req, nil
+}
+
 // ListDatasets
 type ListDatasetsRequest struct {
+	// MaxDatasets is the size of a page.
 	MaxDatasets int64 `json:"maxDatasets"`
+
+	// Sort orders the datasets. Defaults to by datasetId.
+	Sort dataset.Sort `json:"orderBy"`
+
+	// PageToken continues a listing with the same Sort and filters.
+	PageToken *dataset.PageToken `json:"pageToken"`
+
+	// Tag to filter by, ignoring case. Empty matches every dataset.
+	Tag string `json:"tag"`
+
+	// Search matches datasets whose displayName contains it, ignoring case.
+	Search string `json:"search"`
+
+	// Empty, if non-nil, only matches datasets without records if true, and
+	// with records if false.
+	Empty *bool `json:"empty"`
 }
 
 func (*RequestBuilder) ListDatasetsRequestBuilder(c *gin.Context) (*ListDatasetsRequest, error) {
 	req := newListDatasetsRequest()
-	c.ShouldBindJSON(&req)
+
+	if c.Query("maxDatasets") != "" {
+		n, err := strconv.ParseInt(c.Query("maxDatasets"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("maxDatasets must be positive, got: %d", n)
+		}
+		req.MaxDatasets = n
+	} else {
+		// Deprecated: maxDatasets used to be read from a JSON body
+		var body struct {
+			MaxDatasets *int64 `json:"maxDatasets"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if body.MaxDatasets != nil {
+			if *body.MaxDatasets <= 0 {
+				return nil, fmt.Errorf("maxDatasets must be positive, got: %d", *body.MaxDatasets)
+			}
+			req.MaxDatasets = *body.MaxDatasets
+		}
+	}
+
+	sort, err := dataset.ParseSort(c.Query("orderBy"))
+	if err != nil {
+		return nil, err
+	}
+	req.Sort = sort
+
+	if c.Query("pageToken") != "" {
+		if req.PageToken, err = dataset.DecodePageToken(c.Query("pageToken"), req.Sort); err != nil {
+			return nil, err
+		}
+	}
+
+	req.Tag = c.Query("tag")
+	req.Search = c.Query("search")
+
+	if c.Query("empty") != "" {
+		empty, err := strconv.ParseBool(c.Query("empty"))
+		if err != nil {
+			return nil, fmt.Errorf("empty must be true or false, got: %q", c.Query("empty"))
+		}
+		req.Empty = &empty
+	}
 	return req, nil
 }
 
 func newListDatasetsRequest() *ListDatasetsRequest {
 	return &ListDatasetsRequest{
 		MaxDatasets: 1000,
+		Sort:        dataset.Sort{Order: dataset.Order_DATASET_ID},
 	}
 }
 
+// UploadMode controls how an upload is combined with the data already in the dataset.
+type UploadMode string
+
+const (
+	// UploadMode_APPEND adds the file's rows to the dataset.
+	UploadMode_APPEND UploadMode = "append"
+	// UploadMode_REPLACE swaps the dataset's contents for the file once it has loaded.
+	UploadMode_REPLACE UploadMode = "replace"
+	// UploadMode_UPSERT appends the file's rows, replacing rows with the same Key.
+	UploadMode_UPSERT UploadMode = "upsert"
+)
+
+// MissingColumns controls what happens to the dataset's columns that an
+// appended file does not have.
+type MissingColumns string
+
+const (
+	MissingColumns_FILL MissingColumns = "fill"
+	MissingColumns_FAIL MissingColumns = "fail"
+)
+
 // UploadDatasetRequest
 type UploadDatasetRequest struct {
 	// DatasetId
 	DatasetId int64 `json:"datasetId"`
 
-	// HasHeaders
+	// HasHeaders is true if the first row of InputFile holds the column
+	// names. Defaults to true.
 	HasHeaders bool `json:"hasHeaders"`
 
+	// Mode of the upload. Defaults to UploadMode_APPEND.
+	Mode UploadMode `json:"mode"`
+
+	// Key is the display name of the column that identifies a row in
+	// UploadMode_UPSERT.
+	Key string `json:"key"`
+
+	// MissingColumns is what to do with columns of the dataset that the file
+	// does not have. Defaults to MissingColumns_FILL, which leaves them blank.
+	MissingColumns MissingColumns `json:"missingColumns"`
+
+	// Format of the file. If empty, it is detected from the file.
+	Format UploadFormat `json:"format"`
+
+	// Dialect of the file, if it is delimited text.
+	Dialect Dialect `json:"dialect"`
+
+	// Sheet is the name of the sheet to upload from a workbook. If empty,
+	// the first sheet is uploaded. If AllSheets, each sheet is uploaded to
+	// its own dataset.
+	Sheet string `json:"sheet"`
+
+	// SkipRows is the number of rows skipped at the start of the file, before
+	// the header row.
+	SkipRows int `json:"skipRows"`
+
+	// Member is the name of the file to upload from a zip archive. If
+	// empty, the archive must hold a single file.
+	Member string `json:"member"`
+
 	// InputFile
 	InputFile io.Reader `json:"-"`
+
+	// InputSize is the size of InputFile in bytes, or 0 if unknown.
+	InputSize int64 `json:"-"`
 }
 
 func (*RequestBuilder) UploadDatasetRequestBuilder(c *gin.Context) (*UploadDatasetRequest, error) {
@@ -76,13 +232,83 @@ func (*RequestBuilder) UploadDatasetRequestBuilder(c *gin.Context) (*UploadDatas
 	if err != nil {
 		return nil, err
 	}
+
+	// hasHeaders may be set as a form field or a query parameter
+	hasHeaders := true
+	if v := c.Request.FormValue("hasHeaders"); v != "" {
+		hasHeaders, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hasHeaders: %v", err)
+		}
+	}
+
+	mode := UploadMode(strings.ToLower(c.Request.FormValue("mode")))
+	switch mode {
+	case "":
+		mode = UploadMode_APPEND
+	case UploadMode_APPEND, UploadMode_REPLACE:
+	case UploadMode_UPSERT:
+		if c.Request.FormValue("key") == "" {
+			return nil, fmt.Errorf("key is required for mode: %s", mode)
+		}
+		if !hasHeaders {
+			return nil, fmt.Errorf("mode: %s requires a header row", mode)
+		}
+	default:
+		return nil, fmt.Errorf("invalid mode: %q", mode)
+	}
+
+	missing := MissingColumns(strings.ToLower(c.Request.FormValue("missingColumns")))
+	switch missing {
+	case "":
+		missing = MissingColumns_FILL
+	case MissingColumns_FILL, MissingColumns_FAIL:
+	default:
+		return nil, fmt.Errorf("invalid missingColumns: %q", missing)
+	}
+
+	// format may be set as a form field, or by the file's content type
+	format := uploadFormatOf(header.Header.Get("Content-Type"))
+	if v := c.Request.FormValue("format"); v != "" {
+		if format, err = ParseUploadFormat(v); err != nil {
+			return nil, err
+		}
+	}
+
+	dialect, err := parseDialect(c.Request.FormValue)
+	if err != nil {
+		return nil, err
+	}
+
+	skipRows := 0
+	if v := c.Request.FormValue("skipRows"); v != "" {
+		if skipRows, err = strconv.Atoi(v); err != nil || skipRows < 0 {
+			return nil, fmt.Errorf("invalid skipRows: %q", v)
+		}
+	}
+
+	sheet := c.Request.FormValue("sheet")
+	if sheet == AllSheets && format != "" && format != UploadFormat_XLSX {
+		return nil, fmt.Errorf("sheet: %s is only supported for XLSX files", AllSheets)
+	}
+
 	file, err := header.Open()
 	if err != nil {
 		return nil, err
 	}
+
 	return &UploadDatasetRequest{
-		DatasetId: id,
-		InputFile: file,
+		DatasetId:      id,
+		HasHeaders:     hasHeaders,
+		Mode:           mode,
+		Key:            c.Request.FormValue("key"),
+		MissingColumns: missing,
+		Format:         format,
+		Dialect:        dialect,
+		Sheet:          sheet,
+		SkipRows:       skipRows,
+		InputFile:      file,
+		InputSize:      header.Size,
 	}, nil
 }
 
@@ -99,11 +325,70 @@ func (*RequestBuilder) GetHeadersRequestBuilder(c *gin.Context) (*GetHeadersRequ
 	return &GetHeadersRequest{DatasetId: id}, nil
 }
 
+// GetProfileRequest
+type GetProfileRequest struct {
+	// DatasetId
+	DatasetId int64 `json:"datasetId"`
+}
+
+func (*RequestBuilder) GetProfileRequestBuilder(c *gin.Context) (*GetProfileRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &GetProfileRequest{DatasetId: id}, nil
+}
+
+// UpdateHeaderRequest
+type UpdateHeaderRequest struct {
+	DatasetId int64            `json:"datasetId"`
+	HeaderId  int64            `json:"headerId"`
+	ValueType header.ValueType `json:"valueType"`
+}
+
+func (*RequestBuilder) UpdateHeaderRequestBuilder(c *gin.Context) (*UpdateHeaderRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	headerId, err := strconv.ParseInt(c.Param("headerId"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		ValueType string `json:"valueType"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		return nil, err
+	}
+	vt, err := header.ParseValueType(body.ValueType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateHeaderRequest{
+		DatasetId: id,
+		HeaderId:  headerId,
+		ValueType: vt,
+	}, nil
+}
+
 type DataRequest struct {
 	DatasetId    int64   `json:"datasetId"`
 	Headers      []int64 `json:"headers"`
 	LastRecordId int64   `json:"recordid"`
 	MaxResults   int64   `json:"maxresults"`
+	Filter       string  `json:"filter"`
+	Sort         string  `json:"sort"`
+
+	// Where is the parsed Filter, or nil if there is none.
+	Where query.Expr `json:"-"`
+
+	// Order is the parsed Sort, and Cursor where the previous page of a
+	// sorted result ended.
+	Order  []query.SortKey `json:"-"`
+	Cursor *query.Cursor   `json:"-"`
 }
 
 func (*RequestBuilder) DataRequestBuilder(c *gin.Context) (*DataRequest, error) {
@@ -112,15 +397,9 @@ func (*RequestBuilder) DataRequestBuilder(c *gin.Context) (*DataRequest, error)
 		return nil, err
 	}
 
-	headers := make([]int64, 0)
-	if c.Query("headers") != "" {
-		for _, h := range strings.Split(c.Query("headers"), ",") {
-			id, err := strconv.ParseInt(h, 10, 64)
-			if err != nil {
-				return nil, err
-			}
-			headers = append(headers, id)
-		}
+	headers, err := parseHeaderIds(c.Query("headers"))
+	if err != nil {
+		return nil, err
 	}
 
 	lastRecordId := int64(-1)
@@ -139,6 +418,44 @@ func (*RequestBuilder) DataRequestBuilder(c *gin.Context) (*DataRequest, error)
 		if err != nil {
 			return nil, err
 		}
+		if maxResults <= 0 || maxResults > maxDataResults {
+			return nil, fmt.Errorf("maxresults must be between 1 and %d, got: %d", maxDataResults, maxResults)
+		}
+	}
+
+	var where query.Expr
+	filter := c.Query("filter")
+	if strings.TrimSpace(filter) != "" {
+		var err error
+		where, err = query.Parse(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter: %v", err)
+		}
+	}
+
+	var order []query.SortKey
+	sort := c.Query("sort")
+	if strings.TrimSpace(sort) != "" {
+		var err error
+		order, err = query.ParseSort(sort)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var cursor *query.Cursor
+	if c.Query("cursor") != "" {
+		if order == nil {
+			return nil, fmt.Errorf("cursor requires sort")
+		}
+		var err error
+		cursor, err = query.DecodeCursor(c.Query("cursor"))
+		if err != nil {
+			return nil, err
+		}
+		if len(cursor.Values) != len(order) {
+			return nil, fmt.Errorf("cursor doesn't match sort: %q", sort)
+		}
 	}
 
 	resp := &DataRequest{
@@ -146,10 +463,198 @@ func (*RequestBuilder) DataRequestBuilder(c *gin.Context) (*DataRequest, error)
 		Headers:      headers,
 		LastRecordId: lastRecordId,
 		MaxResults:   maxResults,
+		Filter:       filter,
+		Sort:         sort,
+		Where:        where,
+		Order:        order,
+		Cursor:       cursor,
 	}
 	return resp, nil
 }
 
+// parseHeaderIds parses a comma separated list of HeaderIds.
+func parseHeaderIds(s string) ([]int64, error) {
+	headers := make([]int64, 0)
+	if s == "" {
+		return headers, nil
+	}
+	for _, h := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(h), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, id)
+	}
+	return headers, nil
+}
+
+// ExportRequest
+type ExportRequest struct {
+	DatasetId int64        `json:"datasetId"`
+	Format    ExportFormat `json:"format"`
+	Headers   []int64      `json:"headers"`
+	Filter    string       `json:"filter"`
+
+	// Where is the parsed Filter, or nil if there is none.
+	Where query.Expr `json:"-"`
+}
+
+func (*RequestBuilder) ExportRequestBuilder(c *gin.Context) (*ExportRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	req := &ExportRequest{
+		DatasetId: id,
+		Format:    ExportFormat_CSV,
+		Filter:    c.Query("filter"),
+	}
+	if c.Query("format") != "" {
+		if req.Format, err = ParseExportFormat(c.Query("format")); err != nil {
+			return nil, err
+		}
+	}
+	if req.Headers, err = parseHeaderIds(c.Query("headers")); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Filter) != "" {
+		if req.Where, err = query.Parse(req.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter: %v", err)
+		}
+	}
+	return req, nil
+}
+
+// AggregateRequest
+type AggregateRequest struct {
+	DatasetId    int64                `json:"datasetId"`
+	GroupBy      []string             `json:"groupBy"`
+	Aggregations []*query.Aggregation `json:"aggregations"`
+	Filter       string               `json:"filter"`
+	Limit        int64                `json:"limit"`
+
+	// Where is the parsed Filter, or nil if there is none.
+	Where query.Expr `json:"-"`
+}
+
+// maxDataResults is the most rows a page of data can have.
+const maxDataResults = 1000
+
+// defaultAggregateLimit is the default maximum number of groups returned.
+const defaultAggregateLimit = 1000
+
+// parse validates req, parses its Filter and defaults its Limit.
+func (req *AggregateRequest) parse() error {
+	if len(req.Aggregations) == 0 {
+		return fmt.Errorf("aggregations must not be empty")
+	}
+	for _, a := range req.Aggregations {
+		if a == nil {
+			return fmt.Errorf("aggregations must not be null")
+		}
+		if err := a.Validate(); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(req.Filter) != "" {
+		where, err := query.Parse(req.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %v", err)
+		}
+		req.Where = where
+	}
+	if req.Limit < 0 {
+		return fmt.Errorf("limit must not be negative, got: %d", req.Limit)
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultAggregateLimit
+	}
+	return nil
+}
+
+func (*RequestBuilder) AggregateRequestBuilder(c *gin.Context) (*AggregateRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var req AggregateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	req.DatasetId = id
+	if err := req.parse(); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ChartRequestBuilder builds an AggregateRequest from the query parameters
+// dataset, groupBy, aggregate and filter, e.g.
+// ?dataset=1&groupBy=CITY&aggregate=count,sum:ARENACAPACITY. It returns nil
+// if there is no dataset parameter.
+func (*RequestBuilder) ChartRequestBuilder(c *gin.Context) (*AggregateRequest, error) {
+	if c.Query("dataset") == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(c.Query("dataset"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &AggregateRequest{
+		DatasetId: id,
+		Filter:    c.Query("filter"),
+	}
+	if c.Query("groupBy") != "" {
+		for _, g := range strings.Split(c.Query("groupBy"), ",") {
+			req.GroupBy = append(req.GroupBy, strings.Trim(strings.TrimSpace(g), "`"))
+		}
+	}
+	aggregate := c.DefaultQuery("aggregate", string(query.AggOp_COUNT))
+	for _, s := range strings.Split(aggregate, ",") {
+		a, err := query.ParseAggregation(s)
+		if err != nil {
+			return nil, err
+		}
+		req.Aggregations = append(req.Aggregations, a)
+	}
+	if err := req.parse(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// QueryRequest
+type QueryRequest struct {
+	Query      string `json:"query"`
+	MaxResults int64  `json:"maxresults"`
+
+	// Format, if set, returns the results as a file instead of JSON.
+	Format ExportFormat `json:"format"`
+}
+
+func (*RequestBuilder) QueryRequestBuilder(c *gin.Context) (*QueryRequest, error) {
+	var req QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, fmt.Errorf("query must not be empty")
+	}
+	if req.MaxResults < 0 {
+		return nil, fmt.Errorf("maxresults must not be negative, got: %d", req.MaxResults)
+	}
+	if req.Format != "" {
+		f, err := ParseExportFormat(string(req.Format))
+		if err != nil {
+			return nil, err
+		}
+		req.Format = f
+	}
+	return &req, nil
+}
+
 type DeleteDataRequest struct {
 	DatasetId int64 `json:"datasetId"`
 }
@@ -164,3 +669,82 @@ func (*RequestBuilder) DeleteDataRequestBuilder(c *gin.Context) (*DeleteDataRequ
 		DatasetId: id,
 	}, nil
 }
+
+type GetOperationRequest struct {
+	OperationId int64 `json:"operationId"`
+}
+
+func (*RequestBuilder) GetOperationRequestBuilder(c *gin.Context) (*GetOperationRequest, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &GetOperationRequest{
+		OperationId: id,
+	}, nil
+}
+
+type ListOperationsRequest struct {
+	// Statuses to filter by. Empty matches every status.
+	Statuses []operation.Status `json:"status"`
+
+	// DatasetId to filter by. Zero matches every dataset.
+	DatasetId int64 `json:"datasetId"`
+
+	// MaxOperations is the maximum number of operations to return.
+	MaxOperations int64 `json:"maxOperations"`
+}
+
+func (*RequestBuilder) ListOperationsRequestBuilder(c *gin.Context) (*ListOperationsRequest, error) {
+	req := &ListOperationsRequest{
+		Statuses:      make([]operation.Status, 0),
+		MaxOperations: 100,
+	}
+
+	if c.Query("status") != "" {
+		for _, s := range strings.Split(c.Query("status"), ",") {
+			st, err := operation.ParseStatus(s)
+			if err != nil {
+				return nil, err
+			}
+			req.Statuses = append(req.Statuses, st)
+		}
+	}
+
+	if c.Query("datasetId") != "" {
+		id, err := strconv.ParseInt(c.Query("datasetId"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.DatasetId = id
+	}
+
+	if c.Query("maxOperations") != "" {
+		n, err := strconv.ParseInt(c.Query("maxOperations"), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.MaxOperations = n
+	}
+	return req, nil
+}
+
+type CancelOperationRequest struct {
+	OperationId int64 `json:"operationId"`
+}
+
+// CancelOperationRequestBuilder parses custom method paths of the form
+// /operation/<operationId>:cancel.
+func (*RequestBuilder) CancelOperationRequestBuilder(c *gin.Context) (*CancelOperationRequest, error) {
+	param, method, found := strings.Cut(c.Param("id"), ":")
+	if !found || method != "cancel" {
+		return nil, fmt.Errorf("unsupported operation method: %q", method)
+	}
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &CancelOperationRequest{
+		OperationId: id,
+	}, nil
+}
@@ -1,8 +1,13 @@
 package manager
 
 import (
+	"context"
+	"io"
+
 	"github.com/dantespe/spectacle/dataset"
 	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/operation"
+	"github.com/dantespe/spectacle/profile"
 )
 
 // StatusResponse
@@ -30,19 +35,42 @@ type GetDatasetResponse struct {
 	Code    int              `json:"code"`
 }
 
+// UpdateDatasetResponse
+type UpdateDatasetResponse struct {
+	Message string           `json:"error,omitempty"`
+	Dataset *dataset.Dataset `json:"dataset,omitempty"`
+	Code    int              `json:"code"`
+}
+
 // ListDatasetsResponse
 type ListDatasetsResponse struct {
 	Results       []*dataset.Dataset `json:"results"`
 	TotalDatasets int64              `json:"totalDatasets"`
+	NextPageToken string             `json:"nextPageToken,omitempty"`
 	Message       string             `json:"error,omitempty"`
 	Code          int                `json:"code"`
 }
 
 // UploadDatasetResponse
 type UploadDatasetResponse struct {
-	OperationUrl string `json:"operation,omitempty"`
-	Message      string `json:"error,omitempty"`
-	Code         int    `json:"code"`
+	OperationUrl string         `json:"operation,omitempty"`
+	Sheets       []*SheetUpload `json:"sheets,omitempty"`
+	Files        []*FileUpload  `json:"files,omitempty"`
+	Message      string         `json:"error,omitempty"`
+	Code         int            `json:"code"`
+}
+
+// SheetUpload is the upload of a sheet of a workbook to a dataset.
+type SheetUpload struct {
+	Sheet        string `json:"sheet"`
+	DatasetId    int64  `json:"datasetId"`
+	OperationUrl string `json:"operation"`
+}
+
+// FileUpload is the upload of a file in a zip archive.
+type FileUpload struct {
+	File         string `json:"file"`
+	OperationUrl string `json:"operation"`
 }
 
 type GetHeadersResponse struct {
@@ -51,10 +79,35 @@ type GetHeadersResponse struct {
 	Code    int              `json:"code"`
 }
 
+type UpdateHeaderResponse struct {
+	Header  *header.Header `json:"header,omitempty"`
+	Message string         `json:"error,omitempty"`
+	Code    int            `json:"code"`
+}
+
+// ExportResponse streams an export. Write writes the file to w, reading the
+// data as it goes; it stops early if ctx is cancelled.
+type ExportResponse struct {
+	Filename    string                                       `json:"-"`
+	ContentType string                                       `json:"-"`
+	Write       func(ctx context.Context, w io.Writer) error `json:"-"`
+	Message     string                                       `json:"error,omitempty"`
+	Code        int                                          `json:"code"`
+}
+
 type ResultSet struct {
 	Data []string `json:"data"`
 }
 
+// GetProfileResponse holds the profile of a dataset, or the operation
+// computing it if the data changed since it was last profiled.
+type GetProfileResponse struct {
+	Profile      *profile.Profile `json:"profile,omitempty"`
+	OperationUrl string           `json:"operation,omitempty"`
+	Message      string           `json:"error,omitempty"`
+	Code         int              `json:"code"`
+}
+
 type DataResponse struct {
 	Results []*ResultSet     `json:"results"`
 	Headers []*header.Header `json:"headers"`
@@ -63,7 +116,44 @@ type DataResponse struct {
 	Code    int              `json:"code"`
 }
 
+// AggregateResponse holds one entry per group-by column and aggregation in
+// Columns, and the values of each in Values, i.e. Values[i][j] is the value
+// of Columns[i] for the j-th group.
+type AggregateResponse struct {
+	Columns []string `json:"columns"`
+	Values  [][]any  `json:"values"`
+	Message string   `json:"error,omitempty"`
+	Code    int      `json:"code"`
+}
+
 type DeleteDataResponse struct {
 	Message string `json:"error,omitempty"`
 	Code    int    `json:"code"`
 }
+
+type GetOperationResponse struct {
+	Operation *operation.Operation `json:"operation,omitempty"`
+	Message   string               `json:"error,omitempty"`
+	Code      int                  `json:"code"`
+}
+
+type ListOperationsResponse struct {
+	Results []*operation.Operation `json:"results"`
+	Message string                 `json:"error,omitempty"`
+	Code    int                    `json:"code"`
+}
+
+type CancelOperationResponse struct {
+	Operation *operation.Operation `json:"operation,omitempty"`
+	Message   string               `json:"error,omitempty"`
+	Code      int                  `json:"code"`
+}
+
+// WatchOperationResponse streams Events until the operation completes.
+// Callers must call Stop once they are done reading Events.
+type WatchOperationResponse struct {
+	Events  <-chan operation.Event `json:"-"`
+	Stop    func()                 `json:"-"`
+	Message string                 `json:"error,omitempty"`
+	Code    int                    `json:"code"`
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+)
+
+// UploadFormat is the file format of an upload.
+type UploadFormat string
+
+const (
+	UploadFormat_CSV UploadFormat = "csv"
+	// UploadFormat_NDJSON is a JSON object per line.
+	UploadFormat_NDJSON UploadFormat = "ndjson"
+	// UploadFormat_JSON is a JSON array of objects.
+	UploadFormat_JSON UploadFormat = "json"
+	// UploadFormat_XLSX is an Excel workbook.
+	UploadFormat_XLSX UploadFormat = "xlsx"
+	// UploadFormat_PARQUET is an Apache Parquet file.
+	UploadFormat_PARQUET UploadFormat = "parquet"
+)
+
+// uploadContentTypes maps the content types of uploaded files to their
+// UploadFormat.
+var uploadContentTypes = map[string]UploadFormat{
+	"text/csv":                UploadFormat_CSV,
+	"application/x-ndjson":    UploadFormat_NDJSON,
+	"application/ndjson":      UploadFormat_NDJSON,
+	"application/jsonl":       UploadFormat_NDJSON,
+	"application/x-jsonlines": UploadFormat_NDJSON,
+	"application/json":        UploadFormat_JSON,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": UploadFormat_XLSX,
+	"application/vnd.apache.parquet":                                    UploadFormat_PARQUET,
+	"application/x-parquet":                                             UploadFormat_PARQUET,
+}
+
+// ParseUploadFormat returns the UploadFormat matching s, ignoring case.
+func ParseUploadFormat(s string) (UploadFormat, error) {
+	f := UploadFormat(strings.ToLower(strings.TrimSpace(s)))
+	switch f {
+	case UploadFormat_CSV, UploadFormat_NDJSON, UploadFormat_JSON, UploadFormat_XLSX, UploadFormat_PARQUET:
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported upload format: %q", s)
+}
+
+// uploadFormatOf returns the UploadFormat of files with contentType, or ""
+// if it doesn't name one.
+func uploadFormatOf(contentType string) UploadFormat {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return uploadContentTypes[mt]
+}
+
+// detectUploadFormat returns the UploadFormat of a file starting with
+// sample. Workbooks and Parquet files are recognized by their magic bytes,
+// files whose text, decoded as d.Encoding, starts with a JSON object or array
+// are JSON, and anything else is read as CSV.
+func detectUploadFormat(sample []byte, d Dialect) UploadFormat {
+	switch {
+	case isXLSX(sample):
+		return UploadFormat_XLSX
+	case isParquet(sample):
+		return UploadFormat_PARQUET
+	}
+	// The sample may end mid-character, so keep what decodes
+	sample, _ = io.ReadAll(d.decode(bytes.NewReader(sample)))
+	sample = bytes.TrimLeft(bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case bytes.HasPrefix(sample, []byte("{")):
+		return UploadFormat_NDJSON
+	case bytes.HasPrefix(sample, []byte("[")):
+		return UploadFormat_JSON
+	}
+	return UploadFormat_CSV
+}
+
+// readerAt returns an upload of size bytes as an io.ReaderAt, for formats
+// that aren't read in order. If file, the upload, is nil because it can't be
+// read at an offset, rd, which reads the upload, is copied to a temporary
+// file that cleanup removes.
+func readerAt(file io.ReaderAt, size int64, rd io.Reader) (ra io.ReaderAt, n int64, cleanup func(), err error) {
+	if file != nil && size > 0 {
+		return file, size, func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "spectacle-upload-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if n, err = io.Copy(f, rd); err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return f, n, cleanup, nil
+}
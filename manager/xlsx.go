@@ -0,0 +1,489 @@
+package manager
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// AllSheets is the sheet option that uploads every sheet of a workbook, each
+// to its own dataset.
+const AllSheets = "*"
+
+// numFmtKind is the kind of value an Excel number format displays.
+type numFmtKind int
+
+const (
+	numFmtNumber numFmtKind = iota
+	numFmtDate
+	numFmtTime
+	numFmtTimestamp
+)
+
+// xlsxWorkbook is an XLSX file opened for reading. Only the workbook's
+// metadata, shared strings and styles are held in memory; sheets are
+// streamed from the file as they are read.
+type xlsxWorkbook struct {
+	zr       *zip.Reader
+	sheets   []xlsxSheetRef
+	strings  []string
+	styles   []numFmtKind
+	date1904 bool
+}
+
+// xlsxSheetRef is a sheet of an xlsxWorkbook, and the path of its XML.
+type xlsxSheetRef struct {
+	name string
+	path string
+}
+
+// isXLSX reports whether sample is the start of an XLSX file: a zip
+// archive holding the parts of a workbook.
+func isXLSX(sample []byte) bool {
+	return bytes.HasPrefix(sample, []byte("PK\x03\x04")) &&
+		(bytes.Contains(sample, []byte("[Content_Types].xml")) || bytes.Contains(sample, []byte("xl/")))
+}
+
+// openXLSX opens the XLSX file ra of size bytes.
+func openXLSX(ra io.ReaderAt, size int64) (*xlsxWorkbook, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %v", err)
+	}
+	wb := &xlsxWorkbook{zr: zr}
+	if err := wb.readWorkbook(); err != nil {
+		return nil, err
+	}
+	if err := wb.readSharedStrings(); err != nil {
+		return nil, err
+	}
+	if err := wb.readStyles(); err != nil {
+		return nil, err
+	}
+	return wb, nil
+}
+
+// sheetNames returns the names of the workbook's sheets, in order.
+func (wb *xlsxWorkbook) sheetNames() []string {
+	names := make([]string, len(wb.sheets))
+	for i, s := range wb.sheets {
+		names[i] = s.name
+	}
+	return names
+}
+
+// open opens the part of the workbook at name. It returns nil if there is
+// no such part.
+func (wb *xlsxWorkbook) open(name string) (io.ReadCloser, error) {
+	for _, f := range wb.zr.File {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, nil
+}
+
+// decode unmarshals the part at name into v. Missing parts are left empty.
+func (wb *xlsxWorkbook) decode(name string, v any) error {
+	rc, err := wb.open(name)
+	if err != nil || rc == nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX file: failed to read %s: %v", name, err)
+	}
+	return nil
+}
+
+func (wb *xlsxWorkbook) readWorkbook() error {
+	var workbook struct {
+		WorkbookPr struct {
+			Date1904 bool `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := wb.decode("xl/workbook.xml", &workbook); err != nil {
+		return err
+	}
+	var rels struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := wb.decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return err
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, r := range rels.Relationships {
+		// Targets are relative to xl/, unless absolute
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.Id] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.Id] = path.Join("xl", r.Target)
+		}
+	}
+	for _, s := range workbook.Sheets {
+		if p, ok := targets[s.Id]; ok {
+			wb.sheets = append(wb.sheets, xlsxSheetRef{name: s.Name, path: p})
+		}
+	}
+	if len(wb.sheets) == 0 {
+		return fmt.Errorf("invalid XLSX file: workbook has no sheets")
+	}
+	wb.date1904 = workbook.WorkbookPr.Date1904
+	return nil
+}
+
+func (wb *xlsxWorkbook) readSharedStrings() error {
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := wb.decode("xl/sharedStrings.xml", &sst); err != nil {
+		return err
+	}
+	wb.strings = make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		wb.strings[i] = si.String()
+	}
+	return nil
+}
+
+func (wb *xlsxWorkbook) readStyles() error {
+	var styles struct {
+		NumFmts []struct {
+			Id   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtId int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := wb.decode("xl/styles.xml", &styles); err != nil {
+		return err
+	}
+	custom := make(map[int]numFmtKind, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		custom[f.Id] = numFmtKindOf(f.Code)
+	}
+	wb.styles = make([]numFmtKind, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		if k, ok := custom[xf.NumFmtId]; ok {
+			wb.styles[i] = k
+		} else {
+			wb.styles[i] = builtInNumFmtKind(xf.NumFmtId)
+		}
+	}
+	return nil
+}
+
+// xlsxText is a string of an XLSX file: plain text, or runs of rich text.
+// Phonetic runs are not part of the text.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	sb.WriteString(t.T)
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+// builtInNumFmtKind returns the kind of the built-in number format id.
+func builtInNumFmtKind(id int) numFmtKind {
+	switch {
+	case id >= 14 && id <= 17, id >= 27 && id <= 31, id >= 34 && id <= 36, id >= 50 && id <= 58:
+		return numFmtDate
+	case id >= 18 && id <= 21, id >= 32 && id <= 33, id >= 45 && id <= 47:
+		return numFmtTime
+	case id == 22:
+		return numFmtTimestamp
+	}
+	return numFmtNumber
+}
+
+// numFmtKindOf returns the kind of the number format code. Formats with
+// year, month or day tokens are dates, and with hour or second tokens are
+// times. An "m" is minutes after an hour or before a second, and otherwise
+// months.
+func numFmtKindOf(code string) numFmtKind {
+	// Only the first section formats positive numbers
+	var date, clock bool
+	var prev rune
+	runes := []rune(strings.ToLower(code))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case ';':
+			i = len(runes)
+			continue
+		case '"':
+			// Quoted text
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+			}
+			continue
+		case '\\', '_', '*':
+			// Escaped, padding and fill characters
+			i++
+			continue
+		case '[':
+			// Colors, conditions and locales, but [h], [m] and [s] are
+			// elapsed times
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if s := string(runes[i+1 : j]); s != "" && strings.Trim(s, "hms") == "" {
+				clock, prev = true, 'h'
+			}
+			i = j
+			continue
+		case 'a':
+			for _, ampm := range []string{"am/pm", "a/p"} {
+				if strings.HasPrefix(string(runes[i:]), ampm) {
+					clock = true
+					i += len(ampm) - 1
+					break
+				}
+			}
+			continue
+		case 'y', 'd':
+			date = true
+		case 'h', 's':
+			clock = true
+		case 'm':
+			j := i
+			for j < len(runes) && runes[j] == 'm' {
+				j++
+			}
+			if prev == 'h' || nextToken(runes[j:]) == 's' {
+				clock = true
+			} else {
+				date = true
+			}
+			i = j - 1
+		default:
+			continue
+		}
+		prev = r
+	}
+	switch {
+	case date && clock:
+		return numFmtTimestamp
+	case date:
+		return numFmtDate
+	case clock:
+		return numFmtTime
+	}
+	return numFmtNumber
+}
+
+// nextToken returns the first date or time token in runes.
+func nextToken(runes []rune) rune {
+	for _, r := range runes {
+		switch r {
+		case 'y', 'd', 'h', 'm', 's':
+			return r
+		}
+	}
+	return 0
+}
+
+// xlsxReader reads the rows of a sheet of an xlsxWorkbook. Cells are placed
+// by their column, so a row's gaps are blank. Empty rows, and the first skip
+// rows of the sheet, are not read.
+type xlsxReader struct {
+	wb   *xlsxWorkbook
+	rc   io.ReadCloser
+	dec  *xml.Decoder
+	skip int
+	row  []string
+}
+
+// sheet returns an xlsxReader of the sheet named name, or the first sheet if
+// name is empty. The caller must Close it.
+func (wb *xlsxWorkbook) sheet(name string, skip int) (*xlsxReader, error) {
+	ref := wb.sheets[0]
+	if name != "" {
+		found := false
+		for _, s := range wb.sheets {
+			if s.name == name {
+				ref, found = s, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("failed to find sheet %q in workbook, it has: %s", name, strings.Join(wb.sheetNames(), ", "))
+		}
+	}
+	rc, err := wb.open(ref.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sheet %q with err: %v", ref.name, err)
+	}
+	if rc == nil {
+		return nil, fmt.Errorf("invalid XLSX file: missing sheet %q", ref.name)
+	}
+	return &xlsxReader{
+		wb:   wb,
+		rc:   rc,
+		dec:  xml.NewDecoder(rc),
+		skip: skip,
+	}, nil
+}
+
+func (xr *xlsxReader) Close() error {
+	return xr.rc.Close()
+}
+
+func (xr *xlsxReader) Read() ([]string, error) {
+	for {
+		tok, err := xr.dec.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX sheet: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "row" {
+			continue
+		}
+		var row xlsxRow
+		if err := xr.dec.DecodeElement(&row, &se); err != nil {
+			return nil, fmt.Errorf("invalid XLSX row: %v", err)
+		}
+		if row.R > 0 && row.R <= xr.skip {
+			continue
+		}
+		if xr.skip > 0 && row.R == 0 {
+			// Rows without numbers are counted in order
+			xr.skip--
+			continue
+		}
+		if values, err := xr.values(&row); err != nil || values != nil {
+			return values, err
+		}
+	}
+}
+
+// xlsxRow is a row of a sheet.
+type xlsxRow struct {
+	R     int `xml:"r,attr"`
+	Cells []struct {
+		R  string    `xml:"r,attr"`
+		S  int       `xml:"s,attr"`
+		T  string    `xml:"t,attr"`
+		V  string    `xml:"v"`
+		Is *xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// values returns the values of row's cells, or nil if they are all blank.
+func (xr *xlsxReader) values(row *xlsxRow) ([]string, error) {
+	xr.row = xr.row[:0]
+	blank := true
+	for _, c := range row.Cells {
+		col := len(xr.row)
+		if c.R != "" {
+			var err error
+			if col, _, err = excelize.CellNameToCoordinates(c.R); err != nil {
+				return nil, fmt.Errorf("invalid XLSX cell: %v", err)
+			}
+			col--
+		}
+		for len(xr.row) <= col {
+			xr.row = append(xr.row, "")
+		}
+
+		var v string
+		switch c.T {
+		case "s":
+			i, err := strconv.Atoi(strings.TrimSpace(c.V))
+			if err != nil || i < 0 || i >= len(xr.wb.strings) {
+				return nil, fmt.Errorf("invalid XLSX cell %s: unknown shared string %q", c.R, c.V)
+			}
+			v = xr.wb.strings[i]
+		case "inlineStr":
+			if c.Is != nil {
+				v = c.Is.String()
+			}
+		case "b":
+			switch c.V {
+			case "1":
+				v = "true"
+			case "0":
+				v = "false"
+			}
+		case "e":
+			// Errors like #N/A have no value
+		case "str", "d":
+			v = c.V
+		default:
+			kind := numFmtNumber
+			if c.S > 0 && c.S < len(xr.wb.styles) {
+				kind = xr.wb.styles[c.S]
+			}
+			v = xr.number(c.V, kind)
+		}
+		xr.row[col] = v
+		if v != "" {
+			blank = false
+		}
+	}
+	if blank {
+		return nil, nil
+	}
+	return xr.row, nil
+}
+
+// number returns the text of the numeric cell value v, displayed as a number
+// format of kind. Dates and times are written in the layouts that
+// header.InferValueType reads.
+func (xr *xlsxReader) number(v string, kind numFmtKind) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return v
+	}
+	if kind != numFmtNumber && f >= 0 {
+		t, err := excelize.ExcelDateToTime(f, xr.wb.date1904)
+		if err == nil {
+			t = t.Round(time.Millisecond)
+			switch kind {
+			case numFmtDate:
+				return t.Format("2006-01-02")
+			case numFmtTime:
+				return t.Format("15:04:05.999")
+			}
+			return t.Format("2006-01-02 15:04:05.999")
+		}
+	}
+	// Excel keeps 15 significant digits, so 0.1+0.2 is 0.3
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return v
+	}
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
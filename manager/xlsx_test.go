@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/xuri/excelize/v2"
+)
+
+// testWorkbook returns an XLSX file with a "Games" sheet, holding a title
+// row above its header row, and a "Teams" sheet.
+func testWorkbook(t *testing.T) []byte {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", "Games"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.NewSheet("Teams"); err != nil {
+		t.Fatal(err)
+	}
+	date, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := "yyyy-mm-dd hh:mm"
+	timestamp, err := f.NewStyle(&excelize.Style{CustomNumFmt: &custom})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cell, v := range map[string]any{
+		"A1": "2024 Season",
+		"A2": "team", "B2": "date", "C2": "tipoff", "D2": "points", "E2": "win",
+		"A3": "Celtics", "B3": 45383.0, "C3": 45383.8125, "D3": 0.1 + 0.2, "E3": true,
+		// Row 4 is blank
+		"A5": "Lakers", "B5": 45384.0, "D5": 112, "E5": false,
+	} {
+		if err := f.SetCellValue("Games", cell, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SetCellStyle("Games", "B3", "B5", date); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellStyle("Games", "C3", "C5", timestamp); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSheetRow("Teams", "A1", &[]any{"team", "city"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSheetRow("Teams", "A2", &[]any{"Celtics", "Boston"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestXLSXReader(t *testing.T) {
+	file := testWorkbook(t)
+	testCases := []struct {
+		desc    string
+		sheet   string
+		skip    int
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			desc: "first_sheet",
+			skip: 1,
+			want: [][]string{
+				{"team", "date", "tipoff", "points", "win"},
+				{"Celtics", "2024-04-01", "2024-04-01 19:30:00", "0.3", "true"},
+				{"Lakers", "2024-04-02", "", "112", "false"},
+			},
+		},
+		{
+			desc: "title_row",
+			want: [][]string{
+				{"2024 Season"},
+				{"team", "date", "tipoff", "points", "win"},
+				{"Celtics", "2024-04-01", "2024-04-01 19:30:00", "0.3", "true"},
+				{"Lakers", "2024-04-02", "", "112", "false"},
+			},
+		},
+		{
+			desc:  "named_sheet",
+			sheet: "Teams",
+			want: [][]string{
+				{"team", "city"},
+				{"Celtics", "Boston"},
+			},
+		},
+		{
+			desc:  "skip_all",
+			sheet: "Teams",
+			skip:  5,
+		},
+		{
+			desc:    "unknown_sheet",
+			sheet:   "Players",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			wb, err := openXLSX(bytes.NewReader(file), int64(len(file)))
+			if err != nil {
+				t.Fatalf("openXLSX() failed with err: %v", err)
+			}
+			if diff := cmp.Diff([]string{"Games", "Teams"}, wb.sheetNames()); diff != "" {
+				t.Errorf("got diff for sheetNames() (-want +got): %s", diff)
+			}
+			xr, err := wb.sheet(tc.sheet, tc.skip)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("sheet(%q) got err: %v, wantErr: %v", tc.sheet, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer xr.Close()
+			if diff := cmp.Diff(tc.want, readAll(t, xr)); diff != "" {
+				t.Errorf("got diff (-want +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestOpenXLSXErrors(t *testing.T) {
+	for _, input := range []string{"", "a,b\n1,2\n", "PK\x03\x04xl/"} {
+		if _, err := openXLSX(bytes.NewReader([]byte(input)), int64(len(input))); err == nil {
+			t.Errorf("openXLSX(%q) expected error", input)
+		}
+	}
+}
+
+func TestNumFmtKindOf(t *testing.T) {
+	testCases := []struct {
+		code string
+		want numFmtKind
+	}{
+		{"General", numFmtNumber},
+		{"0.00", numFmtNumber},
+		{`0.0 "days"`, numFmtNumber},
+		{"[Red]#,##0;[Blue]-#,##0", numFmtNumber},
+		{"yyyy-mm-dd", numFmtDate},
+		{"d-mmm-yy", numFmtDate},
+		{"[$-409]mmmm d, yyyy;@", numFmtDate},
+		{"hh:mm", numFmtTime},
+		{"mm:ss", numFmtTime},
+		{"h:mm AM/PM", numFmtTime},
+		{"[h]:mm", numFmtTime},
+		{"yyyy-mm-dd hh:mm:ss", numFmtTimestamp},
+		{"m/d/yy h:mm", numFmtTimestamp},
+		{`0;"date"`, numFmtNumber},
+	}
+	for _, tc := range testCases {
+		if got := numFmtKindOf(tc.code); got != tc.want {
+			t.Errorf("numFmtKindOf(%q) = %v, want: %v", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestXLSXNumber(t *testing.T) {
+	xr := &xlsxReader{wb: &xlsxWorkbook{}}
+	testCases := []struct {
+		v    string
+		kind numFmtKind
+		want string
+	}{
+		{"42", numFmtNumber, "42"},
+		{"1.5E-3", numFmtNumber, "0.0015"},
+		{"0.30000000000000004", numFmtNumber, "0.3"},
+		{"45383", numFmtDate, "2024-04-01"},
+		{"0.5", numFmtTime, "12:00:00"},
+		{"45383.25", numFmtTimestamp, "2024-04-01 06:00:00"},
+		{"-1", numFmtDate, "-1"},
+		{"abc", numFmtNumber, "abc"},
+	}
+	for _, tc := range testCases {
+		if got := xr.number(tc.v, tc.kind); got != tc.want {
+			t.Errorf("number(%q, %v) = %q, want: %q", tc.v, tc.kind, got, tc.want)
+		}
+	}
+	if got := (&xlsxReader{wb: &xlsxWorkbook{date1904: true}}).number("0", numFmtDate); got != "1904-01-01" {
+		t.Errorf("number() with 1904 dates = %q, want: 1904-01-01", got)
+	}
+}
+
+func TestDetectUploadFormatXLSX(t *testing.T) {
+	file := testWorkbook(t)
+	if got := detectUploadFormat(file, DefaultDialect()); got != UploadFormat_XLSX {
+		t.Errorf("detectUploadFormat() = %q, want: %q", got, UploadFormat_XLSX)
+	}
+	if got := uploadFormatOf("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"); got != UploadFormat_XLSX {
+		t.Errorf("uploadFormatOf() = %q, want: %q", got, UploadFormat_XLSX)
+	}
+}
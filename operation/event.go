@@ -0,0 +1,86 @@
+package operation
+
+// eventBuffer is how many Events a subscriber may fall behind by before the
+// oldest ones are dropped.
+const eventBuffer = 16
+
+// Event is a change to the status, progress or error of an Operation.
+type Event struct {
+	OperationId     int64    `json:"operationId"`
+	OperationStatus Status   `json:"status"`
+	ErrorMessage    string   `json:"errorMessage,omitempty"`
+	Progress        Progress `json:"progress"`
+}
+
+// Complete returns true if this is the last Event of the Operation.
+func (e Event) Complete() bool {
+	return e.OperationStatus == Status_FAILED || e.OperationStatus == Status_SUCCESS || e.OperationStatus == Status_CANCELLED
+}
+
+func (o *Operation) event() Event {
+	return Event{
+		OperationId:     o.OperationId,
+		OperationStatus: o.OperationStatus,
+		ErrorMessage:    o.ErrorMessage,
+		Progress:        o.Progress,
+	}
+}
+
+// Event returns the current state of the Operation.
+func (o *Operation) Event() Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.event()
+}
+
+// Subscribe returns a channel that receives an Event every time the status,
+// progress or error of the Operation changes, starting with its current
+// state. The channel is closed after the Operation completes, or once
+// unsubscribe is called. Slow subscribers miss intermediate Events, but
+// always receive the last one.
+func (o *Operation) Subscribe() (<-chan Event, func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ch := make(chan Event, eventBuffer)
+	ch <- o.event()
+	if o.complete() {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if o.subs == nil {
+		o.subs = make(map[chan Event]bool)
+	}
+	o.subs[ch] = true
+	return ch, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.subs[ch] {
+			delete(o.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends the current state to every subscriber. It must be called
+// with o.mu held.
+func (o *Operation) publish() {
+	e := o.event()
+	for ch := range o.subs {
+		select {
+		case ch <- e:
+		default:
+			// Full, so make room by dropping the oldest Event.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- e
+		}
+		if o.complete() {
+			delete(o.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -2,8 +2,11 @@
 package operation
 
 import (
+	"database/sql"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dantespe/spectacle/db"
 )
@@ -13,22 +16,115 @@ type Status string
 
 const (
 	Status_NOT_STARTED Status = "NOT_STARTED"
+	Status_QUEUED      Status = "QUEUED"
 	Status_RUNNING     Status = "RUNNING"
 	Status_SUCCESS     Status = "SUCCESS"
 	Status_FAILED      Status = "FAILED"
+	Status_CANCELLED   Status = "CANCELLED"
 )
 
+// Type of work the Operation does.
+type Type string
+
+const (
+	Type_UNKNOWN Type = ""
+	Type_UPLOAD  Type = "UPLOAD"
+	Type_DELETE  Type = "DELETE"
+	Type_PROFILE Type = "PROFILE"
+)
+
+// ParseStatus returns the Status matching s, ignoring case.
+func ParseStatus(s string) (Status, error) {
+	st := Status(strings.ToUpper(strings.TrimSpace(s)))
+	switch st {
+	case Status_NOT_STARTED, Status_QUEUED, Status_RUNNING, Status_SUCCESS, Status_FAILED, Status_CANCELLED:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown operation status: %q", s)
+}
+
+// Phase of a running upload.
+type Phase string
+
+const (
+	Phase_HEADERS Phase = "HEADERS"
+	Phase_RECORDS Phase = "RECORDS"
+	Phase_CELLS   Phase = "CELLS"
+)
+
+// Progress of a running Operation.
+type Progress struct {
+	// Phase the operation is currently in.
+	Phase Phase `json:"phase,omitempty"`
+
+	// BytesRead of the input so far.
+	BytesRead int64 `json:"bytesRead"`
+
+	// RowsProcessed is the number of rows written so far.
+	RowsProcessed int64 `json:"rowsProcessed"`
+
+	// TotalRows is an estimate of the number of rows in the input. It is
+	// exact once the RECORDS phase has finished.
+	TotalRows int64 `json:"totalRows"`
+
+	// PercentComplete is in the range [0, 100].
+	PercentComplete float64 `json:"percentComplete"`
+}
+
 // Operation is a class that stores the state of a LRO.
 type Operation struct {
-	mu              sync.Mutex
-	OperationId     int64
-	OperationStatus Status
-	ErrorMessage    string
-	eng             *db.Engine
+	mu sync.Mutex
+
+	// OperationId of the operation.
+	OperationId int64 `json:"operationId"`
+
+	// OperationType is the kind of work the operation does.
+	OperationType Type `json:"type,omitempty"`
+
+	// OperationStatus is the current Status of the operation.
+	OperationStatus Status `json:"status"`
+
+	// ErrorMessage is set when the operation has failed.
+	ErrorMessage string `json:"errorMessage,omitempty"`
+
+	// DatasetId of the dataset the operation acts on, if any.
+	DatasetId int64 `json:"datasetId,omitempty"`
+
+	// CreationTime is when the operation was created.
+	CreationTime time.Time `json:"creationTime"`
+
+	// StartTime is when the operation started running.
+	StartTime *time.Time `json:"startTime,omitempty"`
+
+	// FinishTime is when the operation completed.
+	FinishTime *time.Time `json:"finishTime,omitempty"`
+
+	// Progress of the operation.
+	Progress Progress `json:"progress"`
+
+	eng  *db.Engine
+	subs map[chan Event]bool
+}
+
+// Option for creating new Operations.
+type Option func(*Operation)
+
+// WithDatasetId returns an Option that associates the Operation with a dataset.
+func WithDatasetId(datasetId int64) Option {
+	return func(o *Operation) {
+		o.DatasetId = datasetId
+	}
+}
+
+// WithType returns an Option that sets the Type of the Operation.
+func WithType(t Type) Option {
+	return func(o *Operation) {
+		o.OperationType = t
+	}
 }
 
 // New creates a new Operation and saves it to the database.
-func New(eng *db.Engine) (*Operation, error) {
+func New(eng *db.Engine, opts ...Option) (*Operation, error) {
 	if eng == nil {
 		return nil, fmt.Errorf("cannot create new operation with nil db.Engine")
 	}
@@ -37,13 +133,157 @@ func New(eng *db.Engine) (*Operation, error) {
 		OperationStatus: Status_NOT_STARTED,
 		eng:             eng,
 	}
+	for _, o := range opts {
+		o(op)
+	}
 
-	if err := eng.DatabaseHandle.QueryRow("INSERT INTO Operations(OperationStatus) VALUES($1) RETURNING OperationId", Status_NOT_STARTED).Scan(&op.OperationId); err != nil {
+	if err := eng.DatabaseHandle.QueryRow("INSERT INTO Operations(OperationType, OperationStatus, DatasetId) VALUES($1, $2, $3) RETURNING OperationId, CreationTime", op.OperationType, Status_NOT_STARTED, nullDatasetId(op.DatasetId)).Scan(&op.OperationId, &op.CreationTime); err != nil {
 		return nil, fmt.Errorf("failed to create operation with error: %v", err)
 	}
 	return op, nil
 }
 
+func nullDatasetId(datasetId int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: datasetId, Valid: datasetId > 0}
+}
+
+const selectOperations = "SELECT OperationId, OperationType, OperationStatus, ErrorMessage, DatasetId, CreationTime, StartTime, FinishTime, Phase, BytesRead, RowsProcessed, TotalRows, PercentComplete FROM Operations"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOperation(eng *db.Engine, row scanner) (*Operation, error) {
+	var (
+		opType     sql.NullString
+		errMsg     sql.NullString
+		datasetId  sql.NullInt64
+		startTime  sql.NullTime
+		finishTime sql.NullTime
+		phase      sql.NullString
+	)
+	op := &Operation{
+		eng: eng,
+	}
+	p := &op.Progress
+	if err := row.Scan(&op.OperationId, &opType, &op.OperationStatus, &errMsg, &datasetId, &op.CreationTime, &startTime, &finishTime, &phase, &p.BytesRead, &p.RowsProcessed, &p.TotalRows, &p.PercentComplete); err != nil {
+		return nil, err
+	}
+	p.Phase = Phase(phase.String)
+	op.OperationType = Type(opType.String)
+	op.ErrorMessage = errMsg.String
+	op.DatasetId = datasetId.Int64
+	if startTime.Valid {
+		op.StartTime = &startTime.Time
+	}
+	if finishTime.Valid {
+		op.FinishTime = &finishTime.Time
+	}
+	return op, nil
+}
+
+// GetOperationFromId returns the Operation with the given id, or nil if it does not exist.
+func GetOperationFromId(eng *db.Engine, operationId int64) (*Operation, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("eng must be non-nil")
+	}
+
+	rows, err := eng.DatabaseHandle.Query(selectOperations+" WHERE OperationId = $1", operationId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for operation with error: %v", err)
+	}
+	defer rows.Close()
+
+	// 404: We did not find the operation given operationId
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	op, err := scanOperation(eng, rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Scan operation with error: %v", err)
+	}
+	return op, nil
+}
+
+// Filter restricts the Operations returned by GetOperations.
+type Filter func(*filter)
+
+type filter struct {
+	statuses  []Status
+	datasetId int64
+}
+
+// FilterByStatus returns a Filter that only matches Operations in one of the given statuses.
+func FilterByStatus(st ...Status) Filter {
+	return func(f *filter) {
+		f.statuses = append(f.statuses, st...)
+	}
+}
+
+// FilterByDataset returns a Filter that only matches Operations for the given dataset.
+func FilterByDataset(datasetId int64) Filter {
+	return func(f *filter) {
+		f.datasetId = datasetId
+	}
+}
+
+// GetOperations returns up to maxOperations Operations matching every filter,
+// most recent first.
+func GetOperations(eng *db.Engine, maxOperations int64, filters ...Filter) ([]*Operation, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("eng must be non-nil")
+	}
+	if maxOperations <= 0 {
+		maxOperations = 100
+	}
+
+	f := &filter{}
+	for _, fn := range filters {
+		fn(f)
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if len(f.statuses) > 0 {
+		var in []string
+		for _, st := range f.statuses {
+			args = append(args, st)
+			in = append(in, fmt.Sprintf("$%d", len(args)))
+		}
+		conds = append(conds, fmt.Sprintf("OperationStatus IN (%s)", strings.Join(in, ",")))
+	}
+	if f.datasetId > 0 {
+		args = append(args, f.datasetId)
+		conds = append(conds, fmt.Sprintf("DatasetId = $%d", len(args)))
+	}
+
+	q := selectOperations
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, maxOperations)
+	q += fmt.Sprintf(" ORDER BY OperationId DESC LIMIT $%d", len(args))
+
+	rows, err := eng.DatabaseHandle.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for operations with error: %v", err)
+	}
+	defer rows.Close()
+
+	results := make([]*Operation, 0)
+	for rows.Next() {
+		op, err := scanOperation(eng, rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to Scan operation with error: %v", err)
+		}
+		results = append(results, op)
+	}
+	return results, rows.Err()
+}
+
 func (o *Operation) markStatus(st Status, errMsg string) error {
 	if o.eng == nil {
 		return fmt.Errorf("cannot mark status when engine is nil")
@@ -58,6 +298,19 @@ func (o *Operation) markStatus(st Status, errMsg string) error {
 	}
 	o.OperationStatus = st
 	o.ErrorMessage = errMsg
+	o.publish()
+	return nil
+}
+
+func (o *Operation) markStarted() error {
+	if o.eng == nil {
+		return fmt.Errorf("cannot mark status when engine is nil")
+	}
+	var t time.Time
+	if err := o.eng.DatabaseHandle.QueryRow("UPDATE Operations SET StartTime = CURRENT_TIMESTAMP WHERE OperationId = $1 RETURNING StartTime", o.OperationId).Scan(&t); err != nil {
+		return fmt.Errorf("failed to update operations table with error: %v", err)
+	}
+	o.StartTime = &t
 	return nil
 }
 
@@ -65,25 +318,66 @@ func (o *Operation) markFinished() error {
 	if o.eng == nil {
 		return fmt.Errorf("cannot mark status when engine is nil")
 	}
-	stmt, err := o.eng.DatabaseHandle.Prepare("UPDATE Operations SET FinishTime = CURRENT_TIMESTAMP WHERE OperationId = $1")
+	var t time.Time
+	if err := o.eng.DatabaseHandle.QueryRow("UPDATE Operations SET FinishTime = CURRENT_TIMESTAMP WHERE OperationId = $1 RETURNING FinishTime", o.OperationId).Scan(&t); err != nil {
+		return fmt.Errorf("failed to update operations table with error: %v", err)
+	}
+	o.FinishTime = &t
+	return nil
+}
+
+func (o *Operation) markProgress(p Progress) error {
+	if o.eng == nil {
+		return fmt.Errorf("cannot mark progress when engine is nil")
+	}
+	stmt, err := o.eng.DatabaseHandle.Prepare("UPDATE Operations SET Phase = $1, BytesRead = $2, RowsProcessed = $3, TotalRows = $4, PercentComplete = $5 WHERE OperationId = $6")
 	if err != nil {
 		return fmt.Errorf("failed to build operation PrepareStatement with error: %v", err)
 	}
-	_, err = stmt.Exec(o.OperationId)
+	_, err = stmt.Exec(p.Phase, p.BytesRead, p.RowsProcessed, p.TotalRows, p.PercentComplete, o.OperationId)
 	if err != nil {
 		return fmt.Errorf("failed to update operations table with error: %v", err)
 	}
+	o.Progress = p
+	o.publish()
 	return nil
 }
 
+// UpdateProgress saves the Progress of a running operation.
+func (o *Operation) UpdateProgress(p Progress) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.complete() {
+		return fmt.Errorf("cannot update progress on completed operation")
+	}
+	return o.markProgress(p)
+}
+
+// MarkQueued sets the OperationStatus to QUEUED.
+func (o *Operation) MarkQueued() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.complete() {
+		return fmt.Errorf("cannot mark queued on completed operation")
+	}
+	return o.markStatus(Status_QUEUED, "")
+}
+
 // MarkRunning sets the OperationStatus to RUNNING.
 func (o *Operation) MarkRunning() error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if o.OperationStatus == Status_SUCCESS || o.OperationStatus == Status_FAILED {
+	if o.complete() {
 		return fmt.Errorf("cannot mark running on completed operation")
 	}
+	if o.StartTime == nil {
+		if err := o.markStarted(); err != nil {
+			return err
+		}
+	}
 	return o.markStatus(Status_RUNNING, "")
 }
 
@@ -95,7 +389,12 @@ func (o *Operation) MarkSuccess() error {
 	if err := o.markFinished(); err != nil {
 		return err
 	}
-	if o.OperationStatus == Status_NOT_STARTED || o.OperationStatus == Status_RUNNING {
+	if o.OperationStatus == Status_NOT_STARTED || o.OperationStatus == Status_QUEUED || o.OperationStatus == Status_RUNNING {
+		p := o.Progress
+		p.PercentComplete = 100
+		if err := o.markProgress(p); err != nil {
+			return err
+		}
 		return o.markStatus(Status_SUCCESS, "")
 	}
 	return nil
@@ -111,8 +410,26 @@ func (o *Operation) MarkFailed(msg string) error {
 	return o.markStatus(Status_FAILED, msg)
 }
 
+// MarkCancelled sets the Status to CANCELLED. Completed operations are left unchanged.
+func (o *Operation) MarkCancelled() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.complete() {
+		return nil
+	}
+	if err := o.markFinished(); err != nil {
+		return err
+	}
+	return o.markStatus(Status_CANCELLED, "")
+}
+
+func (o *Operation) complete() bool {
+	return o.OperationStatus == Status_FAILED || o.OperationStatus == Status_SUCCESS || o.OperationStatus == Status_CANCELLED
+}
+
 func (o *Operation) Complete() bool {
 	o.mu.Lock()
 	defer o.mu.Unlock()
-	return o.OperationStatus == Status_FAILED || o.OperationStatus == Status_SUCCESS
+	return o.complete()
 }
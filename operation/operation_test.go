@@ -244,3 +244,256 @@ func TestMarkedFailed(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOperationFromId(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	op, err := operation.New(tmp.Engine, operation.WithDatasetId(7))
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	if err := op.MarkFailed("failed due to user injection"); err != nil {
+		t.Fatalf("failed to set status to failed: %v", err)
+	}
+
+	got, err := operation.GetOperationFromId(tmp.Engine, op.OperationId)
+	if err != nil {
+		t.Fatalf("got unexpected error for GetOperationFromId(%d): %v", op.OperationId, err)
+	}
+	if got == nil {
+		t.Fatalf("got nil operation for GetOperationFromId(%d), want: non-nil", op.OperationId)
+	}
+	if got.OperationStatus != operation.Status_FAILED {
+		t.Errorf("got Status %s, want: %s", got.OperationStatus, operation.Status_FAILED)
+	}
+	if got.ErrorMessage != op.ErrorMessage {
+		t.Errorf("got ErrorMessage %q, want: %q", got.ErrorMessage, op.ErrorMessage)
+	}
+	if got.DatasetId != 7 {
+		t.Errorf("got DatasetId %d, want: 7", got.DatasetId)
+	}
+	if got.FinishTime == nil {
+		t.Errorf("got nil FinishTime, want: non-nil")
+	}
+
+	missing, err := operation.GetOperationFromId(tmp.Engine, -1)
+	if err != nil {
+		t.Fatalf("got unexpected error for GetOperationFromId(-1): %v", err)
+	}
+	if missing != nil {
+		t.Errorf("got operation %d for GetOperationFromId(-1), want: nil", missing.OperationId)
+	}
+}
+
+func TestGetOperations(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	datasetId := int64(1000)
+	for i := 0; i < 3; i++ {
+		op, err := operation.New(tmp.Engine, operation.WithDatasetId(datasetId))
+		if err != nil {
+			t.Fatalf("failed to create new operation: %v", err)
+		}
+		if i == 0 {
+			if err := op.MarkRunning(); err != nil {
+				t.Fatalf("failed to set status to running: %v", err)
+			}
+		}
+	}
+
+	testCases := []struct {
+		desc    string
+		filters []operation.Filter
+		want    int
+	}{
+		{
+			desc:    "by_dataset",
+			filters: []operation.Filter{operation.FilterByDataset(datasetId)},
+			want:    3,
+		},
+		{
+			desc: "by_dataset_and_status",
+			filters: []operation.Filter{
+				operation.FilterByDataset(datasetId),
+				operation.FilterByStatus(operation.Status_RUNNING),
+			},
+			want: 1,
+		},
+		{
+			desc: "by_dataset_and_statuses",
+			filters: []operation.Filter{
+				operation.FilterByDataset(datasetId),
+				operation.FilterByStatus(operation.Status_RUNNING, operation.Status_NOT_STARTED),
+			},
+			want: 3,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ops, err := operation.GetOperations(tmp.Engine, 100, tc.filters...)
+			if err != nil {
+				t.Fatalf("got unexpected error for GetOperations(): %v", err)
+			}
+			if len(ops) != tc.want {
+				t.Errorf("got len: %d, want: %d", len(ops), tc.want)
+			}
+		})
+	}
+}
+
+func TestMarkCancelled(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	runOp, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	if err := runOp.MarkRunning(); err != nil {
+		t.Fatalf("failed to set status to running: %v", err)
+	}
+
+	succOp, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	if err := succOp.MarkSuccess(); err != nil {
+		t.Fatalf("failed to set status to success: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		o    *operation.Operation
+		want operation.Status
+	}{
+		{
+			desc: "RUNNING_OP",
+			o:    runOp,
+			want: operation.Status_CANCELLED,
+		},
+		{
+			desc: "SUCCESS_OP",
+			o:    succOp,
+			want: operation.Status_SUCCESS,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := tc.o.MarkCancelled(); err != nil {
+				t.Fatalf("got unexpected error on MarkCancelled(): %v", err)
+			}
+			if tc.o.OperationStatus != tc.want {
+				t.Errorf("got %s, want: %s", tc.o.OperationStatus, tc.want)
+			}
+			if !tc.o.Complete() {
+				t.Errorf("got Complete() false, want: true")
+			}
+			if err := tc.o.MarkRunning(); err == nil {
+				t.Errorf("got nil error for MarkRunning() on completed operation")
+			}
+		})
+	}
+}
+
+func TestUpdateProgress(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	op, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	if err := op.MarkRunning(); err != nil {
+		t.Fatalf("failed to set status to running: %v", err)
+	}
+
+	want := operation.Progress{
+		Phase:           operation.Phase_CELLS,
+		BytesRead:       1024,
+		RowsProcessed:   10,
+		TotalRows:       40,
+		PercentComplete: 25,
+	}
+	if err := op.UpdateProgress(want); err != nil {
+		t.Fatalf("got unexpected error on UpdateProgress(): %v", err)
+	}
+
+	got, err := operation.GetOperationFromId(tmp.Engine, op.OperationId)
+	if err != nil {
+		t.Fatalf("got unexpected error for GetOperationFromId(%d): %v", op.OperationId, err)
+	}
+	if got.Progress != want {
+		t.Errorf("got Progress: %+v, want: %+v", got.Progress, want)
+	}
+
+	if err := op.MarkSuccess(); err != nil {
+		t.Fatalf("failed to set status to success: %v", err)
+	}
+	if op.Progress.PercentComplete != 100 {
+		t.Errorf("got PercentComplete: %f, want: 100", op.Progress.PercentComplete)
+	}
+	if err := op.UpdateProgress(want); err == nil {
+		t.Errorf("got nil error for UpdateProgress() on completed operation")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	op, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create new operation: %v", err)
+	}
+	events, unsubscribe := op.Subscribe()
+	defer unsubscribe()
+
+	if err := op.MarkRunning(); err != nil {
+		t.Fatalf("failed to set status to running: %v", err)
+	}
+	if err := op.MarkFailed("failed due to user injection"); err != nil {
+		t.Fatalf("failed to set status to failed: %v", err)
+	}
+
+	var got []operation.Status
+	for e := range events {
+		got = append(got, e.OperationStatus)
+	}
+	want := []operation.Status{operation.Status_NOT_STARTED, operation.Status_RUNNING, operation.Status_FAILED}
+	if len(got) != len(want) {
+		t.Fatalf("got events: %v, want: %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got events: %v, want: %v", got, want)
+			break
+		}
+	}
+
+	// Subscribing to a completed operation returns its final state.
+	events, _ = op.Subscribe()
+	e, ok := <-events
+	if !ok || !e.Complete() {
+		t.Errorf("got event: %+v, want: complete event", e)
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("got open channel for completed operation, want: closed")
+	}
+}
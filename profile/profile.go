@@ -0,0 +1,297 @@
+// Package profile computes and caches per-column statistics of a dataset.
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/db"
+	"github.com/dantespe/spectacle/header"
+)
+
+const (
+	// TopValues is the number of most frequent values kept per column.
+	TopValues = 10
+
+	// HistogramBuckets is the number of buckets of a numeric column's
+	// histogram.
+	HistogramBuckets = 10
+)
+
+// Profile holds statistics about each column of a dataset.
+type Profile struct {
+	// DatasetId of the profiled dataset.
+	DatasetId int64 `json:"datasetId"`
+
+	// DataVersion of the dataset when it was profiled.
+	DataVersion int64 `json:"-"`
+
+	// NumRecords in the dataset when it was profiled.
+	NumRecords int64 `json:"numRecords"`
+
+	// CreationTime is when the profile was computed.
+	CreationTime time.Time `json:"creationTime"`
+
+	// Columns in header order.
+	Columns []*Column `json:"columns"`
+}
+
+// Column holds statistics about the values of a header.
+type Column struct {
+	HeaderId    int64            `json:"headerId"`
+	DisplayName string           `json:"displayName"`
+	ValueType   header.ValueType `json:"valueType"`
+
+	// Count of non-blank values.
+	Count int64 `json:"count"`
+
+	// EmptyCount of rows whose value is blank or missing.
+	EmptyCount int64 `json:"emptyCount"`
+
+	// ParseErrors is the number of values that don't parse as ValueType.
+	ParseErrors int64 `json:"parseErrors"`
+
+	// DistinctCount of non-blank values.
+	DistinctCount int64 `json:"distinctCount"`
+
+	// Min and Max values, compared as ValueType. Numbers for INT and FLOAT
+	// columns, times for DATE and TIMESTAMP, and strings otherwise.
+	Min any `json:"min,omitempty"`
+	Max any `json:"max,omitempty"`
+
+	// Mean and StdDev of INT and FLOAT columns.
+	Mean   *float64 `json:"mean,omitempty"`
+	StdDev *float64 `json:"stddev,omitempty"`
+
+	// MinLength and MaxLength of the non-blank values, in characters.
+	MinLength *int64 `json:"minLength,omitempty"`
+	MaxLength *int64 `json:"maxLength,omitempty"`
+
+	// TopValues are the most frequent values, most frequent first.
+	TopValues []*ValueCount `json:"topValues"`
+
+	// Histogram of INT and FLOAT columns, over [Min, Max] in equal width
+	// buckets.
+	Histogram []*Bucket `json:"histogram,omitempty"`
+}
+
+// ValueCount is how often Value occurs.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Bucket counts the values in [Low, High). The last bucket includes High.
+type Bucket struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int64   `json:"count"`
+}
+
+// Compute profiles ds.
+func Compute(ctx context.Context, eng *db.Engine, ds *dataset.Dataset) (*Profile, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("eng must be non-nil")
+	}
+	headers, err := header.GetHeaders(eng, ds.DatasetId)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Profile{
+		DatasetId:    ds.DatasetId,
+		DataVersion:  ds.DataVersion,
+		CreationTime: time.Now().UTC(),
+		Columns:      make([]*Column, 0, len(headers)),
+	}
+	if err := eng.DatabaseHandle.QueryRowContext(ctx, "SELECT COUNT(*) FROM RecordsProcessed WHERE DatasetId = $1", ds.DatasetId).Scan(&p.NumRecords); err != nil {
+		return nil, fmt.Errorf("failed to count records of dataset(datasetId=%d) with error: %v", ds.DatasetId, err)
+	}
+	for _, h := range headers {
+		c, err := computeColumn(ctx, eng, ds.DatasetId, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to profile header(headerId=%d) with error: %v", h.HeaderId, err)
+		}
+		c.EmptyCount = p.NumRecords - c.Count
+		p.Columns = append(p.Columns, c)
+	}
+	return p, nil
+}
+
+// cells joins the Cells of a header to the records of its dataset.
+const cells = "FROM RecordsProcessed rp JOIN Cells c ON c.RecordId = rp.RecordId AND c.HeaderId = $2 WHERE rp.DatasetId = $1"
+
+// nonBlank matches cells with a value.
+const nonBlank = "TRIM(c.RawValue) <> ''"
+
+func computeColumn(ctx context.Context, eng *db.Engine, datasetId int64, h *header.Header) (*Column, error) {
+	c := &Column{
+		HeaderId:    h.HeaderId,
+		DisplayName: h.DisplayName,
+		ValueType:   h.ValueType,
+		TopValues:   make([]*ValueCount, 0),
+	}
+
+	numeric := h.ValueType == header.ValueType_INT || h.ValueType == header.ValueType_FLOAT
+	typed := "c.RawValue"
+	switch h.ValueType {
+	case header.ValueType_INT, header.ValueType_FLOAT:
+		typed = "c.NumericValue"
+	case header.ValueType_DATE, header.ValueType_TIMESTAMP:
+		typed = "c.TimeValue"
+	}
+	moments := "NULL::float8, NULL::float8"
+	if numeric {
+		moments = "AVG(c.NumericValue)::float8, STDDEV_SAMP(c.NumericValue)::float8"
+	}
+
+	q := fmt.Sprintf(`SELECT COUNT(*) FILTER (WHERE %[1]s), COUNT(c.ParseError), COUNT(DISTINCT c.RawValue) FILTER (WHERE %[1]s),
+		MIN(%[2]s), MAX(%[2]s), %[3]s,
+		MIN(LENGTH(c.RawValue)) FILTER (WHERE %[1]s), MAX(LENGTH(c.RawValue)) FILTER (WHERE %[1]s) %[4]s`, nonBlank, typed, moments, cells)
+	var min, max any
+	var mean, stddev sql.NullFloat64
+	var minLength, maxLength sql.NullInt64
+	if err := eng.DatabaseHandle.QueryRowContext(ctx, q, datasetId, h.HeaderId).Scan(&c.Count, &c.ParseErrors, &c.DistinctCount, &min, &max, &mean, &stddev, &minLength, &maxLength); err != nil {
+		return nil, err
+	}
+	c.Min, c.Max = jsonValue(min), jsonValue(max)
+	if mean.Valid {
+		c.Mean = &mean.Float64
+	}
+	if stddev.Valid {
+		c.StdDev = &stddev.Float64
+	}
+	if minLength.Valid {
+		c.MinLength, c.MaxLength = &minLength.Int64, &maxLength.Int64
+	}
+
+	rows, err := eng.DatabaseHandle.QueryContext(ctx, fmt.Sprintf("SELECT c.RawValue, COUNT(*) %s AND %s GROUP BY c.RawValue ORDER BY COUNT(*) DESC, c.RawValue LIMIT %d", cells, nonBlank, TopValues), datasetId, h.HeaderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		vc := &ValueCount{}
+		if err := rows.Scan(&vc.Value, &vc.Count); err != nil {
+			return nil, err
+		}
+		c.TopValues = append(c.TopValues, vc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if numeric {
+		lo, okLo := c.Min.(float64)
+		hi, okHi := c.Max.(float64)
+		if okLo && okHi {
+			if c.Histogram, err = histogram(ctx, eng, datasetId, h.HeaderId, lo, hi); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// histogram counts the NumericValues of a header in HistogramBuckets equal
+// width buckets over [lo, hi].
+func histogram(ctx context.Context, eng *db.Engine, datasetId int64, headerId int64, lo float64, hi float64) ([]*Bucket, error) {
+	n := HistogramBuckets
+	if lo == hi {
+		n = 1
+	}
+	buckets := make([]*Bucket, n)
+	width := (hi - lo) / float64(n)
+	for i := range buckets {
+		buckets[i] = &Bucket{
+			Low:  lo + float64(i)*width,
+			High: lo + float64(i+1)*width,
+		}
+	}
+	buckets[n-1].High = hi
+
+	// width_bucket puts hi in bucket n+1, and can't divide an empty range
+	bucket := "1"
+	args := []any{datasetId, headerId}
+	if n > 1 {
+		bucket = fmt.Sprintf("LEAST(WIDTH_BUCKET(c.NumericValue::float8, $3, $4, %d), %d)", n, n)
+		args = append(args, lo, hi)
+	}
+	rows, err := eng.DatabaseHandle.QueryContext(ctx, fmt.Sprintf("SELECT %s AS b, COUNT(*) %s AND c.NumericValue IS NOT NULL GROUP BY b", bucket, cells), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b int
+		var count int64
+		if err := rows.Scan(&b, &count); err != nil {
+			return nil, err
+		}
+		if b >= 1 && b <= n {
+			buckets[b-1].Count = count
+		}
+	}
+	return buckets, rows.Err()
+}
+
+// jsonValue converts a value scanned from Postgres to one that marshals as
+// JSON. NUMERICs are scanned as bytes, and are returned as float64.
+func jsonValue(v any) any {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	if f, err := strconv.ParseFloat(string(b), 64); err == nil && !math.IsInf(f, 0) {
+		return f
+	}
+	return string(b)
+}
+
+// Get returns the cached profile of a dataset, or nil if there is none.
+func Get(eng *db.Engine, datasetId int64) (*Profile, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("eng must be non-nil")
+	}
+	var version int64
+	var b []byte
+	err := eng.DatabaseHandle.QueryRow("SELECT DataVersion, Profile FROM Profiles WHERE DatasetId = $1", datasetId).Scan(&version, &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query for profile(datasetId=%d) with error: %v", datasetId, err)
+	}
+	p := &Profile{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal profile(datasetId=%d) with error: %v", datasetId, err)
+	}
+	p.DataVersion = version
+	return p, nil
+}
+
+// Save caches p, replacing any earlier profile of its dataset.
+func (p *Profile) Save(eng *db.Engine) error {
+	if eng == nil {
+		return fmt.Errorf("eng must be non-nil")
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := eng.DatabaseHandle.Exec("INSERT INTO Profiles (DatasetId, DataVersion, Profile) VALUES ($1, $2, $3) ON CONFLICT (DatasetId) DO UPDATE SET DataVersion = EXCLUDED.DataVersion, Profile = EXCLUDED.Profile", p.DatasetId, p.DataVersion, b); err != nil {
+		return fmt.Errorf("failed to save profile(datasetId=%d) with error: %v", p.DatasetId, err)
+	}
+	return nil
+}
+
+// Current reports whether p is the profile of the data ds has now.
+func (p *Profile) Current(ds *dataset.Dataset) bool {
+	return p != nil && p.DatasetId == ds.DatasetId && p.DataVersion == ds.DataVersion
+}
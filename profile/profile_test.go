@@ -0,0 +1,134 @@
+// Tests for github.com/dantespe/spectacle/profile.
+package profile_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/dantespe/spectacle/cell"
+	"github.com/dantespe/spectacle/dataset"
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/operation"
+	"github.com/dantespe/spectacle/profile"
+	"github.com/dantespe/spectacle/record"
+	spectesting "github.com/dantespe/spectacle/testing"
+)
+
+func TestCompute(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+	op, err := operation.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create a Operation with error: %v", err)
+	}
+	team, err := header.New(tmp.Engine, ds.DatasetId, header.WithDisplayName("TEAM"))
+	if err != nil {
+		t.Fatalf("failed to create Header(%d) with err: %v", ds.DatasetId, err)
+	}
+	wins, err := header.New(tmp.Engine, ds.DatasetId, header.WithDisplayName("WINS"))
+	if err != nil {
+		t.Fatalf("failed to create Header(%d) with err: %v", ds.DatasetId, err)
+	}
+	if err := wins.SetValueType(header.ValueType_INT); err != nil {
+		t.Fatalf("failed to set ValueType with err: %v", err)
+	}
+
+	for _, row := range [][]string{
+		{"Celtics", "10"},
+		{"Lakers", "20"},
+		{"Celtics", ""},
+		{"Heat", "x"},
+	} {
+		rc, err := record.New(tmp.Engine, ds.DatasetId)
+		if err != nil {
+			t.Fatalf("failed to create new record with error: %v", err)
+		}
+		for i, h := range []*header.Header{team, wins} {
+			if _, err := cell.New(tmp.Engine, rc.RecordId, h.HeaderId, op.OperationId, row[i]); err != nil {
+				t.Fatalf("failed to create a cell with error: %v", err)
+			}
+		}
+		if _, err := tmp.Engine.DatabaseHandle.Exec("INSERT INTO RecordsProcessed (RecordId, DatasetId) VALUES ($1, $2)", rc.RecordId, ds.DatasetId); err != nil {
+			t.Fatalf("failed to process record with error: %v", err)
+		}
+	}
+	if err := cell.Retype(context.Background(), tmp.Engine, wins.HeaderId, header.ValueType_INT); err != nil {
+		t.Fatalf("got unexpected err on Retype: %v", err)
+	}
+
+	p, err := profile.Compute(context.Background(), tmp.Engine, ds)
+	if err != nil {
+		t.Fatalf("got unexpected err on Compute: %v", err)
+	}
+	if p.NumRecords != 4 || len(p.Columns) != 2 {
+		t.Fatalf("Compute() = %d records, %d columns, want: 4 records, 2 columns", p.NumRecords, len(p.Columns))
+	}
+
+	got := p.Columns[0]
+	if got.Count != 4 || got.EmptyCount != 0 || got.DistinctCount != 3 || got.Min != "Celtics" || got.Max != "Lakers" {
+		t.Errorf("Compute() TEAM = %+v", got)
+	}
+	wantTop := []*profile.ValueCount{{Value: "Celtics", Count: 2}, {Value: "Heat", Count: 1}, {Value: "Lakers", Count: 1}}
+	if diff := cmp.Diff(got.TopValues, wantTop); diff != "" {
+		t.Errorf("Compute() TEAM TopValues diff: %s", diff)
+	}
+
+	got = p.Columns[1]
+	if got.Count != 3 || got.EmptyCount != 1 || got.ParseErrors != 1 || got.Min != 10.0 || got.Max != 20.0 {
+		t.Errorf("Compute() WINS = %+v", got)
+	}
+	if got.Mean == nil || *got.Mean != 15 {
+		t.Errorf("Compute() WINS Mean = %v, want: 15", got.Mean)
+	}
+	if len(got.Histogram) != profile.HistogramBuckets || got.Histogram[0].Count != 1 || got.Histogram[profile.HistogramBuckets-1].Count != 1 {
+		t.Errorf("Compute() WINS Histogram = %v", got.Histogram)
+	}
+}
+
+func TestSaveAndGet(t *testing.T) {
+	tmp, err := spectesting.NewTempPostgres()
+	if err != nil {
+		t.Fatalf("failed to create temp postgres database with err: %v", err)
+	}
+	defer tmp.Close()
+
+	ds, err := dataset.New(tmp.Engine)
+	if err != nil {
+		t.Fatalf("failed to create New dataset: %v", err)
+	}
+	if got, err := profile.Get(tmp.Engine, ds.DatasetId); err != nil || got != nil {
+		t.Fatalf("Get() = %v, %v, want: nil, nil", got, err)
+	}
+
+	p, err := profile.Compute(context.Background(), tmp.Engine, ds)
+	if err != nil {
+		t.Fatalf("got unexpected err on Compute: %v", err)
+	}
+	if err := p.Save(tmp.Engine); err != nil {
+		t.Fatalf("got unexpected err on Save: %v", err)
+	}
+	got, err := profile.Get(tmp.Engine, ds.DatasetId)
+	if err != nil {
+		t.Fatalf("got unexpected err on Get: %v", err)
+	}
+	if !got.Current(ds) {
+		t.Errorf("Current() = false, want: true")
+	}
+
+	if err := ds.MarkChanged(); err != nil {
+		t.Fatalf("got unexpected err on MarkChanged: %v", err)
+	}
+	if got.Current(ds) {
+		t.Errorf("Current() after MarkChanged = true, want: false")
+	}
+}
@@ -0,0 +1,126 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// AggOp is an aggregate function.
+type AggOp string
+
+const (
+	AggOp_COUNT          AggOp = "count"
+	AggOp_COUNT_DISTINCT AggOp = "count_distinct"
+	AggOp_SUM            AggOp = "sum"
+	AggOp_AVG            AggOp = "avg"
+	AggOp_MIN            AggOp = "min"
+	AggOp_MAX            AggOp = "max"
+	AggOp_MEDIAN         AggOp = "median"
+	AggOp_PERCENTILE     AggOp = "percentile"
+)
+
+// Aggregation computes Op over the values of Column in each group.
+type Aggregation struct {
+	Op AggOp `json:"op"`
+
+	// Column is named as in a filter. It may be empty for count, which then
+	// counts rows.
+	Column string `json:"column,omitempty"`
+
+	// Percentile is the fraction, in [0, 1], computed by percentile.
+	Percentile float64 `json:"percentile,omitempty"`
+
+	// As names the result. Defaults to e.g. sum(ARENACAPACITY).
+	As string `json:"as,omitempty"`
+}
+
+// ParseAggregation parses an aggregation written as op[:column[:percentile]],
+// e.g. "count", "sum:ARENACAPACITY" or "percentile:ARENACAPACITY:0.9".
+func ParseAggregation(s string) (*Aggregation, error) {
+	parts := strings.SplitN(s, ":", 3)
+	a := &Aggregation{Op: AggOp(strings.ToLower(strings.TrimSpace(parts[0])))}
+	if len(parts) > 1 {
+		a.Column = strings.Trim(strings.TrimSpace(parts[1]), "`")
+	}
+	if len(parts) > 2 {
+		p, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile: %q", parts[2])
+		}
+		a.Percentile = p
+	}
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Validate returns an error if a isn't a valid aggregation.
+func (a *Aggregation) Validate() error {
+	switch a.Op {
+	case AggOp_COUNT:
+		return nil
+	case AggOp_COUNT_DISTINCT, AggOp_SUM, AggOp_AVG, AggOp_MIN, AggOp_MAX, AggOp_MEDIAN:
+	case AggOp_PERCENTILE:
+		if a.Percentile < 0 || a.Percentile > 1 {
+			return fmt.Errorf("percentile must be between 0 and 1, got: %v", a.Percentile)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation: %q", a.Op)
+	}
+	if a.Column == "" {
+		return fmt.Errorf("%s requires a column", a.Op)
+	}
+	return nil
+}
+
+// Name of a's result.
+func (a *Aggregation) Name() string {
+	switch {
+	case a.As != "":
+		return a.As
+	case a.Column == "":
+		return string(a.Op)
+	case a.Op == AggOp_PERCENTILE:
+		return fmt.Sprintf("%s(%s, %v)", a.Op, a.Column, a.Percentile)
+	}
+	return fmt.Sprintf("%s(%s)", a.Op, a.Column)
+}
+
+// SQL returns the aggregate expression of a over the rows of a group.
+// Column returns the SQL expression of a column's value for a row.
+//
+// sum, avg, median and percentile require an INT or FLOAT column.
+func (a *Aggregation) SQL(resolve Resolver, column func(h *header.Header) string, args *Args) (string, error) {
+	if a.Column == "" {
+		return "COUNT(*)", nil
+	}
+	h, err := resolve(a.Column)
+	if err != nil {
+		return "", err
+	}
+	v := column(h)
+
+	switch a.Op {
+	case AggOp_COUNT:
+		return fmt.Sprintf("COUNT(%s)", v), nil
+	case AggOp_COUNT_DISTINCT:
+		return fmt.Sprintf("COUNT(DISTINCT %s)", v), nil
+	case AggOp_MIN, AggOp_MAX:
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(string(a.Op)), v), nil
+	}
+
+	if h.ValueType != header.ValueType_INT && h.ValueType != header.ValueType_FLOAT {
+		return "", fmt.Errorf("%s requires a numeric column, %q is %s", a.Op, a.Column, h.ValueType)
+	}
+	switch a.Op {
+	case AggOp_SUM, AggOp_AVG:
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(string(a.Op)), v), nil
+	case AggOp_MEDIAN:
+		return fmt.Sprintf("percentile_cont(0.5) WITHIN GROUP (ORDER BY %s)", v), nil
+	}
+	return fmt.Sprintf("percentile_cont(%s::float8) WITHIN GROUP (ORDER BY %s)", args.Add(a.Percentile), v), nil
+}
@@ -0,0 +1,73 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+func TestParseAggregation(t *testing.T) {
+	testCases := []struct {
+		agg  string
+		want string
+	}{
+		{"count", "count"},
+		{"COUNT:CITY", "count(CITY)"},
+		{"count_distinct:CITY", "count_distinct(CITY)"},
+		{"sum:`ARENA CAPACITY`", "sum(ARENA CAPACITY)"},
+		{"percentile:ARENACAPACITY:0.9", "percentile(ARENACAPACITY, 0.9)"},
+	}
+	for _, tc := range testCases {
+		a, err := query.ParseAggregation(tc.agg)
+		if err != nil {
+			t.Errorf("ParseAggregation(%q) got unexpected error: %v", tc.agg, err)
+			continue
+		}
+		if got := a.Name(); got != tc.want {
+			t.Errorf("ParseAggregation(%q).Name() = %s, want: %s", tc.agg, got, tc.want)
+		}
+	}
+
+	for _, agg := range []string{"mode:CITY", "sum", "median:", "percentile:ARENACAPACITY:1.5", "percentile:ARENACAPACITY:high"} {
+		if _, err := query.ParseAggregation(agg); err == nil {
+			t.Errorf("ParseAggregation(%q) expected error, got nil", agg)
+		}
+	}
+}
+
+func TestAggregationSQL(t *testing.T) {
+	resolve := query.HeaderResolver([]*header.Header{
+		{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+		{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+	})
+	column := func(h *header.Header) string { return h.DisplayName }
+
+	testCases := []struct {
+		agg  query.Aggregation
+		want string
+	}{
+		{query.Aggregation{Op: query.AggOp_COUNT}, "COUNT(*)"},
+		{query.Aggregation{Op: query.AggOp_COUNT_DISTINCT, Column: "CITY"}, "COUNT(DISTINCT CITY)"},
+		{query.Aggregation{Op: query.AggOp_MAX, Column: "CITY"}, "MAX(CITY)"},
+		{query.Aggregation{Op: query.AggOp_AVG, Column: "ARENACAPACITY"}, "AVG(ARENACAPACITY)"},
+		{query.Aggregation{Op: query.AggOp_MEDIAN, Column: "ARENACAPACITY"}, "percentile_cont(0.5) WITHIN GROUP (ORDER BY ARENACAPACITY)"},
+		{query.Aggregation{Op: query.AggOp_PERCENTILE, Column: "ARENACAPACITY", Percentile: 0.9}, "percentile_cont($2::float8) WITHIN GROUP (ORDER BY ARENACAPACITY)"},
+	}
+	for _, tc := range testCases {
+		got, err := tc.agg.SQL(resolve, column, query.NewArgs(int64(1)))
+		if err != nil {
+			t.Errorf("%s.SQL() got unexpected error: %v", tc.agg.Name(), err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s.SQL() = %s, want: %s", tc.agg.Name(), got, tc.want)
+		}
+	}
+
+	// Only numeric columns can be summed
+	a := query.Aggregation{Op: query.AggOp_SUM, Column: "CITY"}
+	if _, err := a.SQL(resolve, column, query.NewArgs()); err == nil {
+		t.Errorf("SQL() expected error for sum of a STRING column, got nil")
+	}
+}
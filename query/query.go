@@ -0,0 +1,300 @@
+// Package query parses row filters, and translates them to SQL over the
+// Cells of a dataset.
+//
+// A filter compares columns to values, and combines comparisons with and,
+// or, not and parentheses:
+//
+//	CITY eq "Boston" and (ARENACAPACITY gt 18000 or not `HEAD COACH` startswith "B")
+//
+// Columns are named by their display name, quoted with backticks if it has
+// spaces, or by header id. Values are double quoted strings, numbers, true
+// or false.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Op_EQ         Op = "eq"
+	Op_NE         Op = "ne"
+	Op_GT         Op = "gt"
+	Op_GE         Op = "ge"
+	Op_LT         Op = "lt"
+	Op_LE         Op = "le"
+	Op_CONTAINS   Op = "contains"
+	Op_STARTSWITH Op = "startswith"
+)
+
+var ops = map[Op]bool{
+	Op_EQ:         true,
+	Op_NE:         true,
+	Op_GT:         true,
+	Op_GE:         true,
+	Op_LT:         true,
+	Op_LE:         true,
+	Op_CONTAINS:   true,
+	Op_STARTSWITH: true,
+}
+
+// Kind of a literal Value.
+type Kind int
+
+const (
+	Kind_STRING Kind = iota
+	Kind_NUMBER
+	Kind_BOOL
+)
+
+// Value is a literal in a filter.
+type Value struct {
+	Kind Kind
+	Raw  string
+}
+
+func (v Value) String() string {
+	if v.Kind == Kind_STRING {
+		return strconv.Quote(v.Raw)
+	}
+	return v.Raw
+}
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	fmt.Stringer
+	expr()
+}
+
+// And matches rows that match both Left and Right.
+type And struct {
+	Left, Right Expr
+}
+
+// Or matches rows that match Left or Right.
+type Or struct {
+	Left, Right Expr
+}
+
+// Not matches rows that don't match X.
+type Not struct {
+	X Expr
+}
+
+// Compare matches rows whose Field column compares to Value by Op.
+type Compare struct {
+	Field string
+	Op    Op
+	Value Value
+}
+
+func (*And) expr()     {}
+func (*Or) expr()      {}
+func (*Not) expr()     {}
+func (*Compare) expr() {}
+
+func (e *And) String() string { return fmt.Sprintf("(%s and %s)", e.Left, e.Right) }
+func (e *Or) String() string  { return fmt.Sprintf("(%s or %s)", e.Left, e.Right) }
+func (e *Not) String() string { return fmt.Sprintf("not %s", e.X) }
+func (e *Compare) String() string {
+	return fmt.Sprintf("`%s` %s %s", e.Field, e.Op, e.Value)
+}
+
+// tokenKind of a lexed token.
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenField
+	tokenLParen
+	tokenRParen
+	tokenEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits s into tokens. Words are runs of anything but white space,
+// parentheses and quotes.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case r == '"' || r == '`':
+			kind := tokenString
+			if r == '`' {
+				kind = tokenField
+			}
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				b.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated %c at position %d", r, i)
+			}
+			tokens = append(tokens, token{kind, b.String(), i})
+			i = j + 1
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune("()\"`", rs[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, string(rs[i:j]), i})
+			i = j
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(rs)}), nil
+}
+
+// parser is a recursive descent parser over tokens.
+type parser struct {
+	tokens []token
+	i      int
+}
+
+// Parse parses a filter.
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// keyword consumes the next token if it is the word kw.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.keyword("not") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, fmt.Errorf("want ) at position %d", t.pos)
+		}
+		return e, nil
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (Expr, error) {
+	f := p.next()
+	if f.kind != tokenWord && f.kind != tokenField {
+		return nil, fmt.Errorf("want a column at position %d", f.pos)
+	}
+
+	o := p.next()
+	op := Op(strings.ToLower(o.text))
+	if o.kind != tokenWord || !ops[op] {
+		return nil, fmt.Errorf("want an operator at position %d, got: %q", o.pos, o.text)
+	}
+
+	v := p.next()
+	c := &Compare{Field: f.text, Op: op, Value: Value{Raw: v.text}}
+	switch {
+	case v.kind == tokenString:
+		c.Value.Kind = Kind_STRING
+	case v.kind != tokenWord:
+		return nil, fmt.Errorf("want a value at position %d", v.pos)
+	case strings.EqualFold(v.text, "true") || strings.EqualFold(v.text, "false"):
+		c.Value = Value{Kind: Kind_BOOL, Raw: strings.ToLower(v.text)}
+	default:
+		if _, err := strconv.ParseFloat(v.text, 64); err != nil {
+			return nil, fmt.Errorf("want a quoted string, number or bool at position %d, got: %q", v.pos, v.text)
+		}
+		c.Value.Kind = Kind_NUMBER
+	}
+
+	if (op == Op_CONTAINS || op == Op_STARTSWITH) && c.Value.Kind != Kind_STRING {
+		return nil, fmt.Errorf("%s wants a quoted string at position %d", op, v.pos)
+	}
+	return c, nil
+}
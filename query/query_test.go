@@ -0,0 +1,134 @@
+package query_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		filter string
+		want   string
+	}{
+		{`CITY eq "Boston"`, "`CITY` eq \"Boston\""},
+		{`CITY eq "Boston" and ARENACAPACITY gt 18000`, "(`CITY` eq \"Boston\" and `ARENACAPACITY` gt 18000)"},
+		{`a eq 1 or b eq 2 and c eq 3`, "(`a` eq 1 or (`b` eq 2 and `c` eq 3))"},
+		{`(a eq 1 or b eq 2) and c eq 3`, "((`a` eq 1 or `b` eq 2) and `c` eq 3)"},
+		{`not a eq TRUE`, "not `a` eq true"},
+		{"`HEAD COACH` STARTSWITH \"B\"", "`HEAD COACH` startswith \"B\""},
+		{`NICKNAME contains "say \"hi\""`, "`NICKNAME` contains \"say \\\"hi\\\"\""},
+		{`10 le -2.5`, "`10` le -2.5"},
+	}
+	for _, tc := range testCases {
+		e, err := query.Parse(tc.filter)
+		if err != nil {
+			t.Errorf("Parse(%q) got unexpected error: %v", tc.filter, err)
+			continue
+		}
+		if got := e.String(); got != tc.want {
+			t.Errorf("Parse(%q) = %s, want: %s", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`CITY`,
+		`CITY eq`,
+		`CITY is "Boston"`,
+		`CITY eq Boston`,
+		`CITY eq "Boston`,
+		`CITY eq "Boston" and`,
+		`(CITY eq "Boston"`,
+		`CITY eq "Boston")`,
+		`CITY contains 1`,
+		`CITY eq "Boston"; DROP TABLE Cells`,
+	} {
+		if _, err := query.Parse(filter); err == nil {
+			t.Errorf("Parse(%q) expected error, got nil", filter)
+		}
+	}
+}
+
+func TestSQL(t *testing.T) {
+	headers := []*header.Header{
+		{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+		{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+		{HeaderId: 11, DisplayName: "FOUNDED", ValueType: header.ValueType_DATE},
+		{HeaderId: 12, DisplayName: "ACTIVE", ValueType: header.ValueType_BOOL},
+	}
+	resolve := query.HeaderResolver(headers)
+
+	testCases := []struct {
+		filter   string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			filter:   `CITY eq "Boston" and ARENACAPACITY gt 18000`,
+			wantSQL:  "(EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.RawValue = $3) AND EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $4 AND c.NumericValue > $5::numeric))",
+			wantArgs: []any{int64(1), int64(8), "Boston", int64(10), "18000"},
+		},
+		{
+			filter:   `not 8 contains "50%_"`,
+			wantSQL:  "NOT EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.RawValue LIKE $3)",
+			wantArgs: []any{int64(1), int64(8), `%50\%\_%`},
+		},
+		{
+			filter:   `FOUNDED ge "1946-06-06" or ACTIVE ne false`,
+			wantSQL:  "(EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.TimeValue >= $3) OR EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $4 AND c.BoolValue <> $5))",
+			wantArgs: []any{int64(1), int64(11), time.Date(1946, 6, 6, 0, 0, 0, 0, time.UTC), int64(12), false},
+		},
+		{
+			// Values that don't parse as the column's type compare as text
+			filter:   `ARENACAPACITY eq "n/a"`,
+			wantSQL:  "EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.RawValue = $3)",
+			wantArgs: []any{int64(1), int64(10), "n/a"},
+		},
+		{
+			// Numbers are compared exactly, not as a float64
+			filter:   `ARENACAPACITY eq 9007199254740993`,
+			wantSQL:  "EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.NumericValue = $3::numeric)",
+			wantArgs: []any{int64(1), int64(10), "9007199254740993"},
+		},
+		{
+			filter:   `ARENACAPACITY lt "0x10"`,
+			wantSQL:  "EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = r.RecordId AND c.HeaderId = $2 AND c.RawValue < $3)",
+			wantArgs: []any{int64(1), int64(10), "0x10"},
+		},
+	}
+	for _, tc := range testCases {
+		e, err := query.Parse(tc.filter)
+		if err != nil {
+			t.Fatalf("Parse(%q) got unexpected error: %v", tc.filter, err)
+		}
+		args := query.NewArgs(int64(1))
+		got, err := query.SQL(e, "r.RecordId", resolve, args)
+		if err != nil {
+			t.Errorf("SQL(%q) got unexpected error: %v", tc.filter, err)
+			continue
+		}
+		if got != tc.wantSQL {
+			t.Errorf("SQL(%q) = %s, want: %s", tc.filter, got, tc.wantSQL)
+		}
+		if !reflect.DeepEqual(args.Values(), tc.wantArgs) {
+			t.Errorf("SQL(%q) args = %v, want: %v", tc.filter, args.Values(), tc.wantArgs)
+		}
+	}
+}
+
+func TestSQLUnknownColumn(t *testing.T) {
+	e, err := query.Parse(`TEAM eq "Celtics"`)
+	if err != nil {
+		t.Fatalf("got unexpected error for Parse(): %v", err)
+	}
+	resolve := query.HeaderResolver([]*header.Header{{HeaderId: 8, DisplayName: "CITY"}})
+	if _, err := query.SQL(e, "r.RecordId", resolve, query.NewArgs()); err == nil {
+		t.Errorf("SQL() expected error for unknown column, got nil")
+	}
+}
@@ -0,0 +1,986 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// Table is a dataset that a SELECT reads from.
+type Table struct {
+	DatasetId int64
+	Headers   []*header.Header
+}
+
+// TableResolver returns the Table a SELECT's FROM clause names.
+type TableResolver func(name string) (*Table, error)
+
+// Compiled is a SELECT rewritten against the Cells of its dataset.
+type Compiled struct {
+	SQL  string
+	Args []any
+
+	// Columns of the result. Columns that select a header as is have its
+	// HeaderId and ValueType.
+	Columns []*header.Header
+}
+
+// functions that a SELECT may call, and whether they are aggregates.
+var functions = map[string]bool{
+	"count":      true,
+	"sum":        true,
+	"avg":        true,
+	"min":        true,
+	"max":        true,
+	"lower":      false,
+	"upper":      false,
+	"length":     false,
+	"trim":       false,
+	"abs":        false,
+	"round":      false,
+	"floor":      false,
+	"ceil":       false,
+	"coalesce":   false,
+	"date_trunc": false,
+}
+
+// keywords can't be used as bare column names or aliases.
+var keywords = map[string]bool{
+	"select": true, "distinct": true, "from": true, "where": true, "group": true,
+	"by": true, "having": true, "order": true, "limit": true, "offset": true,
+	"and": true, "or": true, "not": true, "as": true, "asc": true, "desc": true,
+	"is": true, "null": true, "like": true, "ilike": true, "in": true,
+	"between": true, "true": true, "false": true, "nulls": true, "first": true,
+	"last": true,
+}
+
+// CompileSelect parses s, a read-only SELECT over a single dataset, and
+// rewrites it as SQL over the Cells of the dataset:
+//
+//	SELECT [DISTINCT] * | expr [[AS] alias], ...
+//	FROM dataset [[AS] alias]
+//	[WHERE expr] [GROUP BY expr, ...] [HAVING expr]
+//	[ORDER BY expr [ASC | DESC] [NULLS FIRST | LAST], ...]
+//	[LIMIT n] [OFFSET n]
+//
+// Columns are named by display name, double quoted if they have spaces or
+// are keywords. Unquoted names that match no column exactly match ignoring
+// case. Each column has its typed value, or its RawValue if it has no type.
+//
+// At most maxRows rows are returned, whatever the LIMIT.
+func CompileSelect(s string, resolveTable TableResolver, maxRows int64) (*Compiled, error) {
+	tokens, err := sqlLex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	stmt, err := p.selectStmt()
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := resolveTable(stmt.from)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiler{
+		stmt:    stmt,
+		table:   table,
+		args:    NewArgs(table.DatasetId),
+		columns: make(map[int64]string),
+	}
+	return c.compile(maxRows)
+}
+
+// sqlToken kinds.
+const (
+	sqlIdent = iota
+	sqlQuoted
+	sqlString
+	sqlNumber
+	sqlSymbol
+	sqlEOF
+)
+
+type sqlToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// is reports whether t is the keyword or symbol s.
+func (t sqlToken) is(s string) bool {
+	switch t.kind {
+	case sqlIdent:
+		return strings.EqualFold(t.text, s)
+	case sqlSymbol:
+		return t.text == s
+	}
+	return false
+}
+
+func sqlLex(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"' || r == '`':
+			kind := sqlQuoted
+			if r == '\'' {
+				kind = sqlString
+			}
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == r {
+					// Quotes are escaped by doubling them
+					if j+1 < len(rs) && rs[j+1] == r {
+						j++
+					} else {
+						break
+					}
+				}
+				b.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated %c at position %d", r, i)
+			}
+			tokens = append(tokens, sqlToken{kind, b.String(), i})
+			i = j + 1
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			if j < len(rs) && (rs[j] == 'e' || rs[j] == 'E') {
+				k := j + 1
+				if k < len(rs) && (rs[k] == '+' || rs[k] == '-') {
+					k++
+				}
+				if k < len(rs) && unicode.IsDigit(rs[k]) {
+					for j = k; j < len(rs) && unicode.IsDigit(rs[j]); j++ {
+					}
+				}
+			}
+			text := string(rs[i:j])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, i)
+			}
+			tokens = append(tokens, sqlToken{sqlNumber, text, i})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{sqlIdent, string(rs[i:j]), i})
+			i = j
+		default:
+			sym := string(r)
+			if i+1 < len(rs) {
+				switch two := string(rs[i : i+2]); two {
+				case "<=", ">=", "<>", "!=", "||":
+					sym = two
+				}
+			}
+			if !strings.Contains("=<>+-*/%(),.;", sym) && len(sym) == 1 {
+				return nil, fmt.Errorf("unexpected %q at position %d", sym, i)
+			}
+			tokens = append(tokens, sqlToken{sqlSymbol, sym, i})
+			i += len([]rune(sym))
+		}
+	}
+	return append(tokens, sqlToken{sqlEOF, "", len(rs)}), nil
+}
+
+// node is an expression of a SELECT.
+type node interface{}
+
+type (
+	identNode struct {
+		qualifier string
+		name      string
+		quoted    bool
+		pos       int
+	}
+	literalNode struct {
+		kind int // sqlString, sqlNumber or sqlIdent for TRUE, FALSE and NULL
+		text string
+	}
+	unaryNode struct {
+		op string
+		x  node
+	}
+	binaryNode struct {
+		op   string
+		l, r node
+	}
+	callNode struct {
+		name     string
+		distinct bool
+		star     bool
+		args     []node
+	}
+	isNullNode struct {
+		x   node
+		not bool
+	}
+	inNode struct {
+		x    node
+		not  bool
+		list []node
+	}
+	betweenNode struct {
+		x, lo, hi node
+		not       bool
+	}
+)
+
+type selectItem struct {
+	x  node
+	as string
+}
+
+type orderItem struct {
+	x     node
+	desc  bool
+	nulls string
+}
+
+type selectStmt struct {
+	distinct  bool
+	star      bool
+	items     []selectItem
+	from      string
+	fromAlias string
+	where     node
+	groupBy   []node
+	having    node
+	orderBy   []orderItem
+	limit     int64
+	offset    int64
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	i      int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.i]
+	if t.kind != sqlEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the keyword or symbol s.
+func (p *sqlParser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(s string) error {
+	if t := p.next(); !t.is(s) {
+		return unexpected(t, strings.ToUpper(s))
+	}
+	return nil
+}
+
+func unexpected(t sqlToken, want string) error {
+	if t.kind == sqlEOF {
+		return fmt.Errorf("want %s at end of query", want)
+	}
+	return fmt.Errorf("want %s at position %d, got: %q", want, t.pos, t.text)
+}
+
+// name parses an identifier, such as a column or alias.
+func (p *sqlParser) name() (string, bool, error) {
+	t := p.next()
+	switch {
+	case t.kind == sqlQuoted:
+		return t.text, true, nil
+	case t.kind == sqlIdent && !keywords[strings.ToLower(t.text)]:
+		return t.text, false, nil
+	}
+	return "", false, unexpected(t, "a name")
+}
+
+// alias parses an optional [AS] alias.
+func (p *sqlParser) alias() (string, error) {
+	if p.accept("as") {
+		a, _, err := p.name()
+		return a, err
+	}
+	if t := p.peek(); t.kind == sqlQuoted || t.kind == sqlIdent && !keywords[strings.ToLower(t.text)] {
+		a, _, err := p.name()
+		return a, err
+	}
+	return "", nil
+}
+
+func (p *sqlParser) integer() (int64, error) {
+	t := p.next()
+	if t.kind != sqlNumber {
+		return 0, unexpected(t, "a number")
+	}
+	n, err := strconv.ParseInt(t.text, 10, 64)
+	if err != nil || n < 0 {
+		return 0, unexpected(t, "a non-negative integer")
+	}
+	return n, nil
+}
+
+func (p *sqlParser) selectStmt() (*selectStmt, error) {
+	stmt := &selectStmt{limit: -1}
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	stmt.distinct = p.accept("distinct")
+
+	if p.accept("*") {
+		stmt.star = true
+	} else {
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			as, err := p.alias()
+			if err != nil {
+				return nil, err
+			}
+			stmt.items = append(stmt.items, selectItem{x: x, as: as})
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.from, _, err = p.name(); err != nil {
+		return nil, err
+	}
+	if stmt.fromAlias, err = p.alias(); err != nil {
+		return nil, err
+	}
+
+	if p.accept("where") {
+		if stmt.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		if stmt.groupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("having") {
+		if stmt.having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			o := orderItem{x: x}
+			if p.accept("desc") {
+				o.desc = true
+			} else {
+				p.accept("asc")
+			}
+			if p.accept("nulls") {
+				switch t := p.next(); {
+				case t.is("first"), t.is("last"):
+					o.nulls = strings.ToUpper(t.text)
+				default:
+					return nil, unexpected(t, "FIRST or LAST")
+				}
+			}
+			stmt.orderBy = append(stmt.orderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		if stmt.limit, err = p.integer(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("offset") {
+		if stmt.offset, err = p.integer(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.accept(";")
+	if t := p.peek(); t.kind != sqlEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) exprList() ([]node, error) {
+	var list []node
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if !p.accept(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *sqlParser) expr() (node, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: "OR", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *sqlParser) and() (node, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: "AND", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *sqlParser) not() (node, error) {
+	if p.accept("not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "NOT", x: x}, nil
+	}
+	return p.predicate()
+}
+
+var comparisons = map[string]string{
+	"=":  "=",
+	"<>": "<>",
+	"!=": "<>",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+func (p *sqlParser) predicate() (node, error) {
+	x, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == sqlSymbol && comparisons[t.text] != "" {
+		p.next()
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: comparisons[t.text], l: x, r: r}, nil
+	}
+	if p.accept("is") {
+		not := p.accept("not")
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		return &isNullNode{x: x, not: not}, nil
+	}
+
+	not := p.accept("not")
+	switch {
+	case p.peek().is("like"), p.peek().is("ilike"):
+		op := strings.ToUpper(p.next().text)
+		if not {
+			op = "NOT " + op
+		}
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, l: x, r: r}, nil
+	case p.accept("in"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &inNode{x: x, not: not, list: list}, nil
+	case p.accept("between"):
+		lo, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		hi, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenNode{x: x, not: not, lo: lo, hi: hi}, nil
+	}
+	if not {
+		return nil, unexpected(p.peek(), "LIKE, ILIKE, IN or BETWEEN")
+	}
+	return x, nil
+}
+
+func (p *sqlParser) additive() (node, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is("+") && !t.is("-") && !t.is("||") {
+			return l, nil
+		}
+		p.next()
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *sqlParser) multiplicative() (node, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is("*") && !t.is("/") && !t.is("%") {
+			return l, nil
+		}
+		p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op: t.text, l: l, r: r}
+	}
+}
+
+func (p *sqlParser) unary() (node, error) {
+	if p.accept("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "-", x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *sqlParser) primary() (node, error) {
+	t := p.peek()
+	switch {
+	case t.kind == sqlNumber || t.kind == sqlString:
+		p.next()
+		return &literalNode{kind: t.kind, text: t.text}, nil
+	case t.is("true"), t.is("false"), t.is("null"):
+		p.next()
+		return &literalNode{kind: sqlIdent, text: strings.ToUpper(t.text)}, nil
+	case t.is("("):
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+
+	name, quoted, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if !quoted && p.peek().is("(") {
+		return p.call(name, t)
+	}
+	id := &identNode{name: name, quoted: quoted, pos: t.pos}
+	if p.accept(".") {
+		id.qualifier = id.name
+		if id.name, id.quoted, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	return id, nil
+}
+
+func (p *sqlParser) call(name string, t sqlToken) (node, error) {
+	name = strings.ToLower(name)
+	aggregate, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name, t.pos)
+	}
+	p.next() // (
+
+	c := &callNode{name: name}
+	switch {
+	case name == "count" && p.accept("*"):
+		c.star = true
+	case !p.peek().is(")"):
+		c.distinct = aggregate && p.accept("distinct")
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		c.args = args
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compiler rewrites a selectStmt. Each column the statement uses is selected
+// once per record in a subquery t, as t.c<n>.
+type compiler struct {
+	stmt    *selectStmt
+	table   *Table
+	args    *Args
+	columns map[int64]string
+	selects []string
+
+	// outputs are the names of the result's columns.
+	outputs []string
+}
+
+func (c *compiler) compile(maxRows int64) (*Compiled, error) {
+	stmt := c.stmt
+	items := stmt.items
+	if stmt.star {
+		for _, h := range c.table.Headers {
+			items = append(items, selectItem{x: &identNode{name: h.DisplayName, quoted: true}})
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%q has no columns", stmt.from)
+	}
+
+	result := &Compiled{}
+	var outs []string
+	for i, item := range items {
+		s, err := c.expr(item.x)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, fmt.Sprintf("%s AS o%d", s, i+1))
+
+		col := &header.Header{DisplayName: item.as}
+		if id, ok := item.x.(*identNode); ok {
+			h, _ := c.resolve(id)
+			col.HeaderId, col.ValueType = h.HeaderId, h.ValueType
+			if col.DisplayName == "" {
+				col.DisplayName = h.DisplayName
+			}
+		}
+		if call, ok := item.x.(*callNode); ok && col.DisplayName == "" {
+			col.DisplayName = call.name
+		}
+		if col.DisplayName == "" {
+			col.DisplayName = header.DefaultDisplayName(i)
+		}
+		result.Columns = append(result.Columns, col)
+		c.outputs = append(c.outputs, col.DisplayName)
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if stmt.distinct {
+		b.WriteString("DISTINCT ")
+	}
+	b.WriteString(strings.Join(outs, ", "))
+
+	var tail strings.Builder
+	if stmt.where != nil {
+		s, err := c.expr(stmt.where)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&tail, " WHERE %s", s)
+	}
+	if len(stmt.groupBy) > 0 {
+		var groups []string
+		for _, g := range stmt.groupBy {
+			s, err := c.orderExpr(g, false)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, s)
+		}
+		fmt.Fprintf(&tail, " GROUP BY %s", strings.Join(groups, ", "))
+	}
+	if stmt.having != nil {
+		s, err := c.expr(stmt.having)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&tail, " HAVING %s", s)
+	}
+	if len(stmt.orderBy) > 0 {
+		var order []string
+		for _, o := range stmt.orderBy {
+			s, err := c.orderExpr(o.x, true)
+			if err != nil {
+				return nil, err
+			}
+			if o.desc {
+				s += " DESC"
+			}
+			if o.nulls != "" {
+				s += " NULLS " + o.nulls
+			}
+			order = append(order, s)
+		}
+		fmt.Fprintf(&tail, " ORDER BY %s", strings.Join(order, ", "))
+	}
+	limit := stmt.limit
+	if limit < 0 || limit > maxRows {
+		limit = maxRows
+	}
+	fmt.Fprintf(&tail, " LIMIT %s", c.args.Add(limit))
+	if stmt.offset > 0 {
+		fmt.Fprintf(&tail, " OFFSET %s", c.args.Add(stmt.offset))
+	}
+
+	// The subquery is written last, once every column is known
+	fmt.Fprintf(&b, " FROM (SELECT %s FROM RecordsProcessed rp WHERE rp.DatasetId = $1) t", strings.Join(append([]string{"rp.RecordId"}, c.selects...), ", "))
+	b.WriteString(tail.String())
+
+	result.SQL = b.String()
+	result.Args = c.args.Values()
+	return result, nil
+}
+
+// resolve returns the header id names. Unquoted names that match no header
+// exactly match ignoring case.
+func (c *compiler) resolve(id *identNode) (*header.Header, error) {
+	if id.qualifier != "" && !strings.EqualFold(id.qualifier, c.stmt.from) && !strings.EqualFold(id.qualifier, c.stmt.fromAlias) {
+		return nil, fmt.Errorf("unknown table %q at position %d", id.qualifier, id.pos)
+	}
+	for _, h := range c.table.Headers {
+		if h.DisplayName == id.name {
+			return h, nil
+		}
+	}
+	if !id.quoted {
+		var match *header.Header
+		for _, h := range c.table.Headers {
+			if strings.EqualFold(h.DisplayName, id.name) {
+				if match != nil {
+					return nil, fmt.Errorf("ambiguous column %q at position %d, quote it to match case", id.name, id.pos)
+				}
+				match = h
+			}
+		}
+		if match != nil {
+			return match, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown column %q at position %d", id.name, id.pos)
+}
+
+// column returns the expression of h's value, selecting it in t if needed.
+func (c *compiler) column(h *header.Header) string {
+	if s, ok := c.columns[h.HeaderId]; ok {
+		return s
+	}
+	alias := fmt.Sprintf("c%d", len(c.selects)+1)
+	c.selects = append(c.selects, fmt.Sprintf("%s AS %s", Column(h, "rp.RecordId", c.args), alias))
+	c.columns[h.HeaderId] = "t." + alias
+	return c.columns[h.HeaderId]
+}
+
+// orderExpr compiles an expression of GROUP BY or ORDER BY, which may also
+// name an output column. Names in ORDER BY prefer output columns, and names
+// in GROUP BY prefer dataset columns.
+func (c *compiler) orderExpr(x node, preferOutput bool) (string, error) {
+	id, ok := x.(*identNode)
+	if !ok || id.qualifier != "" {
+		return c.expr(x)
+	}
+	output := func() (string, bool) {
+		for i, o := range c.outputs {
+			if o == id.name || !id.quoted && strings.EqualFold(o, id.name) {
+				return fmt.Sprintf("o%d", i+1), true
+			}
+		}
+		return "", false
+	}
+	if preferOutput {
+		if s, ok := output(); ok {
+			return s, nil
+		}
+		return c.expr(x)
+	}
+	if _, err := c.resolve(id); err != nil {
+		if s, ok := output(); ok {
+			return s, nil
+		}
+	}
+	return c.expr(x)
+}
+
+func (c *compiler) expr(x node) (string, error) {
+	switch x := x.(type) {
+	case *identNode:
+		h, err := c.resolve(x)
+		if err != nil {
+			return "", err
+		}
+		return c.column(h), nil
+	case *literalNode:
+		switch x.kind {
+		case sqlString:
+			return c.args.Add(x.text), nil
+		case sqlNumber:
+			// Validated by sqlLex
+			return x.text, nil
+		}
+		return x.text, nil
+	case *unaryNode:
+		s, err := c.expr(x.x)
+		if err != nil {
+			return "", err
+		}
+		if x.op == "NOT" {
+			return fmt.Sprintf("(NOT %s)", s), nil
+		}
+		return fmt.Sprintf("(%s%s)", x.op, s), nil
+	case *binaryNode:
+		l, err := c.expr(x.l)
+		if err != nil {
+			return "", err
+		}
+		r, err := c.expr(x.r)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s %s %s)", l, x.op, r), nil
+	case *callNode:
+		if x.star {
+			return "COUNT(*)", nil
+		}
+		args := make([]string, 0, len(x.args))
+		for _, a := range x.args {
+			s, err := c.expr(a)
+			if err != nil {
+				return "", err
+			}
+			args = append(args, s)
+		}
+		distinct := ""
+		if x.distinct {
+			distinct = "DISTINCT "
+		}
+		return fmt.Sprintf("%s(%s%s)", strings.ToUpper(x.name), distinct, strings.Join(args, ", ")), nil
+	case *isNullNode:
+		s, err := c.expr(x.x)
+		if err != nil {
+			return "", err
+		}
+		if x.not {
+			return fmt.Sprintf("(%s IS NOT NULL)", s), nil
+		}
+		return fmt.Sprintf("(%s IS NULL)", s), nil
+	case *inNode:
+		s, err := c.expr(x.x)
+		if err != nil {
+			return "", err
+		}
+		list := make([]string, 0, len(x.list))
+		for _, e := range x.list {
+			v, err := c.expr(e)
+			if err != nil {
+				return "", err
+			}
+			list = append(list, v)
+		}
+		op := "IN"
+		if x.not {
+			op = "NOT IN"
+		}
+		return fmt.Sprintf("(%s %s (%s))", s, op, strings.Join(list, ", ")), nil
+	case *betweenNode:
+		s, err := c.expr(x.x)
+		if err != nil {
+			return "", err
+		}
+		lo, err := c.expr(x.lo)
+		if err != nil {
+			return "", err
+		}
+		hi, err := c.expr(x.hi)
+		if err != nil {
+			return "", err
+		}
+		op := "BETWEEN"
+		if x.not {
+			op = "NOT BETWEEN"
+		}
+		return fmt.Sprintf("(%s %s %s AND %s)", s, op, lo, hi), nil
+	}
+	return "", fmt.Errorf("unknown expression: %v", x)
+}
@@ -0,0 +1,118 @@
+package query_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+func teams(name string) (*query.Table, error) {
+	if !strings.EqualFold(name, "teams") {
+		return nil, fmt.Errorf("unknown dataset: %q", name)
+	}
+	return &query.Table{
+		DatasetId: 9,
+		Headers: []*header.Header{
+			{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+			{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+			{HeaderId: 11, DisplayName: "HEAD COACH", ValueType: header.ValueType_STRING},
+		},
+	}, nil
+}
+
+// cell is the SQL of a column's value in the subquery.
+func cell(column string, p int) string {
+	return fmt.Sprintf("(SELECT c.%s FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $%d)", column, p)
+}
+
+func TestCompileSelect(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		query       string
+		wantSQL     string
+		wantArgs    []any
+		wantColumns []string
+	}{
+		{
+			desc:  "group_by",
+			query: `SELECT city, avg(arenacapacity) FROM teams GROUP BY city`,
+			wantSQL: "SELECT t.c1 AS o1, AVG(t.c2) AS o2 FROM (SELECT rp.RecordId, " + cell("RawValue", 2) + " AS c1, " + cell("NumericValue", 3) + " AS c2 " +
+				"FROM RecordsProcessed rp WHERE rp.DatasetId = $1) t GROUP BY t.c1 LIMIT $4",
+			wantArgs:    []any{int64(9), int64(8), int64(10), int64(100)},
+			wantColumns: []string{"CITY", "avg"},
+		},
+		{
+			desc:  "where_order_limit",
+			query: `select "HEAD COACH" as coach, ArenaCapacity from Teams t where t.city in ('Boston', 'Miami') and not arenacapacity between 1 and 2.5e4 order by coach desc nulls last limit 5 offset 10;`,
+			wantSQL: "SELECT t.c1 AS o1, t.c2 AS o2 FROM (SELECT rp.RecordId, " + cell("RawValue", 2) + " AS c1, " + cell("NumericValue", 3) + " AS c2, " + cell("RawValue", 4) + " AS c3 " +
+				"FROM RecordsProcessed rp WHERE rp.DatasetId = $1) t WHERE ((t.c3 IN ($5, $6)) AND (NOT (t.c2 BETWEEN 1 AND 2.5e4))) ORDER BY o1 DESC NULLS LAST LIMIT $7 OFFSET $8",
+			wantArgs:    []any{int64(9), int64(11), int64(10), int64(8), "Boston", "Miami", int64(5), int64(10)},
+			wantColumns: []string{"coach", "ARENACAPACITY"},
+		},
+		{
+			desc:  "star_and_limit_cap",
+			query: `SELECT * FROM teams LIMIT 1000000`,
+			wantSQL: "SELECT t.c1 AS o1, t.c2 AS o2, t.c3 AS o3 FROM (SELECT rp.RecordId, " + cell("RawValue", 2) + " AS c1, " + cell("NumericValue", 3) + " AS c2, " + cell("RawValue", 4) + " AS c3 " +
+				"FROM RecordsProcessed rp WHERE rp.DatasetId = $1) t LIMIT $5",
+			wantArgs:    []any{int64(9), int64(8), int64(10), int64(11), int64(100)},
+			wantColumns: []string{"CITY", "ARENACAPACITY", "HEAD COACH"},
+		},
+		{
+			desc:  "expressions",
+			query: `SELECT count(DISTINCT lower(city)), -arenacapacity * 2, count(*) FROM teams WHERE city LIKE 'B%' OR city IS NULL`,
+			wantSQL: "SELECT COUNT(DISTINCT LOWER(t.c1)) AS o1, ((-t.c2) * 2) AS o2, COUNT(*) AS o3 FROM (SELECT rp.RecordId, " + cell("RawValue", 2) + " AS c1, " + cell("NumericValue", 3) + " AS c2 " +
+				"FROM RecordsProcessed rp WHERE rp.DatasetId = $1) t WHERE ((t.c1 LIKE $4) OR (t.c1 IS NULL)) LIMIT $5",
+			wantArgs:    []any{int64(9), int64(8), int64(10), "B%", int64(100)},
+			wantColumns: []string{"count", "column_2", "count"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := query.CompileSelect(tc.query, teams, 100)
+			if err != nil {
+				t.Fatalf("got unexpected error for CompileSelect(): %v", err)
+			}
+			if got.SQL != tc.wantSQL {
+				t.Errorf("CompileSelect() = %s, want: %s", got.SQL, tc.wantSQL)
+			}
+			if !reflect.DeepEqual(got.Args, tc.wantArgs) {
+				t.Errorf("CompileSelect() args = %v, want: %v", got.Args, tc.wantArgs)
+			}
+			var columns []string
+			for _, c := range got.Columns {
+				columns = append(columns, c.DisplayName)
+			}
+			if !reflect.DeepEqual(columns, tc.wantColumns) {
+				t.Errorf("CompileSelect() columns = %v, want: %v", columns, tc.wantColumns)
+			}
+		})
+	}
+}
+
+func TestCompileSelectErrors(t *testing.T) {
+	for _, q := range []string{
+		``,
+		`DELETE FROM teams`,
+		`SELECT city FROM players`,
+		`SELECT team FROM teams`,
+		`SELECT "city" FROM teams`,
+		`SELECT city FROM teams; DROP TABLE Cells`,
+		`SELECT city FROM teams WHERE city = 'Boston`,
+		`SELECT pg_sleep(10) FROM teams`,
+		`SELECT city FROM teams, Cells`,
+		`SELECT city FROM teams JOIN Cells ON true`,
+		`SELECT x.city FROM teams`,
+		`SELECT city FROM teams LIMIT -1`,
+		`SELECT city FROM (SELECT * FROM Cells)`,
+		`SELECT city FROM teams /* comment */`,
+		`SELECT city FROM teams WHERE city NOT = 'Boston'`,
+	} {
+		if _, err := query.CompileSelect(q, teams, 100); err == nil {
+			t.Errorf("CompileSelect(%q) expected error, got nil", q)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// SortKey orders rows by the values of a column.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return k.Field + ":desc"
+	}
+	return k.Field + ":asc"
+}
+
+// ParseSort parses a comma separated list of columns, each optionally
+// followed by :asc or :desc, e.g. "CITY,ARENACAPACITY:desc". Columns are
+// named as in a filter.
+func ParseSort(s string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, f := range strings.Split(s, ",") {
+		k := SortKey{Field: strings.TrimSpace(f)}
+		if i := strings.LastIndex(k.Field, ":"); i >= 0 {
+			switch strings.ToLower(strings.TrimSpace(k.Field[i+1:])) {
+			case "asc":
+			case "desc":
+				k.Desc = true
+			default:
+				return nil, fmt.Errorf("invalid sort direction: %q", k.Field[i+1:])
+			}
+			k.Field = strings.TrimSpace(k.Field[:i])
+		}
+		k.Field = strings.Trim(k.Field, "`")
+		if k.Field == "" {
+			return nil, fmt.Errorf("invalid sort: %q", s)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Cursor is the position of the last row of a sorted page: its RecordId and
+// its values for each SortKey. Nil values are NULL.
+type Cursor struct {
+	RecordId int64     `json:"r"`
+	Values   []*string `json:"v"`
+}
+
+// Encode returns c as an opaque, URL safe string.
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the Cursor encoded by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %q", s)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %q", s)
+	}
+	return &c, nil
+}
+
+// SortColumns returns the SQL expression of each key's value for the record
+// whose RecordId is the SQL expression recordId. Typed columns sort by their
+// typed values, and everything else sorts as text.
+func SortColumns(keys []SortKey, recordId string, resolve Resolver, args *Args) ([]string, error) {
+	columns := make([]string, 0, len(keys))
+	for _, k := range keys {
+		h, err := resolve(k.Field)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, Column(h, recordId, args))
+	}
+	return columns, nil
+}
+
+// Column returns the SQL expression of h's value for the record whose
+// RecordId is the SQL expression recordId: its typed value if h has a type,
+// and RawValue otherwise.
+func Column(h *header.Header, recordId string, args *Args) string {
+	return fmt.Sprintf("(SELECT c.%s FROM Cells c WHERE c.RecordId = %s AND c.HeaderId = %s)", valueColumn(h.ValueType), recordId, args.Add(h.HeaderId))
+}
+
+func valueColumn(vt header.ValueType) string {
+	switch vt {
+	case header.ValueType_INT, header.ValueType_FLOAT:
+		return "NumericValue"
+	case header.ValueType_DATE, header.ValueType_TIMESTAMP:
+		return "TimeValue"
+	case header.ValueType_BOOL:
+		return "BoolValue"
+	}
+	return "RawValue"
+}
+
+// OrderBy returns the ORDER BY clause of keys over columns. NULLs, i.e.
+// blank values and values that don't parse as the column's type, sort last
+// in both directions, and ties are broken by recordId.
+func OrderBy(keys []SortKey, columns []string, recordId string) string {
+	terms := make([]string, 0, len(keys)+1)
+	for i, k := range keys {
+		dir := "ASC"
+		if k.Desc {
+			dir = "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s NULLS LAST", columns[i], dir))
+	}
+	return strings.Join(append(terms, recordId), ", ")
+}
+
+// After returns a predicate that matches the rows that OrderBy sorts after c.
+func After(keys []SortKey, columns []string, recordId string, c *Cursor, args *Args) (string, error) {
+	if len(c.Values) != len(keys) {
+		return "", fmt.Errorf("cursor doesn't match sort")
+	}
+
+	// Rows that tie on the first i keys, and sort after c on key i
+	var terms []string
+	var equal []string
+	for i, k := range keys {
+		v := c.Values[i]
+		if v == nil {
+			// Only NULLs tie with a NULL, and nothing sorts after one
+			equal = append(equal, fmt.Sprintf("%s IS NULL", columns[i]))
+			continue
+		}
+		op := ">"
+		if k.Desc {
+			op = "<"
+		}
+		p := args.Add(*v)
+		terms = append(terms, conjunction(append(equal, fmt.Sprintf("(%s %s %s OR %s IS NULL)", columns[i], op, p, columns[i]))))
+		equal = append(equal, fmt.Sprintf("%s = %s", columns[i], p))
+	}
+	terms = append(terms, conjunction(append(equal, fmt.Sprintf("%s > %s", recordId, args.Add(c.RecordId)))))
+	return "(" + strings.Join(terms, " OR ") + ")", nil
+}
+
+func conjunction(terms []string) string {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " AND ") + ")"
+}
@@ -0,0 +1,98 @@
+package query_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dantespe/spectacle/header"
+	"github.com/dantespe/spectacle/query"
+)
+
+func TestParseSort(t *testing.T) {
+	testCases := []struct {
+		sort string
+		want []query.SortKey
+	}{
+		{"CITY", []query.SortKey{{Field: "CITY"}}},
+		{"CITY:asc, ARENACAPACITY:DESC", []query.SortKey{{Field: "CITY"}, {Field: "ARENACAPACITY", Desc: true}}},
+		{"`HEAD COACH`:desc,8", []query.SortKey{{Field: "HEAD COACH", Desc: true}, {Field: "8"}}},
+	}
+	for _, tc := range testCases {
+		got, err := query.ParseSort(tc.sort)
+		if err != nil {
+			t.Errorf("ParseSort(%q) got unexpected error: %v", tc.sort, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseSort(%q) = %v, want: %v", tc.sort, got, tc.want)
+		}
+	}
+
+	for _, sort := range []string{"CITY:up", "CITY,", ":desc"} {
+		if _, err := query.ParseSort(sort); err == nil {
+			t.Errorf("ParseSort(%q) expected error, got nil", sort)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	city := "Boston"
+	c := &query.Cursor{RecordId: 42, Values: []*string{&city, nil}}
+	got, err := query.DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("got unexpected error for DecodeCursor(): %v", err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("DecodeCursor(Encode()) = %+v, want: %+v", got, c)
+	}
+
+	if _, err := query.DecodeCursor("not a cursor"); err == nil {
+		t.Errorf("DecodeCursor() expected error, got nil")
+	}
+}
+
+func TestSortSQL(t *testing.T) {
+	resolve := query.HeaderResolver([]*header.Header{
+		{HeaderId: 8, DisplayName: "CITY", ValueType: header.ValueType_STRING},
+		{HeaderId: 10, DisplayName: "ARENACAPACITY", ValueType: header.ValueType_INT},
+	})
+	keys := []query.SortKey{{Field: "ARENACAPACITY", Desc: true}, {Field: "CITY"}}
+
+	args := query.NewArgs(int64(1))
+	columns, err := query.SortColumns(keys, "rp.RecordId", resolve, args)
+	if err != nil {
+		t.Fatalf("got unexpected error for SortColumns(): %v", err)
+	}
+	wantColumns := []string{
+		"(SELECT c.NumericValue FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $2)",
+		"(SELECT c.RawValue FROM Cells c WHERE c.RecordId = rp.RecordId AND c.HeaderId = $3)",
+	}
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Errorf("SortColumns() = %v, want: %v", columns, wantColumns)
+	}
+
+	aliases := []string{"s0", "s1"}
+	if got, want := query.OrderBy(keys, aliases, "id"), "s0 DESC NULLS LAST, s1 ASC NULLS LAST, id"; got != want {
+		t.Errorf("OrderBy() = %s, want: %s", got, want)
+	}
+
+	capacity := "18624"
+	after, err := query.After(keys, aliases, "id", &query.Cursor{RecordId: 7, Values: []*string{&capacity, nil}}, args)
+	if err != nil {
+		t.Fatalf("got unexpected error for After(): %v", err)
+	}
+	wantAfter := "((s0 < $4 OR s0 IS NULL) OR (s0 = $4 AND s1 IS NULL AND id > $5))"
+	if after != wantAfter {
+		t.Errorf("After() = %s, want: %s", after, wantAfter)
+	}
+	if got, want := args.Values()[3:], []any{"18624", int64(7)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("After() args = %v, want: %v", got, want)
+	}
+
+	if _, err := query.After(keys, aliases, "id", &query.Cursor{RecordId: 7}, args); err == nil {
+		t.Errorf("After() expected error for a cursor of another sort, got nil")
+	}
+	if _, err := query.SortColumns([]query.SortKey{{Field: "TEAM"}}, "rp.RecordId", resolve, args); err == nil {
+		t.Errorf("SortColumns() expected error for unknown column, got nil")
+	}
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dantespe/spectacle/header"
+)
+
+// Args collects the parameters of a SQL statement.
+type Args struct {
+	values []any
+}
+
+// NewArgs returns Args that already hold the parameters $1..$n.
+func NewArgs(values ...any) *Args {
+	return &Args{values: values}
+}
+
+// Add adds v, and returns its placeholder.
+func (a *Args) Add(v any) string {
+	a.values = append(a.values, v)
+	return fmt.Sprintf("$%d", len(a.values))
+}
+
+// Values to pass with the statement.
+func (a *Args) Values() []any {
+	return a.values
+}
+
+// Resolver returns the Header a filter's field refers to.
+type Resolver func(field string) (*header.Header, error)
+
+// HeaderResolver resolves fields against headers by display name or, failing
+// that, by header id.
+func HeaderResolver(headers []*header.Header) Resolver {
+	return func(field string) (*header.Header, error) {
+		for _, h := range headers {
+			if h.DisplayName == field {
+				return h, nil
+			}
+		}
+		if id, err := strconv.ParseInt(field, 10, 64); err == nil {
+			for _, h := range headers {
+				if h.HeaderId == id {
+					return h, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("unknown column: %q", field)
+	}
+}
+
+var sqlOps = map[Op]string{
+	Op_EQ: "=",
+	Op_NE: "<>",
+	Op_GT: ">",
+	Op_GE: ">=",
+	Op_LT: "<",
+	Op_LE: "<=",
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SQL translates e to a predicate over the record whose RecordId is the SQL
+// expression recordId. Parameters are added to args.
+//
+// Comparisons use the typed value of a cell when the column has a type, and
+// the value parses as it. Otherwise they compare RawValue as text.
+func SQL(e Expr, recordId string, resolve Resolver, args *Args) (string, error) {
+	switch e := e.(type) {
+	case *And:
+		return binary(e.Left, "AND", e.Right, recordId, resolve, args)
+	case *Or:
+		return binary(e.Left, "OR", e.Right, recordId, resolve, args)
+	case *Not:
+		x, err := SQL(e.X, recordId, resolve, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT %s", x), nil
+	case *Compare:
+		return compare(e, recordId, resolve, args)
+	}
+	return "", fmt.Errorf("unknown expression: %v", e)
+}
+
+func binary(l Expr, op string, r Expr, recordId string, resolve Resolver, args *Args) (string, error) {
+	ls, err := SQL(l, recordId, resolve, args)
+	if err != nil {
+		return "", err
+	}
+	rs, err := SQL(r, recordId, resolve, args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", ls, op, rs), nil
+}
+
+func compare(c *Compare, recordId string, resolve Resolver, args *Args) (string, error) {
+	h, err := resolve(c.Field)
+	if err != nil {
+		return "", err
+	}
+
+	headerId := args.Add(h.HeaderId)
+	var cond string
+	switch c.Op {
+	case Op_CONTAINS:
+		cond = fmt.Sprintf("c.RawValue LIKE %s", args.Add("%"+likeEscaper.Replace(c.Value.Raw)+"%"))
+	case Op_STARTSWITH:
+		cond = fmt.Sprintf("c.RawValue LIKE %s", args.Add(likeEscaper.Replace(c.Value.Raw)+"%"))
+	default:
+		column, v, cast := typed(h.ValueType, c.Value)
+		cond = fmt.Sprintf("c.%s %s %s%s", column, sqlOps[c.Op], args.Add(v), cast)
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM Cells c WHERE c.RecordId = %s AND c.HeaderId = %s AND %s)", recordId, headerId, cond), nil
+}
+
+// numericLiteral matches the literals that are compared as numbers. It's
+// what both strconv.ParseFloat and Postgres' numeric accept.
+var numericLiteral = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// typed returns the Cells column to compare v with for a column of type vt,
+// v as a value of that column, and the cast to apply to its placeholder.
+func typed(vt header.ValueType, v Value) (string, any, string) {
+	switch vt {
+	case header.ValueType_INT, header.ValueType_FLOAT:
+		// The literal is bound as is, so it isn't rounded to a float64
+		if raw := strings.TrimSpace(v.Raw); numericLiteral.MatchString(raw) {
+			return "NumericValue", raw, "::numeric"
+		}
+	case header.ValueType_DATE, header.ValueType_TIMESTAMP:
+		for _, t := range []header.ValueType{header.ValueType_TIMESTAMP, header.ValueType_DATE} {
+			if p, err := t.Parse(v.Raw); err == nil {
+				return "TimeValue", p, ""
+			}
+		}
+	case header.ValueType_BOOL:
+		if b, err := vt.Parse(v.Raw); err == nil {
+			return "BoolValue", b, ""
+		}
+	}
+	return "RawValue", v.Raw, ""
+}
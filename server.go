@@ -2,17 +2,34 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 
 	"github.com/dantespe/spectacle/handler"
+	"github.com/dantespe/spectacle/manager"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	workers   = flag.Int("workers", manager.DefaultWorkers, "number of background operations (uploads, deletes) that run at once")
+	queueSize = flag.Int("queue_size", manager.DefaultQueueSize, "number of background operations that may wait for a worker before requests are rejected")
+
+	queryTimeout = flag.Duration("query_timeout", manager.DefaultQueryTimeout, "how long a query to /rest/query may run")
+	maxQueryRows = flag.Int64("max_query_rows", manager.DefaultMaxQueryRows, "the most rows a query to /rest/query returns")
+)
+
 func main() {
+	flag.Parse()
+
 	router := gin.Default()
 	// REST
-	if err := handler.AddRestHandlerRoutes(router.Group("rest")); err != nil {
+	if err := handler.AddRestHandlerRoutes(router.Group("rest"),
+		manager.WithWorkers(*workers),
+		manager.WithQueueSize(*queueSize),
+		manager.WithQueryTimeout(*queryTimeout),
+		manager.WithMaxQueryRows(*maxQueryRows),
+	); err != nil {
 		log.Fatal(err)
 	}
 